@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/rufflogix/computer-network-project/internal/config"
 	"github.com/rufflogix/computer-network-project/internal/controller"
 	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/fakeidp"
 	"github.com/rufflogix/computer-network-project/internal/middleware"
 	"github.com/rufflogix/computer-network-project/internal/repository"
 	"github.com/rufflogix/computer-network-project/internal/service"
@@ -72,6 +75,39 @@ func main() {
 	if err := repository.CreateNotificationIndexes(db); err != nil {
 		log.Printf("Warning: Failed to create notification indexes: %v", err)
 	}
+	if err := repository.CreateUserIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create user indexes: %v", err)
+	}
+	if err := repository.CreateAuthTokenIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create auth token indexes: %v", err)
+	}
+	if err := repository.CreateSessionIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create session indexes: %v", err)
+	}
+	if err := repository.CreateIdentityIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create identity indexes: %v", err)
+	}
+	if err := repository.CreateAPITokenIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create API token indexes: %v", err)
+	}
+	if err := repository.CreateWebhookIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create webhook indexes: %v", err)
+	}
+	if err := repository.CreateThreadIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create thread indexes: %v", err)
+	}
+	if err := repository.CreateScheduledMessageIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create scheduled message indexes: %v", err)
+	}
+	if err := repository.CreateLinkPreviewIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create link preview indexes: %v", err)
+	}
+	if err := repository.CreateDraftIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create draft indexes: %v", err)
+	}
+	if err := repository.CreateUploadIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create upload indexes: %v", err)
+	}
 
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
@@ -79,21 +115,64 @@ func main() {
 	invitationRepo := repository.NewInvitationRepository()
 	friendshipRepo := repository.NewMongoFriendshipRepository(db)
 	notificationRepo := repository.NewMongoNotificationRepository(db)
+	authTokenRepo := repository.NewAuthTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	threadRepo := repository.NewThreadRepository(db)
+	scheduledMessageRepo := repository.NewScheduledMessageRepository(db)
+	linkPreviewRepo := repository.NewLinkPreviewRepository(db)
+	draftRepo := repository.NewDraftRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
 
 	// Initialize services
 	roomService := service.NewRoomService()
-	chatService := service.NewChatService(chatRepo, userRepo)
-	notificationService := service.NewNotificationService(notificationRepo, friendshipRepo, chatRepo, userRepo, roomService)
-	invitationService := service.NewInvitationService(invitationRepo, chatRepo, friendshipRepo, notificationService, userRepo)
-	authService := service.NewAuthService(userRepo)
+	webhookService := service.NewWebhookService(webhookRepo, chatRepo, userRepo)
+	notificationService := service.NewNotificationService(notificationRepo, friendshipRepo, chatRepo, userRepo, roomService, webhookService)
+	linkPreviewService := service.NewLinkPreviewService(linkPreviewRepo, chatRepo, roomService)
+	chatService := service.NewChatService(chatRepo, userRepo, threadRepo, uploadRepo, notificationService, webhookService, linkPreviewService)
+	invitationService := service.NewInvitationService(invitationRepo, chatRepo, friendshipRepo, notificationService, userRepo, webhookService)
+	mailer := service.NewMailerFromEnv()
+	loginGuard := service.NewLoginGuard(service.NewMailLockoutNotifier(userRepo, mailer))
+	keyProvider := service.MustLoadKeyProvider()
+	authService := service.NewAuthService(userRepo, authTokenRepo, sessionRepo, apiTokenRepo, roomService, mailer, loginGuard, keyProvider)
+	oidcService := service.NewOIDCService(identityRepo, userRepo, authService)
+	userService := service.NewUserService(userRepo, friendshipRepo, chatRepo, roomService, authService)
+	guestService := service.NewGuestService(userRepo, chatRepo, notificationRepo, friendshipRepo, draftRepo, threadRepo, authService, roomService)
+	incomingWebhookService := service.NewIncomingWebhookService(webhookRepo, chatRepo, chatService, roomService)
+	pollService := service.NewPollService(chatRepo, chatService, roomService)
+	commandService := service.NewCommandService(chatRepo, userRepo, chatService, roomService, pollService)
+	pinService := service.NewPinService(chatRepo, chatService, roomService)
+	forwardService := service.NewForwardService(chatRepo, userRepo, uploadRepo, chatService, roomService)
+	draftService := service.NewDraftService(draftRepo, chatRepo, roomService)
+	scheduledMessageService := service.NewScheduledMessageService(scheduledMessageRepo, chatRepo, uploadRepo, chatService, roomService)
+	retentionService := service.NewRetentionService(chatRepo, threadRepo, uploadRepo, chatService, roomService)
+	botService := service.NewBotService(userRepo, apiTokenRepo, chatRepo, roomService)
+	guestMessageLimiter := middleware.NewGuestMessageLimiter()
+
+	// Remove expired guest accounts in the background
+	guestService.StartJanitor(context.Background())
+
+	// Deliver chat events to outgoing webhooks
+	webhookService.StartWorker(context.Background())
+
+	// Send scheduled messages when they are due
+	scheduledMessageService.StartScheduler(context.Background())
+
+	// Remove disappearing messages once they expire
+	retentionService.StartSweeper(context.Background())
+
+	// Close polls when their close time passes
+	pollService.StartCloser(context.Background())
 
 	// Initialize global chat if it doesn't exist
 	globalChatID := initializeGlobalChat(chatService)
 
 	// Initialize handlers
-	httpHandler := controller.NewHTTPHandler(chatService, invitationService, notificationService, authService, roomService, userRepo)
-	wsHandler := controller.NewWSHandler(chatService, roomService, notificationService, invitationService, globalChatID)
-	authHandler := controller.NewAuthHandler(authService, chatService, globalChatID)
+	httpHandler := controller.NewHTTPHandler(chatService, invitationService, notificationService, authService, roomService, userService, guestService, botService, webhookService, incomingWebhookService, commandService, pinService, scheduledMessageService, retentionService, pollService, forwardService, draftService, userRepo, guestMessageLimiter, keyProvider)
+	wsHandler := controller.NewWSHandler(chatService, roomService, notificationService, invitationService, commandService, pollService, draftService, guestMessageLimiter, globalChatID)
+	authHandler := controller.NewAuthHandler(authService, chatService, loginGuard, oidcService, globalChatID)
 
 	r := gin.Default()
 
@@ -117,9 +196,20 @@ func main() {
 
 	httpHandler.RegisterRoutes(r)
 
-	r.GET("/ws", middleware.OptionalAuthMiddleware(authService), func(c *gin.Context) {
-		wsHandler.HandleWS(c.Writer, c.Request)
-	})
+	// Development identity provider for "sign in with" flows, never enable in production
+	if os.Getenv("OIDC_FAKE_IDP") == "true" {
+		if os.Getenv("APP_ENV") == "production" {
+			log.Fatal("OIDC_FAKE_IDP signs in anyone and cannot be enabled with APP_ENV=production")
+		}
+		idp, err := fakeidp.New(os.Getenv("OIDC_FAKE_ISSUER"), os.Getenv("OIDC_FAKE_CLIENT_ID"), os.Getenv("OIDC_FAKE_CLIENT_SECRET"))
+		if err != nil {
+			log.Fatalf("Failed to start fake identity provider: %v", err)
+		}
+		r.Any("/fake-idp/*path", gin.WrapH(http.StripPrefix("/fake-idp", idp)))
+		log.Println("Warning: fake identity provider enabled at /fake-idp")
+	}
+
+	r.GET("/ws", middleware.WebSocketAuthMiddleware(authService), wsHandler.HandleWS)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -6,6 +6,7 @@ package main
 import (
 	"github.com/google/wire"
 	"github.com/rufflogix/computer-network-project/internal/controller"
+	"github.com/rufflogix/computer-network-project/internal/middleware"
 	"github.com/rufflogix/computer-network-project/internal/repository"
 	"github.com/rufflogix/computer-network-project/internal/service"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -30,11 +31,38 @@ func InitializeHandlers(db *mongo.Database) ServerHandlers {
 		repository.NewMongoFriendshipRepository,
 		repository.NewMongoNotificationRepository,
 		repository.NewUserRepository,
+		repository.NewAuthTokenRepository,
+		repository.NewSessionRepository,
+		repository.NewAPITokenRepository,
+		repository.NewWebhookRepository,
+		repository.NewThreadRepository,
+		repository.NewScheduledMessageRepository,
+		repository.NewLinkPreviewRepository,
+		repository.NewDraftRepository,
+		repository.NewUploadRepository,
+		service.NewMailerFromEnv,
+		service.NewMailLockoutNotifier,
+		service.NewLoginGuard,
+		service.MustLoadKeyProvider,
 		service.NewRoomService,
+		service.NewWebhookService,
+		service.NewLinkPreviewService,
 		service.NewChatService,
 		service.NewNotificationService,
 		service.NewInvitationService,
 		service.NewAuthService,
+		service.NewUserService,
+		service.NewGuestService,
+		service.NewBotService,
+		service.NewIncomingWebhookService,
+		service.NewPollService,
+		service.NewCommandService,
+		service.NewPinService,
+		service.NewForwardService,
+		service.NewDraftService,
+		service.NewScheduledMessageService,
+		service.NewRetentionService,
+		middleware.NewGuestMessageLimiter,
 		controller.NewHTTPHandler,
 		provideServerHandlers,
 	)
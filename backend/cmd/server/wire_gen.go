@@ -8,6 +8,7 @@ package main
 
 import (
 	"github.com/rufflogix/computer-network-project/internal/controller"
+	"github.com/rufflogix/computer-network-project/internal/middleware"
 	"github.com/rufflogix/computer-network-project/internal/repository"
 	"github.com/rufflogix/computer-network-project/internal/service"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -18,15 +19,42 @@ import (
 func InitializeHandlers(db *mongo.Database) ServerHandlers {
 	chatRepository := repository.NewMongoChatRepository(db)
 	userRepository := repository.NewUserRepository(db)
-	chatService := service.NewChatService(chatRepository, userRepository)
-	invitationRepository := repository.NewInvitationRepository()
-	friendshipRepository := repository.NewMongoFriendshipRepository(db)
+	webhookRepository := repository.NewWebhookRepository(db)
+	webhookService := service.NewWebhookService(webhookRepository, chatRepository, userRepository)
+	threadRepository := repository.NewThreadRepository(db)
 	notificationRepository := repository.NewMongoNotificationRepository(db)
+	friendshipRepository := repository.NewMongoFriendshipRepository(db)
 	roomService := service.NewRoomService()
-	notificationService := service.NewNotificationService(notificationRepository, friendshipRepository, chatRepository, userRepository, roomService)
-	invitationService := service.NewInvitationService(invitationRepository, chatRepository, friendshipRepository, notificationService, userRepository)
-	authService := service.NewAuthService(userRepository)
-	httpHandler := controller.NewHTTPHandler(chatService, invitationService, notificationService, authService, roomService, userRepository)
+	notificationService := service.NewNotificationService(notificationRepository, friendshipRepository, chatRepository, userRepository, roomService, webhookService)
+	linkPreviewRepository := repository.NewLinkPreviewRepository(db)
+	linkPreviewService := service.NewLinkPreviewService(linkPreviewRepository, chatRepository, roomService)
+	uploadRepository := repository.NewUploadRepository(db)
+	chatService := service.NewChatService(chatRepository, userRepository, threadRepository, uploadRepository, notificationService, webhookService, linkPreviewService)
+	invitationRepository := repository.NewInvitationRepository()
+	invitationService := service.NewInvitationService(invitationRepository, chatRepository, friendshipRepository, notificationService, userRepository, webhookService)
+	authTokenRepository := repository.NewAuthTokenRepository(db)
+	sessionRepository := repository.NewSessionRepository(db)
+	apiTokenRepository := repository.NewAPITokenRepository(db)
+	mailer := service.NewMailerFromEnv()
+	lockoutNotifier := service.NewMailLockoutNotifier(userRepository, mailer)
+	loginGuard := service.NewLoginGuard(lockoutNotifier)
+	keyProvider := service.MustLoadKeyProvider()
+	authService := service.NewAuthService(userRepository, authTokenRepository, sessionRepository, apiTokenRepository, roomService, mailer, loginGuard, keyProvider)
+	userService := service.NewUserService(userRepository, friendshipRepository, chatRepository, roomService, authService)
+	draftRepository := repository.NewDraftRepository(db)
+	guestService := service.NewGuestService(userRepository, chatRepository, notificationRepository, friendshipRepository, draftRepository, threadRepository, authService, roomService)
+	incomingWebhookService := service.NewIncomingWebhookService(webhookRepository, chatRepository, chatService, roomService)
+	pollService := service.NewPollService(chatRepository, chatService, roomService)
+	commandService := service.NewCommandService(chatRepository, userRepository, chatService, roomService, pollService)
+	pinService := service.NewPinService(chatRepository, chatService, roomService)
+	forwardService := service.NewForwardService(chatRepository, userRepository, uploadRepository, chatService, roomService)
+	draftService := service.NewDraftService(draftRepository, chatRepository, roomService)
+	scheduledMessageRepository := repository.NewScheduledMessageRepository(db)
+	scheduledMessageService := service.NewScheduledMessageService(scheduledMessageRepository, chatRepository, uploadRepository, chatService, roomService)
+	retentionService := service.NewRetentionService(chatRepository, threadRepository, uploadRepository, chatService, roomService)
+	botService := service.NewBotService(userRepository, apiTokenRepository, chatRepository, roomService)
+	rateLimiter := middleware.NewGuestMessageLimiter()
+	httpHandler := controller.NewHTTPHandler(chatService, invitationService, notificationService, authService, roomService, userService, guestService, botService, webhookService, incomingWebhookService, commandService, pinService, scheduledMessageService, retentionService, pollService, forwardService, draftService, userRepository, rateLimiter, keyProvider)
 	serverHandlers := provideServerHandlers(httpHandler)
 	return serverHandlers
 }
@@ -1,9 +1,14 @@
 package controller
 
 import (
+	"errors"
+	"log"
+	"net"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/middleware"
 	"github.com/rufflogix/computer-network-project/internal/service"
 )
 
@@ -14,13 +19,17 @@ type AuthHandler interface {
 type implAuthHandler struct {
 	authService  service.AuthService
 	chatService  service.ChatService
+	loginGuard   service.LoginGuard
+	oidcService  service.OIDCService
 	globalChatID int64
 }
 
-func NewAuthHandler(authService service.AuthService, chatService service.ChatService, globalChatID int64) AuthHandler {
+func NewAuthHandler(authService service.AuthService, chatService service.ChatService, loginGuard service.LoginGuard, oidcService service.OIDCService, globalChatID int64) AuthHandler {
 	return &implAuthHandler{
 		authService:  authService,
 		chatService:  chatService,
+		loginGuard:   loginGuard,
+		oidcService:  oidcService,
 		globalChatID: globalChatID,
 	}
 }
@@ -29,8 +38,42 @@ func (h *implAuthHandler) RegisterRoutes(router *gin.RouterGroup) {
 	auth := router.Group("/auth")
 	{
 		auth.POST("/register", h.register)
-		auth.POST("/login", h.login)
+		auth.POST("/login", middleware.LoginThrottleMiddleware(h.loginGuard), h.login)
+		auth.POST("/login/2fa", middleware.LoginThrottleMiddleware(h.loginGuard), h.loginTwoFactor)
 		auth.POST("/guest", h.createGuest)
+		auth.POST("/password/forgot", h.forgotPassword)
+		auth.POST("/password/reset", h.resetPassword)
+		auth.POST("/email/verify", h.verifyEmail)
+		auth.POST("/refresh", h.refresh)
+		auth.GET("/oidc/providers", h.getOIDCProviders)
+		auth.POST("/oidc/:provider/start", h.startOIDCLogin)
+		auth.POST("/oidc/:provider/callback", h.completeOIDCLogin)
+	}
+
+	authorized := auth.Group("")
+	authorized.Use(middleware.AuthMiddleware(h.authService))
+	{
+		authorized.POST("/guest/upgrade", h.upgradeGuest)
+		authorized.POST("/password/change", h.changePassword)
+		authorized.POST("/email/resend", h.resendVerificationEmail)
+		authorized.POST("/logout", h.logout)
+		authorized.POST("/logout-all", h.logoutAll)
+		authorized.GET("/sessions", h.getSessions)
+		authorized.DELETE("/sessions/:id", h.revokeSession)
+		authorized.POST("/2fa/setup", h.setupTwoFactor)
+		authorized.POST("/2fa/enable", h.enableTwoFactor)
+		authorized.POST("/2fa/disable", h.disableTwoFactor)
+		authorized.POST("/2fa/recovery-codes", h.regenerateRecoveryCodes)
+		authorized.POST("/oidc/:provider/link", h.startOIDCLink)
+		authorized.GET("/identities", h.getIdentities)
+		authorized.DELETE("/identities/:id", h.unlinkIdentity)
+	}
+
+	// Lets operators lift a login lockout early, e.g. for a user stuck behind a shared IP
+	operator := authorized.Group("/lockouts", middleware.OperatorMiddleware())
+	{
+		operator.DELETE("/users/:username", h.clearUserLockout)
+		operator.DELETE("/ips/:ip", h.clearIPLockout)
 	}
 }
 
@@ -47,7 +90,7 @@ func (h *implAuthHandler) register(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.Register(req.Username, req.Password, req.Name, req.Email)
+	user, tokens, err := h.authService.Register(req.Username, req.Password, req.Name, req.Email, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -61,10 +104,7 @@ func (h *implAuthHandler) register(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	c.JSON(http.StatusCreated, tokenResponse(user, tokens))
 }
 
 func (h *implAuthHandler) login(c *gin.Context) {
@@ -78,9 +118,19 @@ func (h *implAuthHandler) login(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.Login(req.Username, req.Password)
+	user, tokens, challenge, err := h.authService.Login(req.Username, req.Password, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		h.loginError(c, err)
+		return
+	}
+
+	// Two-factor accounts continue at /auth/login/2fa
+	if challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge.ChallengeToken,
+			"expires_at":          challenge.ExpiresAt,
+		})
 		return
 	}
 
@@ -92,10 +142,43 @@ func (h *implAuthHandler) login(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+func (h *implAuthHandler) loginTwoFactor(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, tokens, err := h.authService.CompleteTwoFactorLogin(req.ChallengeToken, req.Code, clientInfo(c))
+	if err != nil {
+		h.loginError(c, err)
+		return
+	}
+
+	if h.globalChatID != 0 {
+		if err := h.chatService.AddMember(h.globalChatID, user.NumericID, "member"); err != nil {
+			log.Printf("Error adding user %d to the global chat: %v", user.NumericID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+// loginError answers 429 for lockouts and 401 for everything else
+func (h *implAuthHandler) loginError(c *gin.Context, err error) {
+	var lockErr *service.LockoutError
+	if errors.As(err, &lockErr) {
+		middleware.AbortWithLockout(c, err)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 }
 
 func (h *implAuthHandler) createGuest(c *gin.Context) {
@@ -108,7 +191,7 @@ func (h *implAuthHandler) createGuest(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.CreateGuestUser(req.Name)
+	user, tokens, err := h.authService.CreateGuestUser(req.Name, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -122,8 +205,366 @@ func (h *implAuthHandler) createGuest(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	c.JSON(http.StatusCreated, tokenResponse(user, tokens))
+}
+
+func (h *implAuthHandler) upgradeGuest(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required,min=3,max=50"`
+		Password string `json:"password" binding:"required,min=6"`
+		Email    string `json:"email" binding:"required,email"`
+		Name     string `json:"name" binding:"omitempty,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, tokens, err := h.authService.UpgradeGuest(c.GetInt64("user_id"), req.Username, req.Password, req.Email, req.Name, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+func (h *implAuthHandler) changePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.ChangePassword(c.GetInt64("user_id"), c.GetString("session_id"), req.CurrentPassword, req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+func (h *implAuthHandler) forgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A failure only happens for existing accounts, so it is logged rather than reported
+	if err := h.authService.RequestPasswordReset(req.Email); err != nil {
+		log.Printf("Error sending password reset email: %v", err)
+	}
+
+	// Same response whether or not the account exists
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+func (h *implAuthHandler) resetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.ResetPassword(req.Token, req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+func (h *implAuthHandler) verifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.VerifyEmail(req.Token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+func (h *implAuthHandler) resendVerificationEmail(c *gin.Context) {
+	if err := h.authService.SendVerificationEmail(c.GetInt64("user_id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+func (h *implAuthHandler) refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, tokens, err := h.authService.RefreshSession(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+func (h *implAuthHandler) logout(c *gin.Context) {
+	if err := h.authService.Logout(c.GetString("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func (h *implAuthHandler) logoutAll(c *gin.Context) {
+	if err := h.authService.LogoutAll(c.GetInt64("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all devices"})
+}
+
+func (h *implAuthHandler) getSessions(c *gin.Context) {
+	sessions, err := h.authService.GetSessions(c.GetInt64("user_id"), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *implAuthHandler) revokeSession(c *gin.Context) {
+	if err := h.authService.RevokeSession(c.GetInt64("user_id"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func (h *implAuthHandler) clearUserLockout(c *gin.Context) {
+	username := c.Param("username")
+	h.loginGuard.ClearLockout(username)
+	log.Printf("Operator %d cleared the login lockout of %q", c.GetInt64("user_id"), username)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
+
+func (h *implAuthHandler) clearIPLockout(c *gin.Context) {
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return
+	}
+
+	// Stored the way gin's ClientIP reports it
+	h.loginGuard.ClearIP(ip.String())
+	log.Printf("Operator %d cleared the login lockout of %s", c.GetInt64("user_id"), ip)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
+
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
+func tokenResponse(user *entity.User, tokens *entity.TokenPair) gin.H {
+	return gin.H{
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	}
+}
+
+func (h *implAuthHandler) setupTwoFactor(c *gin.Context) {
+	setup, err := h.authService.BeginTwoFactorSetup(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+func (h *implAuthHandler) enableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.EnableTwoFactor(c.GetInt64("user_id"), req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *implAuthHandler) disableTwoFactor(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.DisableTwoFactor(c.GetInt64("user_id"), req.Password, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (h *implAuthHandler) regenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c.GetInt64("user_id"), req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *implAuthHandler) getOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oidcService.Providers()})
+}
+
+func (h *implAuthHandler) startOIDCLogin(c *gin.Context) {
+	authURL, err := h.oidcService.StartLogin(c.Param("provider"), 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+func (h *implAuthHandler) startOIDCLink(c *gin.Context) {
+	if c.GetBool("is_guest") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Guest accounts cannot link a login provider"})
+		return
+	}
+
+	authURL, err := h.oidcService.StartLogin(c.Param("provider"), c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// completeOIDCLogin is called by the frontend with the code and state the provider redirected back with
+func (h *implAuthHandler) completeOIDCLogin(c *gin.Context) {
+	var req struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.oidcService.CompleteLogin(c.Param("provider"), req.Code, req.State, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.Linked {
+		c.JSON(http.StatusOK, gin.H{"linked": true, "user": result.User})
+		return
+	}
+
+	if result.Challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     result.Challenge.ChallengeToken,
+			"expires_at":          result.Challenge.ExpiresAt,
+		})
+		return
+	}
+
+	if h.globalChatID != 0 {
+		if err := h.chatService.AddMember(h.globalChatID, result.User.NumericID, "member"); err != nil {
+			log.Printf("Error adding user %d to the global chat: %v", result.User.NumericID, err)
+		}
+	}
+
+	status := http.StatusOK
+	if result.Created {
+		status = http.StatusCreated
+	}
+
+	c.JSON(status, tokenResponse(result.User, result.Tokens))
+}
+
+func (h *implAuthHandler) getIdentities(c *gin.Context) {
+	identities, err := h.oidcService.GetIdentities(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get linked accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+func (h *implAuthHandler) unlinkIdentity(c *gin.Context) {
+	if err := h.oidcService.UnlinkIdentity(c.GetInt64("user_id"), c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
 }
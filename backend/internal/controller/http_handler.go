@@ -2,9 +2,15 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,7 +30,21 @@ type implHTTPHandler struct {
 	notificationService service.NotificationService
 	authService         service.AuthService
 	roomService         service.RoomService
+	userService         service.UserService
+	guestService        service.GuestService
+	botService          service.BotService
+	webhookService      service.WebhookService
+	incomingWebhooks    service.IncomingWebhookService
+	commandService      service.CommandService
+	pinService          service.PinService
+	scheduledMessages   service.ScheduledMessageService
+	retentionService    service.RetentionService
+	pollService         service.PollService
+	forwardService      service.ForwardService
+	draftService        service.DraftService
 	userRepository      repository.UserRepository
+	guestMessageLimiter *middleware.RateLimiter
+	keyProvider         service.KeyProvider
 }
 
 func NewHTTPHandler(
@@ -33,7 +53,21 @@ func NewHTTPHandler(
 	notificationService service.NotificationService,
 	authService service.AuthService,
 	roomService service.RoomService,
+	userService service.UserService,
+	guestService service.GuestService,
+	botService service.BotService,
+	webhookService service.WebhookService,
+	incomingWebhooks service.IncomingWebhookService,
+	commandService service.CommandService,
+	pinService service.PinService,
+	scheduledMessages service.ScheduledMessageService,
+	retentionService service.RetentionService,
+	pollService service.PollService,
+	forwardService service.ForwardService,
+	draftService service.DraftService,
 	userRepository repository.UserRepository,
+	guestMessageLimiter *middleware.RateLimiter,
+	keyProvider service.KeyProvider,
 ) HTTPHandler {
 	return &implHTTPHandler{
 		chatService:         chatService,
@@ -41,17 +75,37 @@ func NewHTTPHandler(
 		notificationService: notificationService,
 		authService:         authService,
 		roomService:         roomService,
+		userService:         userService,
+		guestService:        guestService,
+		botService:          botService,
+		webhookService:      webhookService,
+		incomingWebhooks:    incomingWebhooks,
+		commandService:      commandService,
+		pinService:          pinService,
+		scheduledMessages:   scheduledMessages,
+		retentionService:    retentionService,
+		pollService:         pollService,
+		forwardService:      forwardService,
+		draftService:        draftService,
 		userRepository:      userRepository,
+		guestMessageLimiter: guestMessageLimiter,
+		keyProvider:         keyProvider,
 	}
 }
 
 func (h *implHTTPHandler) RegisterRoutes(router *gin.Engine) {
+	// Public signing keys so other services can verify our access tokens
+	router.GET("/.well-known/jwks.json", h.getJWKS)
+
 	api := router.Group("/api")
 
 	// Public routes (no auth required)
 	{
 		// Public chats can be viewed by anyone
 		api.GET("/chats/public", h.getPublicChats)
+
+		// Incoming webhooks authenticate with the secret token in the URL
+		api.POST("/hooks/:token", h.postIncomingWebhook)
 	}
 
 	// Protected routes (require authentication)
@@ -64,11 +118,17 @@ func (h *implHTTPHandler) RegisterRoutes(router *gin.Engine) {
 			chats.POST("", h.createChat)
 			chats.GET("/:id", middleware.ChatMembershipMiddleware(h.chatService), h.getChat)
 			chats.GET("", h.getUserChats)
-			chats.POST("/:id/messages", middleware.ChatMembershipMiddleware(h.chatService), h.sendMessage)
+			chats.POST("/:id/messages", middleware.ChatMembershipMiddleware(h.chatService), middleware.GuestRateLimitMiddleware(h.guestMessageLimiter), h.sendMessage)
 			chats.GET("/:id/messages", middleware.ChatMembershipMiddleware(h.chatService), h.getMessages)
 			chats.POST("/:id/members", middleware.ChatMembershipMiddleware(h.chatService), h.addMember)
 			chats.DELETE("/:id/members/:userId", middleware.ChatMembershipMiddleware(h.chatService), h.removeMember)
 			chats.POST("/:id/join", h.joinPublicChat)
+			chats.GET("/:id/pins", middleware.ChatMembershipMiddleware(h.chatService), h.getPins)
+			chats.PUT("/:id/message-timer", middleware.ChatMembershipMiddleware(h.chatService), h.setMessageTimer)
+			chats.GET("/:id/draft", middleware.ChatMembershipMiddleware(h.chatService), h.getDraft)
+			chats.PUT("/:id/draft", middleware.ChatMembershipMiddleware(h.chatService), h.saveDraft)
+			chats.DELETE("/:id/draft", middleware.ChatMembershipMiddleware(h.chatService), h.deleteDraft)
+			chats.POST("/:id/polls", middleware.ChatMembershipMiddleware(h.chatService), middleware.GuestRateLimitMiddleware(h.guestMessageLimiter), h.createPoll)
 		}
 
 		// Message routes
@@ -79,16 +139,26 @@ func (h *implHTTPHandler) RegisterRoutes(router *gin.Engine) {
 			messages.POST("/:id/reactions", h.addReaction)
 			messages.GET("/:id/reactions", h.getReactions)
 			messages.DELETE("/reactions/:id", h.removeReaction)
+			messages.GET("/:id/thread", h.getThread)
+			messages.POST("/:id/thread/follow", h.followThread)
+			messages.DELETE("/:id/thread/follow", h.unfollowThread)
+			messages.POST("/:id/pin", h.pinMessage)
+			messages.DELETE("/:id/pin", h.unpinMessage)
+			messages.GET("/:id/poll", h.getPoll)
+			messages.POST("/:id/poll/votes", h.votePoll)
+			messages.DELETE("/:id/poll/votes/:optionId", h.unvotePoll)
+			messages.POST("/:id/poll/close", h.closePoll)
+			messages.POST("/:id/forward", middleware.GuestRateLimitMiddleware(h.guestMessageLimiter), h.forwardMessage)
 		}
 
 		// Invitation routes
 		invitations := authorized.Group("/invitations")
 		{
 			invitations.POST("/chat", h.createChatInvitation)
-			invitations.POST("/friend", h.createFriendInvitation)
-			invitations.POST("/friend/request", h.sendFriendRequest)
+			invitations.POST("/friend", middleware.RegisteredUserMiddleware(), h.createFriendInvitation)
+			invitations.POST("/friend/request", middleware.RegisteredUserMiddleware(), h.sendFriendRequest)
 			invitations.POST("/chat/:code/join", h.joinChatViaInvitation)
-			invitations.POST("/friend/:code/accept", h.acceptFriendInvitation)
+			invitations.POST("/friend/:code/accept", middleware.RegisteredUserMiddleware(), h.acceptFriendInvitation)
 			invitations.GET("/chat/:id", h.listChatInvitations)
 			invitations.GET("/friend", h.listFriendInvitations)
 		}
@@ -103,10 +173,22 @@ func (h *implHTTPHandler) RegisterRoutes(router *gin.Engine) {
 			notifications.POST("/:id/reject", h.rejectNotification)
 		}
 
+		// Unsent drafts of the current user across all chats
+		authorized.GET("/drafts", h.getDrafts)
+
+		// Messages mentioning the current user
+		authorized.GET("/mentions", h.getMentions)
+
 		// Friends routes
 		authorized.GET("/friends", h.getFriends)
+		authorized.GET("/friends/suggestions", h.getFriendSuggestions)
 
 		// User routes
+		authorized.GET("/users/search", h.searchUsers)
+		authorized.GET("/users/me", h.getCurrentUser)
+		authorized.PATCH("/users/me", h.updateProfile)
+		authorized.POST("/users/me/avatar", h.uploadAvatar)
+		authorized.PUT("/users/me/privacy", h.updatePrivacy)
 		authorized.GET("/users/:id", h.getUserByID)
 
 		// Online users route
@@ -117,6 +199,43 @@ func (h *implHTTPHandler) RegisterRoutes(router *gin.Engine) {
 
 		// Media upload route
 		authorized.POST("/upload", h.uploadMedia)
+
+		// Guest churn metrics, for operators only
+		authorized.GET("/metrics/guests", middleware.OperatorMiddleware(), h.getGuestMetrics)
+
+		// Bot accounts
+		bots := authorized.Group("/bots", middleware.RegisteredUserMiddleware())
+		{
+			bots.POST("", h.createBot)
+			bots.GET("", h.getBots)
+			bots.DELETE("/:id", h.deleteBot)
+		}
+
+		// Outgoing webhooks, managed by chat admins
+		authorized.POST("/chats/:id/webhooks", middleware.RegisteredUserMiddleware(), h.createWebhook)
+		authorized.GET("/chats/:id/webhooks", middleware.RegisteredUserMiddleware(), h.getWebhooks)
+		authorized.DELETE("/webhooks/:id", middleware.RegisteredUserMiddleware(), h.deleteWebhook)
+		authorized.GET("/webhooks/:id/deliveries", middleware.RegisteredUserMiddleware(), h.getWebhookDeliveries)
+		authorized.POST("/chats/:id/incoming-webhooks", middleware.RegisteredUserMiddleware(), h.createIncomingWebhook)
+		authorized.GET("/chats/:id/incoming-webhooks", middleware.RegisteredUserMiddleware(), h.getIncomingWebhooks)
+		authorized.DELETE("/incoming-webhooks/:id", middleware.RegisteredUserMiddleware(), h.deleteIncomingWebhook)
+
+		// Messages sent later by the scheduler
+		authorized.POST("/chats/:id/scheduled-messages", middleware.RegisteredUserMiddleware(), middleware.ChatMembershipMiddleware(h.chatService), h.scheduleMessage)
+		scheduled := authorized.Group("/scheduled-messages", middleware.RegisteredUserMiddleware())
+		{
+			scheduled.GET("", h.getScheduledMessages)
+			scheduled.PATCH("/:id", h.rescheduleMessage)
+			scheduled.DELETE("/:id", h.cancelScheduledMessage)
+		}
+
+		// API tokens for bots and scripts
+		tokens := authorized.Group("/tokens", middleware.RegisteredUserMiddleware())
+		{
+			tokens.POST("", h.createAPIToken)
+			tokens.GET("", h.getAPITokens)
+			tokens.DELETE("/:id", h.revokeAPIToken)
+		}
 	}
 }
 
@@ -200,6 +319,7 @@ func (h *implHTTPHandler) sendMessage(c *gin.Context) {
 		FileName  string `json:"file_name"`
 		FileSize  int64  `json:"file_size"`
 		ReplyToID *int64 `json:"reply_to_id"`
+		ThreadID  *int64 `json:"thread_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -209,6 +329,12 @@ func (h *implHTTPHandler) sendMessage(c *gin.Context) {
 
 	userID := c.GetInt64("user_id")
 
+	// Commands answer the invoker only; anything they post is broadcast by the command service
+	if req.Type == string(entity.Text) && h.commandService.IsCommand(req.Content) {
+		c.JSON(http.StatusOK, h.commandService.Execute(userID, chatID, req.Content))
+		return
+	}
+
 	message := &entity.Message{
 		ChatID:    chatID,
 		Content:   req.Content,
@@ -217,14 +343,35 @@ func (h *implHTTPHandler) sendMessage(c *gin.Context) {
 		FileName:  req.FileName,
 		FileSize:  req.FileSize,
 		ReplyToID: req.ReplyToID,
+		ThreadID:  req.ThreadID,
 		CreatedBy: userID,
 	}
 
 	if err := h.chatService.SendMessage(message); err != nil {
+		if errors.Is(err, service.ErrMutedInChat) || errors.Is(err, service.ErrNotChatMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrThreadNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrContentTooLong) || errors.Is(err, service.ErrMalformedContent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Members connected over WebSocket see the message just like one sent there
+	h.broadcastEvent(chatID, service.NewMessageEvent(message), 0)
+
+	// Thread replies are written outside the chat's composer and leave its draft alone
+	if message.ThreadID == nil {
+		h.draftService.ClearDraft(userID, chatID)
+	}
+
 	c.JSON(http.StatusCreated, message)
 }
 
@@ -233,7 +380,24 @@ func (h *implHTTPHandler) getMessages(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
-	messages, err := h.chatService.GetMessages(chatID, limit, offset)
+	messages, err := h.chatService.GetMessages(c.GetInt64("user_id"), chatID, limit, offset)
+	if err != nil {
+		if errors.Is(err, service.ErrNotChatMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+func (h *implHTTPHandler) getMentions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	messages, err := h.chatService.GetMentions(c.GetInt64("user_id"), limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -254,7 +418,15 @@ func (h *implHTTPHandler) editMessage(c *gin.Context) {
 		return
 	}
 
-	if err := h.chatService.EditMessage(messageID, req.Content); err != nil {
+	if _, err := h.chatService.EditMessage(c.GetInt64("user_id"), messageID, req.Content); err != nil {
+		if errors.Is(err, service.ErrNotMessageAuthor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrContentTooLong) || errors.Is(err, service.ErrMalformedContent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -265,7 +437,11 @@ func (h *implHTTPHandler) editMessage(c *gin.Context) {
 func (h *implHTTPHandler) deleteMessage(c *gin.Context) {
 	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 
-	if err := h.chatService.DeleteMessage(messageID); err != nil {
+	if err := h.chatService.DeleteMessage(c.GetInt64("user_id"), messageID); err != nil {
+		if errors.Is(err, service.ErrNotMessageAuthor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -414,6 +590,331 @@ func (h *implHTTPHandler) getReactions(c *gin.Context) {
 	c.JSON(http.StatusOK, reactions)
 }
 
+// Thread handlers
+func (h *implHTTPHandler) getThread(c *gin.Context) {
+	rootID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	thread, err := h.chatService.GetThread(c.GetInt64("user_id"), rootID, limit, offset)
+	if err != nil {
+		c.JSON(threadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, thread)
+}
+
+func (h *implHTTPHandler) followThread(c *gin.Context) {
+	rootID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err := h.chatService.FollowThread(c.GetInt64("user_id"), rootID); err != nil {
+		c.JSON(threadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Following thread"})
+}
+
+func (h *implHTTPHandler) unfollowThread(c *gin.Context) {
+	rootID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err := h.chatService.UnfollowThread(c.GetInt64("user_id"), rootID); err != nil {
+		c.JSON(threadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed thread"})
+}
+
+func threadErrorStatus(err error) int {
+	if errors.Is(err, service.ErrThreadNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func (h *implHTTPHandler) setMessageTimer(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req struct {
+		Timer string `json:"timer" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chat, err := h.retentionService.SetMessageTimer(c.GetInt64("user_id"), chatID, req.Timer)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrRetentionNotAllowed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, chat)
+}
+
+func (h *implHTTPHandler) forwardMessage(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req struct {
+		ChatIDs []int64 `json:"chat_ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	messages, err := h.forwardService.ForwardMessage(c.GetInt64("user_id"), messageID, req.ChatIDs)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrForwardNotAllowed), errors.Is(err, service.ErrMutedInChat):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "forwarded": messages})
+		return
+	}
+
+	c.JSON(http.StatusCreated, messages)
+}
+
+// Draft handlers
+func (h *implHTTPHandler) getDrafts(c *gin.Context) {
+	drafts, err := h.draftService.GetDrafts(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, drafts)
+}
+
+func (h *implHTTPHandler) getDraft(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	draft, err := h.draftService.GetDraft(c.GetInt64("user_id"), chatID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if draft == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No draft in this chat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+func (h *implHTTPHandler) saveDraft(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req struct {
+		Content   string `json:"content"`
+		ReplyToID *int64 `json:"reply_to_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, err := h.draftService.SaveDraft(c.GetInt64("user_id"), chatID, c.GetString("session_id"), req.Content, req.ReplyToID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if draft == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+func (h *implHTTPHandler) deleteDraft(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err := h.draftService.DeleteDraft(c.GetInt64("user_id"), chatID, c.GetString("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Poll handlers
+func (h *implHTTPHandler) createPoll(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req struct {
+		Question       string     `json:"question" binding:"required"`
+		Options        []string   `json:"options" binding:"required"`
+		MultipleChoice bool       `json:"multiple_choice"`
+		Anonymous      bool       `json:"anonymous"`
+		ClosesAt       *time.Time `json:"closes_at"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := h.pollService.CreatePoll(c.GetInt64("user_id"), chatID, &service.PollInput{
+		Question:       req.Question,
+		Options:        req.Options,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+		ClosesAt:       req.ClosesAt,
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrMutedInChat) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.broadcastEvent(chatID, service.NewMessageEvent(message), 0)
+	c.JSON(http.StatusCreated, message)
+}
+
+func (h *implHTTPHandler) getPoll(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	message, err := h.pollService.GetPoll(c.GetInt64("user_id"), messageID)
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func (h *implHTTPHandler) votePoll(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req struct {
+		OptionID *int `json:"option_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := h.pollService.Vote(c.GetInt64("user_id"), messageID, *req.OptionID)
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func (h *implHTTPHandler) unvotePoll(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	optionID, err := strconv.Atoi(c.Param("optionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid option ID"})
+		return
+	}
+
+	message, err := h.pollService.Unvote(c.GetInt64("user_id"), messageID, optionID)
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func (h *implHTTPHandler) closePoll(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	message, err := h.pollService.ClosePoll(c.GetInt64("user_id"), messageID)
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func pollErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrPollNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPollClosed):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrPollNotAllowed):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// Pin handlers
+func (h *implHTTPHandler) getPins(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	pins, err := h.pinService.GetPins(c.GetInt64("user_id"), chatID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotChatMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pins)
+}
+
+func (h *implHTTPHandler) pinMessage(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	message, err := h.pinService.PinMessage(c.GetInt64("user_id"), messageID)
+	if err != nil {
+		c.JSON(pinErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func (h *implHTTPHandler) unpinMessage(c *gin.Context) {
+	messageID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	message, err := h.pinService.UnpinMessage(c.GetInt64("user_id"), messageID)
+	if err != nil {
+		c.JSON(pinErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func pinErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPinNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrPinLimitReached):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
 func (h *implHTTPHandler) removeReaction(c *gin.Context) {
 	reactionID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 	userID := c.GetInt64("user_id")
@@ -674,25 +1175,401 @@ func (h *implHTTPHandler) getFriends(c *gin.Context) {
 	c.JSON(http.StatusOK, friends)
 }
 
-func (h *implHTTPHandler) getOnlineUsers(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+func (h *implHTTPHandler) getFriendSuggestions(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	suggestions, err := h.invitationService.GetFriendSuggestions(userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get all online user IDs
-	onlineUserIDs := h.roomService.GetOnlineUsers()
+	c.JSON(http.StatusOK, suggestions)
+}
 
-	// Get user's chats to find all members
-	userChats, err := h.chatService.GetUserChats(userID.(int64))
+func (h *implHTTPHandler) getJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keyProvider.JWKS())
+}
+
+func (h *implHTTPHandler) getGuestMetrics(c *gin.Context) {
+	stats, err := h.guestService.GetStats()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get guest metrics"})
 		return
 	}
 
-	// Build a set of user IDs that share chats with the current user
-	visibleUserIDs := make(map[int64]bool)
+	c.JSON(http.StatusOK, stats)
+}
+
+// Bot handlers
+func (h *implHTTPHandler) createBot(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required,min=3,max=50"`
+		Name     string `json:"name" binding:"required,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bot, err := h.botService.CreateBot(c.GetInt64("user_id"), req.Username, req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, bot.PublicProfile())
+}
+
+func (h *implHTTPHandler) getBots(c *gin.Context) {
+	bots, err := h.botService.GetBots(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	profiles := make([]*entity.PublicProfile, 0, len(bots))
+	for _, bot := range bots {
+		profiles = append(profiles, bot.PublicProfile())
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+func (h *implHTTPHandler) deleteBot(c *gin.Context) {
+	botID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bot ID"})
+		return
+	}
+
+	if err := h.botService.DeleteBot(c.GetInt64("user_id"), botID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bot deleted"})
+}
+
+func (h *implHTTPHandler) createAPIToken(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name" binding:"required,max=100"`
+		UserID    int64      `json:"user_id"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Without a user_id the token acts as the caller
+	userID := c.GetInt64("user_id")
+	if req.UserID == 0 {
+		req.UserID = userID
+	}
+
+	token, plaintext, err := h.botService.CreateAPIToken(userID, req.UserID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":     plaintext,
+		"api_token": token,
+	})
+}
+
+func (h *implHTTPHandler) getAPITokens(c *gin.Context) {
+	tokens, err := h.botService.GetAPITokens(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *implHTTPHandler) revokeAPIToken(c *gin.Context) {
+	if err := h.botService.RevokeAPIToken(c.GetInt64("user_id"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// Webhook handlers
+func (h *implHTTPHandler) createWebhook(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, secret, err := h.webhookService.CreateWebhook(c.GetInt64("user_id"), chatID, req.URL, req.Events)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+func (h *implHTTPHandler) getWebhooks(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return
+	}
+
+	webhooks, err := h.webhookService.GetWebhooks(c.GetInt64("user_id"), chatID)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (h *implHTTPHandler) deleteWebhook(c *gin.Context) {
+	if err := h.webhookService.DeleteWebhook(c.GetInt64("user_id"), c.Param("id")); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+func (h *implHTTPHandler) getWebhookDeliveries(c *gin.Context) {
+	deliveries, err := h.webhookService.GetDeliveries(c.GetInt64("user_id"), c.Param("id"))
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (h *implHTTPHandler) createIncomingWebhook(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, token, err := h.incomingWebhooks.CreateIncomingWebhook(c.GetInt64("user_id"), chatID, req.Name)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"token":   token,
+		"path":    "/api/hooks/" + token,
+	})
+}
+
+func (h *implHTTPHandler) getIncomingWebhooks(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return
+	}
+
+	webhooks, err := h.incomingWebhooks.GetIncomingWebhooks(c.GetInt64("user_id"), chatID)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (h *implHTTPHandler) deleteIncomingWebhook(c *gin.Context) {
+	if err := h.incomingWebhooks.DeleteIncomingWebhook(c.GetInt64("user_id"), c.Param("id")); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+func (h *implHTTPHandler) postIncomingWebhook(c *gin.Context) {
+	var payload entity.IncomingWebhookPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := h.incomingWebhooks.Post(c.Param("token"), &payload)
+	if err != nil {
+		c.JSON(incomingWebhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, message)
+}
+
+func incomingWebhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhookToken):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrContentTooLong), errors.Is(err, service.ErrMalformedContent):
+		return http.StatusBadRequest
+	}
+	// Everything else is a payload the service refused
+	return http.StatusBadRequest
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, service.ErrNotChatAdmin) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// Scheduled message handlers
+func (h *implHTTPHandler) scheduleMessage(c *gin.Context) {
+	chatID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req struct {
+		Content   string    `json:"content"`
+		Type      string    `json:"type"`
+		MediaURL  string    `json:"media_url"`
+		FileName  string    `json:"file_name"`
+		FileSize  int64     `json:"file_size"`
+		ReplyToID *int64    `json:"reply_to_id"`
+		ThreadID  *int64    `json:"thread_id"`
+		SendAt    time.Time `json:"send_at" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduled, err := h.scheduledMessages.Schedule(c.GetInt64("user_id"), chatID, &service.ScheduleInput{
+		Content:   req.Content,
+		Type:      entity.MessageType(req.Type),
+		MediaURL:  req.MediaURL,
+		FileName:  req.FileName,
+		FileSize:  req.FileSize,
+		ReplyToID: req.ReplyToID,
+		ThreadID:  req.ThreadID,
+		SendAt:    req.SendAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduled)
+}
+
+func (h *implHTTPHandler) getScheduledMessages(c *gin.Context) {
+	var chatID *int64
+	if raw := c.Query("chat_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+			return
+		}
+		chatID = &id
+	}
+
+	scheduled, err := h.scheduledMessages.GetScheduled(c.GetInt64("user_id"), chatID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+func (h *implHTTPHandler) rescheduleMessage(c *gin.Context) {
+	var req struct {
+		Content *string    `json:"content"`
+		SendAt  *time.Time `json:"send_at"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduled, err := h.scheduledMessages.Reschedule(c.GetInt64("user_id"), c.Param("id"), req.Content, req.SendAt)
+	if err != nil {
+		c.JSON(scheduledErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+func (h *implHTTPHandler) cancelScheduledMessage(c *gin.Context) {
+	if err := h.scheduledMessages.Cancel(c.GetInt64("user_id"), c.Param("id")); err != nil {
+		c.JSON(scheduledErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled message canceled"})
+}
+
+func scheduledErrorStatus(err error) int {
+	if errors.Is(err, service.ErrScheduledMessageNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func (h *implHTTPHandler) getOnlineUsers(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Get all online user IDs
+	onlineUserIDs := h.roomService.GetOnlineUsers()
+
+	// Get user's chats to find all members
+	userChats, err := h.chatService.GetUserChats(userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Build a set of user IDs that share chats with the current user
+	visibleUserIDs := make(map[int64]bool)
 	for _, chat := range userChats {
 		members, err := h.chatService.GetMembers(chat.ID)
 		if err != nil {
@@ -832,13 +1709,121 @@ func (h *implHTTPHandler) getUserByID(c *gin.Context) {
 	}
 
 	// Return user data (exclude sensitive information)
-	c.JSON(http.StatusOK, gin.H{
-		"id":         user.ID.Hex(),
-		"numeric_id": user.NumericID,
-		"username":   user.Username,
-		"name":       user.Name,
-		"is_guest":   user.IsGuest,
+	c.JSON(http.StatusOK, user.PublicProfile())
+}
+
+func (h *implHTTPHandler) getCurrentUser(c *gin.Context) {
+	user, err := h.userService.GetUser(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *implHTTPHandler) updateProfile(c *gin.Context) {
+	var req struct {
+		Name          *string `json:"name" binding:"omitempty,min=1,max=100"`
+		Email         *string `json:"email" binding:"omitempty,email"`
+		StatusMessage *string `json:"status_message" binding:"omitempty,max=140"`
+		Discoverable  *bool   `json:"discoverable"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(c.GetInt64("user_id"), service.ProfileUpdate{
+		Name:          req.Name,
+		Email:         req.Email,
+		StatusMessage: req.StatusMessage,
+		Discoverable:  req.Discoverable,
 	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *implHTTPHandler) uploadAvatar(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+
+	if file.Size > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be 5MB or smaller"})
+		return
+	}
+
+	ext, err := detectImageExtension(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "avatar_" + strconv.FormatInt(userID, 10) + "_" + strconv.FormatInt(time.Now().Unix(), 10) + ext
+	url, err := h.saveUpload(c, file, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	user, err := h.userService.SetAvatar(userID, url)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *implHTTPHandler) searchUsers(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	includeGuests := c.Query("include_guests") == "true"
+
+	users, err := h.userService.SearchUsers(userID, c.Query("q"), includeGuests, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Return user data (exclude sensitive information)
+	results := make([]*entity.PublicProfile, 0, len(users))
+	for _, user := range users {
+		results = append(results, user.PublicProfile())
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+func (h *implHTTPHandler) updatePrivacy(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+
+	var req struct {
+		Discoverable *bool `json:"discoverable" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.userService.UpdateProfile(userID, service.ProfileUpdate{Discoverable: req.Discoverable}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Privacy settings updated"})
 }
 
 // Media upload handler
@@ -850,22 +1835,66 @@ func (h *implHTTPHandler) uploadMedia(c *gin.Context) {
 	}
 
 	// Save file to uploads directory
-	filename := strconv.FormatInt(time.Now().Unix(), 10) + "_" + file.Filename
-	filepath := "./uploads/" + filename
+	filename := strconv.FormatInt(time.Now().UnixNano(), 10) + "_" + filepath.Base(file.Filename)
+	url, err := h.saveUpload(c, file, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
 
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
+	// Only messages from the uploader can later claim the file, and expiry only removes files it owns
+	if err := h.chatService.RegisterUpload(c.GetInt64("user_id"), filename); err != nil {
+		os.Remove("./uploads/" + filename)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 		return
 	}
 
 	// Return the file URL with metadata
 	c.JSON(http.StatusOK, gin.H{
-		"url":       "/uploads/" + filename,
+		"url":       url,
 		"filename":  file.Filename,
 		"file_size": file.Size,
 	})
 }
 
+const maxAvatarSize = 5 << 20
+
+var allowedImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// saveUpload stores an uploaded file in the uploads directory and returns its public URL
+func (h *implHTTPHandler) saveUpload(c *gin.Context, file *multipart.FileHeader, filename string) (string, error) {
+	if err := c.SaveUploadedFile(file, "./uploads/"+filename); err != nil {
+		return "", err
+	}
+
+	return "/uploads/" + filename, nil
+}
+
+// detectImageExtension sniffs the file content rather than trusting the client-supplied name or header
+func detectImageExtension(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	contentType := strings.Split(http.DetectContentType(head[:n]), ";")[0]
+
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type: %s", contentType)
+	}
+
+	return ext, nil
+}
+
 // Helper method to broadcast events to chat members
 func (h *implHTTPHandler) broadcastEvent(chatID int64, event entity.Event, excludeUserID int64) {
 	eventJSON, err := json.Marshal(event)
@@ -2,17 +2,21 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/middleware"
 	"github.com/rufflogix/computer-network-project/internal/service"
 )
 
 type WSHandler interface {
-	HandleWS(http.ResponseWriter, *http.Request)
+	HandleWS(c *gin.Context)
 }
 
 type implWSHandler struct {
@@ -20,6 +24,10 @@ type implWSHandler struct {
 	roomService         service.RoomService
 	notificationService service.NotificationService
 	invitationService   service.InvitationService
+	commandService      service.CommandService
+	pollService         service.PollService
+	draftService        service.DraftService
+	guestMessageLimiter *middleware.RateLimiter
 	globalChatID        int64
 }
 
@@ -28,6 +36,10 @@ func NewWSHandler(
 	roomService service.RoomService,
 	notificationService service.NotificationService,
 	invitationService service.InvitationService,
+	commandService service.CommandService,
+	pollService service.PollService,
+	draftService service.DraftService,
+	guestMessageLimiter *middleware.RateLimiter,
 	globalChatID int64,
 ) WSHandler {
 	return &implWSHandler{
@@ -35,6 +47,10 @@ func NewWSHandler(
 		roomService:         roomService,
 		notificationService: notificationService,
 		invitationService:   invitationService,
+		commandService:      commandService,
+		pollService:         pollService,
+		draftService:        draftService,
+		guestMessageLimiter: guestMessageLimiter,
 		globalChatID:        globalChatID,
 	}
 }
@@ -47,7 +63,13 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-func (h *implWSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
+func (h *implWSHandler) HandleWS(c *gin.Context) {
+	w, r := c.Writer, c.Request
+	// WebSocketAuthMiddleware guarantees an authenticated user; the socket acts as that user only
+	userID := c.GetInt64("user_id")
+	sessionID := c.GetString("session_id")
+	isGuest := c.GetBool("is_guest")
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
@@ -56,12 +78,32 @@ func (h *implWSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	var userID int64
 	log.Printf("WebSocket connection established from %s", r.RemoteAddr)
 
 	// Set read deadline to prevent hanging connections
 	conn.SetReadDeadline(time.Time{})
 
+	// Tie the connection to the auth session so revoking it disconnects this socket
+	h.roomService.AddClient(conn, userID, sessionID)
+	log.Printf("User %d connected via WebSocket", userID)
+
+	// Send initial online status of all friends to the newly connected user
+	h.sendInitialFriendsOnlineStatus(userID)
+
+	// Broadcast online status to friends
+	h.broadcastUserStatus(userID, true)
+
+	// Send the complete online users list to the newly connected user
+	h.sendOnlineUsersList(userID)
+
+	// Automatically join the global chat
+	if h.globalChatID != 0 {
+		isNewJoin := h.roomService.JoinRoom(userID, h.globalChatID)
+		if isNewJoin {
+			log.Printf("User %d automatically joined global chat %d", userID, h.globalChatID)
+		}
+	}
+
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
@@ -77,33 +119,10 @@ func (h *implWSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Set userID from the first event and register client
-		if userID == 0 && event.CreatedBy != 0 {
-			userID = event.CreatedBy
-			h.roomService.AddClient(conn, userID)
-			log.Printf("User %d connected via WebSocket", userID)
-
-			// Send initial online status of all friends to the newly connected user
-			h.sendInitialFriendsOnlineStatus(userID)
-
-			// Broadcast online status to friends
-			h.broadcastUserStatus(userID, true)
-
-			// Send the complete online users list to the newly connected user
-			h.sendOnlineUsersList(userID)
-
-			// Automatically join the global chat
-			if h.globalChatID != 0 {
-				isNewJoin := h.roomService.JoinRoom(userID, h.globalChatID)
-				if isNewJoin {
-					log.Printf("User %d automatically joined global chat %d", userID, h.globalChatID)
-				}
-			}
-		}
-
-		// Update userID if changed
-		if event.CreatedBy != 0 {
-			userID = event.CreatedBy
+		// Events must be sent as the authenticated user, never on behalf of someone else
+		if event.CreatedBy != userID {
+			log.Printf("Rejected %s event from user %d claiming to be user %d", event.Type, userID, event.CreatedBy)
+			continue
 		}
 
 		switch event.Type {
@@ -113,13 +132,25 @@ func (h *implWSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 			continue
 
 		case entity.JOIN:
-			h.handleJoin(conn, &event)
+			h.handleJoin(&event)
 
 		case entity.LEAVE:
 			h.handleLeave(&event)
 
 		case entity.SEND_MESSAGE:
-			h.handleSendMessage(&event)
+			if isGuest {
+				if allowed, retryAfter := h.guestMessageLimiter.Allow(fmt.Sprintf("user:%d", userID)); !allowed {
+					h.roomService.SendToUser(userID, entity.Event{
+						Type: entity.RATE_LIMITED,
+						Data: map[string]interface{}{
+							"error":       "Too many messages, slow down or register an account",
+							"retry_after": retryAfter.Seconds(),
+						},
+					})
+					continue
+				}
+			}
+			h.handleSendMessage(userID, &event)
 
 		case entity.EDIT_MESSAGE:
 			h.handleEditMessage(&event)
@@ -133,6 +164,9 @@ func (h *implWSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 		case entity.REMOVE_REACTION:
 			h.handleRemoveReaction(&event)
 
+		case entity.POLL_VOTE, entity.POLL_UNVOTE:
+			h.handlePollVote(userID, &event)
+
 		case entity.TYPING:
 			h.handleTyping(&event)
 
@@ -144,22 +178,19 @@ func (h *implWSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Clean up on disconnect
-	if userID != 0 {
-		// Broadcast offline status to friends
+	// Clean up on disconnect; the user stays online while another of their connections is open
+	if h.roomService.RemoveClient(userID, conn) {
 		h.broadcastUserStatus(userID, false)
-		h.roomService.RemoveClient(userID)
 	}
 }
 
-func (h *implWSHandler) handleJoin(conn *websocket.Conn, event *entity.Event) {
+func (h *implWSHandler) handleJoin(event *entity.Event) {
 	chatID, ok := event.Data["chat_id"].(float64)
 	if !ok {
 		log.Printf("Invalid chat_id in join event")
 		return
 	}
 
-	h.roomService.AddClient(conn, event.CreatedBy)
 	isNewJoin := h.roomService.JoinRoom(event.CreatedBy, int64(chatID))
 
 	if isNewJoin {
@@ -176,7 +207,8 @@ func (h *implWSHandler) handleLeave(event *entity.Event) {
 	h.roomService.LeaveRoom(event.CreatedBy, int64(chatID))
 }
 
-func (h *implWSHandler) handleSendMessage(event *entity.Event) {
+// handleSendMessage posts as userID, the authenticated user of the connection
+func (h *implWSHandler) handleSendMessage(userID int64, event *entity.Event) {
 	chatID, ok := event.Data["chat_id"].(float64)
 	if !ok {
 		return
@@ -188,12 +220,24 @@ func (h *implWSHandler) handleSendMessage(event *entity.Event) {
 	fileName, _ := event.Data["file_name"].(string)
 	fileSize, _ := event.Data["file_size"].(float64)
 
+	// Commands reply through SendToUser and broadcast whatever they post themselves
+	if (msgType == "" || msgType == string(entity.Text)) && h.commandService.IsCommand(content) {
+		h.commandService.Execute(userID, int64(chatID), content)
+		return
+	}
+
 	var replyToID *int64
 	if replyTo, ok := event.Data["reply_to_id"].(float64); ok {
 		replyID := int64(replyTo)
 		replyToID = &replyID
 	}
 
+	var threadID *int64
+	if thread, ok := event.Data["thread_id"].(float64); ok {
+		rootID := int64(thread)
+		threadID = &rootID
+	}
+
 	message := &entity.Message{
 		ChatID:    int64(chatID),
 		Content:   content,
@@ -202,20 +246,29 @@ func (h *implWSHandler) handleSendMessage(event *entity.Event) {
 		FileName:  fileName,
 		FileSize:  int64(fileSize),
 		ReplyToID: replyToID,
-		CreatedBy: event.CreatedBy,
+		ThreadID:  threadID,
+		CreatedBy: userID,
 	}
 
 	if err := h.chatService.SendMessage(message); err != nil {
+		if errors.Is(err, service.ErrMutedInChat) || errors.Is(err, service.ErrNotChatMember) || errors.Is(err, service.ErrContentTooLong) || errors.Is(err, service.ErrMalformedContent) {
+			h.roomService.SendToUser(userID, entity.Event{
+				Type: entity.MESSAGE_REJECTED,
+				Data: map[string]interface{}{"chat_id": chatID, "error": err.Error()},
+			})
+			return
+		}
 		log.Printf("Error sending message: %v", err)
 		return
 	}
 
 	// Broadcast message to all chat members
-	h.broadcastEvent(int64(chatID), entity.Event{
-		Type:      entity.SEND_MESSAGE,
-		Data:      map[string]interface{}{"message": message},
-		CreatedBy: event.CreatedBy,
-	}, 0)
+	h.broadcastEvent(int64(chatID), service.NewMessageEvent(message), 0)
+
+	// Thread replies are written outside the chat's composer and leave its draft alone
+	if threadID == nil {
+		h.draftService.ClearDraft(userID, int64(chatID))
+	}
 }
 
 func (h *implWSHandler) handleEditMessage(event *entity.Event) {
@@ -230,7 +283,15 @@ func (h *implWSHandler) handleEditMessage(event *entity.Event) {
 		return
 	}
 
-	if err := h.chatService.EditMessage(int64(messageID), content); err != nil {
+	message, err := h.chatService.EditMessage(event.CreatedBy, int64(messageID), content)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMessageAuthor) || errors.Is(err, service.ErrContentTooLong) || errors.Is(err, service.ErrMalformedContent) {
+			h.roomService.SendToUser(event.CreatedBy, entity.Event{
+				Type: entity.MESSAGE_REJECTED,
+				Data: map[string]interface{}{"chat_id": chatID, "message_id": messageID, "error": err.Error()},
+			})
+			return
+		}
 		log.Printf("Error editing message: %v", err)
 		return
 	}
@@ -239,8 +300,9 @@ func (h *implWSHandler) handleEditMessage(event *entity.Event) {
 	h.broadcastEvent(int64(chatID), entity.Event{
 		Type: entity.EDIT_MESSAGE,
 		Data: map[string]interface{}{
-			"message_id": messageID,
-			"content":    content,
+			"message_id":   messageID,
+			"content":      content,
+			"content_html": message.ContentHTML,
 		},
 		CreatedBy: event.CreatedBy,
 	}, 0)
@@ -254,15 +316,27 @@ func (h *implWSHandler) handleDeleteMessage(event *entity.Event) {
 
 	chatID, _ := event.Data["chat_id"].(float64)
 
-	if err := h.chatService.DeleteMessage(int64(messageID)); err != nil {
+	message, err := h.chatService.GetMessage(int64(messageID))
+	if err != nil {
 		log.Printf("Error deleting message: %v", err)
 		return
 	}
 
+	if err := h.chatService.DeleteMessage(event.CreatedBy, int64(messageID)); err != nil {
+		log.Printf("Error deleting message: %v", err)
+		return
+	}
+
+	// Thread replies carry their root so clients can adjust the reply count
+	data := map[string]interface{}{"message_id": messageID}
+	if message.ThreadID != nil {
+		data["thread_id"] = *message.ThreadID
+	}
+
 	// Broadcast delete event
 	h.broadcastEvent(int64(chatID), entity.Event{
 		Type:      entity.DELETE_MESSAGE,
-		Data:      map[string]interface{}{"message_id": messageID},
+		Data:      data,
 		CreatedBy: event.CreatedBy,
 	}, 0)
 }
@@ -338,6 +412,28 @@ func (h *implWSHandler) handleRemoveReaction(event *entity.Event) {
 	}, 0)
 }
 
+// handlePollVote records a vote; the poll service broadcasts the new results to the chat
+func (h *implWSHandler) handlePollVote(userID int64, event *entity.Event) {
+	messageID, ok := event.Data["message_id"].(float64)
+	if !ok {
+		return
+	}
+	optionID, ok := event.Data["option_id"].(float64)
+	if !ok {
+		return
+	}
+
+	var err error
+	if event.Type == entity.POLL_VOTE {
+		_, err = h.pollService.Vote(userID, int64(messageID), int(optionID))
+	} else {
+		_, err = h.pollService.Unvote(userID, int64(messageID), int(optionID))
+	}
+	if err != nil {
+		log.Printf("Error recording poll vote: %v", err)
+	}
+}
+
 func (h *implWSHandler) handleTyping(event *entity.Event) {
 	chatID, ok := event.Data["chat_id"].(float64)
 	if !ok {
@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APITokenPrefix marks long-lived API tokens so they can be told apart from session JWTs
+const APITokenPrefix = "cnp_"
+
+// API token scopes
+const (
+	ScopeChatsRead     = "chats:read"
+	ScopeChatsJoin     = "chats:join"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeWebSocket     = "ws"
+)
+
+var APITokenScopes = []string{ScopeChatsRead, ScopeChatsJoin, ScopeMessagesRead, ScopeMessagesWrite, ScopeWebSocket}
+
+// APIToken is a long-lived credential for scripts and bots. Only the hash is stored.
+type APIToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     int64              `bson:"user_id" json:"user_id"`       // Account the token acts as, a bot or the creator
+	CreatedBy  int64              `bson:"created_by" json:"created_by"` // Human who manages the token
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"` // First characters, to recognise the token in lists
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuthTokenPurpose string
+
+const (
+	PasswordResetToken      AuthTokenPurpose = "password_reset"
+	EmailVerificationToken  AuthTokenPurpose = "email_verification"
+	TwoFactorChallengeToken AuthTokenPurpose = "two_factor_challenge"
+)
+
+// AuthToken is a single-use token sent to the user out of band. Only the hash is stored.
+type AuthToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    int64              `bson:"user_id" json:"user_id"`
+	Purpose   AuthTokenPurpose   `bson:"purpose" json:"purpose"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	Email     string             `bson:"email,omitempty" json:"email,omitempty"` // Address the token was sent to
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -15,7 +15,9 @@ type Chat struct {
 	Type        ChatType  `bson:"type" json:"type"`
 	Name        string    `bson:"name" json:"name"`
 	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	Topic       string    `bson:"topic,omitempty" json:"topic,omitempty"` // Current discussion topic, set with /topic
 	IsPublic    bool      `bson:"is_public" json:"is_public"`
+	MessageTTL  int64     `bson:"message_ttl,omitempty" json:"message_ttl,omitempty"` // Seconds until new messages disappear, 0 keeps them
 	CreatedBy   int64     `bson:"created_by" json:"created_by"`
 	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
@@ -30,23 +32,69 @@ const (
 	Sticker MessageType = "sticker"
 	File    MessageType = "file"
 	System  MessageType = "system"
+	Action  MessageType = "action" // Written with /me, shown as "<author> <content>"
+	Poll    MessageType = "poll"   // Content is the question, the options and counts are in Message.Poll
 )
 
 type Message struct {
-	ID            int64       `bson:"id" json:"id"`
-	ChatID        int64       `bson:"chat_id" json:"chat_id"`
-	Content       string      `bson:"content" json:"content"`
-	Type          MessageType `bson:"type" json:"type"`
-	MediaURL      string      `bson:"media_url,omitempty" json:"media_url,omitempty"`
-	FileName      string      `bson:"file_name,omitempty" json:"file_name,omitempty"`
-	FileSize      int64       `bson:"file_size,omitempty" json:"file_size,omitempty"`
-	ReplyToID     *int64      `bson:"reply_to_id,omitempty" json:"reply_to_id,omitempty"`
-	ReplyTo       *Message    `bson:"-" json:"reply_to,omitempty"`
-	Reactions     []*Reaction `bson:"-" json:"reactions,omitempty"`
-	CreatedAt     time.Time   `bson:"created_at" json:"created_at"`
-	UpdatedAt     time.Time   `bson:"updated_at" json:"updated_at"`
-	CreatedBy     int64       `bson:"created_by" json:"created_by"`
-	CreatedByUser *User       `bson:"-" json:"created_by_user,omitempty"`
+	ID                int64          `bson:"id" json:"id"`
+	ChatID            int64          `bson:"chat_id" json:"chat_id"`
+	Content           string         `bson:"content" json:"content"`
+	ContentHTML       string         `bson:"content_html,omitempty" json:"content_html,omitempty"` // Sanitised rendering of the markdown in Content
+	Type              MessageType    `bson:"type" json:"type"`
+	MediaURL          string         `bson:"media_url,omitempty" json:"media_url,omitempty"`
+	FileName          string         `bson:"file_name,omitempty" json:"file_name,omitempty"`
+	FileSize          int64          `bson:"file_size,omitempty" json:"file_size,omitempty"`
+	ReplyToID         *int64         `bson:"reply_to_id,omitempty" json:"reply_to_id,omitempty"`
+	ReplyTo           *Message       `bson:"-" json:"reply_to,omitempty"`
+	ThreadID          *int64         `bson:"thread_id,omitempty" json:"thread_id,omitempty"`                   // Root message when this is a thread reply
+	Thread            *ThreadSummary `bson:"-" json:"thread,omitempty"`                                        // State of the root's thread, set on replies as they are sent
+	ThreadReplyCount  int            `bson:"thread_reply_count,omitempty" json:"thread_reply_count,omitempty"` // Thread metadata, kept on root messages
+	ThreadLastReplyAt *time.Time     `bson:"thread_last_reply_at,omitempty" json:"thread_last_reply_at,omitempty"`
+	ThreadLastReplyBy int64          `bson:"thread_last_reply_by,omitempty" json:"thread_last_reply_by,omitempty"`
+	Mentions          []int64        `bson:"mentions,omitempty" json:"mentions,omitempty"`                   // Users mentioned by @username, or every member for @everyone
+	MentionsEveryone  bool           `bson:"mentions_everyone,omitempty" json:"mentions_everyone,omitempty"` // Contains an @everyone written by a chat admin
+	ExpiresAt         *time.Time     `bson:"expires_at,omitempty" json:"expires_at,omitempty"`               // Removed by the retention sweeper after this time
+	PinnedAt          *time.Time     `bson:"pinned_at,omitempty" json:"pinned_at,omitempty"`                 // Set while the message is pinned in its chat
+	PinnedBy          int64          `bson:"pinned_by,omitempty" json:"pinned_by,omitempty"`
+	Reactions         []*Reaction    `bson:"-" json:"reactions,omitempty"`
+	CreatedAt         time.Time      `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time      `bson:"updated_at" json:"updated_at"`
+	CreatedBy         int64          `bson:"created_by" json:"created_by"`
+	CreatedByUser     *User          `bson:"-" json:"created_by_user,omitempty"`
+	SentByBot         bool           `bson:"sent_by_bot,omitempty" json:"sent_by_bot,omitempty"`   // Posted by a bot account, kept even if the bot is deleted
+	WebhookID         string         `bson:"webhook_id,omitempty" json:"webhook_id,omitempty"`     // Posted through an incoming webhook rather than by a user
+	DisplayName       string         `bson:"display_name,omitempty" json:"display_name,omitempty"` // Author name to show instead of a user, for webhook posts
+	Attachments       []*Attachment  `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	Poll              *MessagePoll   `bson:"poll,omitempty" json:"poll,omitempty"`
+	LinkPreviews      []*LinkPreview `bson:"link_previews,omitempty" json:"link_previews,omitempty"`   // Filled in after sending, announced with message_updated
+	ForwardedFrom     *ForwardedFrom `bson:"forwarded_from,omitempty" json:"forwarded_from,omitempty"` // Set on copies made by forwarding
+	AuthorDeleted     bool           `bson:"author_deleted,omitempty" json:"author_deleted,omitempty"` // Author account was removed and the message anonymised
+}
+
+// ForwardedFrom credits the original of a forwarded message; forwarding a forward keeps the original
+type ForwardedFrom struct {
+	MessageID  int64     `bson:"message_id" json:"message_id"`
+	ChatID     int64     `bson:"chat_id" json:"chat_id"`
+	AuthorID   int64     `bson:"author_id,omitempty" json:"author_id,omitempty"`
+	AuthorName string    `bson:"author_name,omitempty" json:"author_name,omitempty"`
+	SentAt     time.Time `bson:"sent_at" json:"sent_at"`
+}
+
+// ThreadSummary describes a thread as seen from its root message
+type ThreadSummary struct {
+	RootID      int64      `json:"root_id"`
+	ReplyCount  int        `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+	LastReplyBy int64      `json:"last_reply_by,omitempty"`
+}
+
+// Attachment is an extra file or link on a message, in addition to MediaURL
+type Attachment struct {
+	URL      string      `bson:"url" json:"url"`
+	Type     MessageType `bson:"type" json:"type"`
+	FileName string      `bson:"file_name,omitempty" json:"file_name,omitempty"`
+	FileSize int64       `bson:"file_size,omitempty" json:"file_size,omitempty"`
 }
 
 type ReactionType string
@@ -83,9 +131,10 @@ type ChatInvitation struct {
 }
 
 type ChatMember struct {
-	ID       int64     `bson:"id,omitempty" json:"id"`
-	ChatID   int64     `bson:"chat_id" json:"chat_id"`
-	UserID   int64     `bson:"user_id" json:"user_id"`
-	Role     string    `bson:"role" json:"role"` // admin, member
-	JoinedAt time.Time `bson:"joined_at" json:"joined_at"`
+	ID         int64      `bson:"id,omitempty" json:"id"`
+	ChatID     int64      `bson:"chat_id" json:"chat_id"`
+	UserID     int64      `bson:"user_id" json:"user_id"`
+	Role       string     `bson:"role" json:"role"` // admin, member
+	JoinedAt   time.Time  `bson:"joined_at" json:"joined_at"`
+	MutedUntil *time.Time `bson:"muted_until,omitempty" json:"muted_until,omitempty"` // Set by /mute, the member cannot post until then
 }
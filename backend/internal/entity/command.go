@@ -0,0 +1,10 @@
+package entity
+
+// CommandResult is the outcome of a slash command such as /topic or /kick
+type CommandResult struct {
+	ChatID   int64    `json:"chat_id"`
+	Command  string   `json:"command"`
+	Response string   `json:"response,omitempty"` // Ephemeral text, visible only to the user who ran the command
+	IsError  bool     `json:"is_error,omitempty"`
+	Message  *Message `json:"message,omitempty"` // Message the command posted to the chat, if any
+}
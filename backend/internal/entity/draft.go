@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// Draft is a user's unsent message in a chat, kept on the server so it follows them across devices
+type Draft struct {
+	UserID    int64     `bson:"user_id" json:"user_id"`
+	ChatID    int64     `bson:"chat_id" json:"chat_id"`
+	Content   string    `bson:"content" json:"content"`
+	ReplyToID *int64    `bson:"reply_to_id,omitempty" json:"reply_to_id,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -14,6 +14,29 @@ const (
 	NOTIFICATION    EventType = "notification"
 	FRIEND_INVITE   EventType = "friend_invite"
 	GROUP_INVITE    EventType = "group_invite"
+	USER_UPDATED    EventType = "user_updated"
+	SESSION_REVOKED EventType = "session_revoked"
+	RATE_LIMITED    EventType = "rate_limited"
+	// Ephemeral reply to a slash command, sent only to the user who ran it
+	COMMAND_RESPONSE EventType = "command_response"
+	// A message the server refused, e.g. because the sender is muted
+	MESSAGE_REJECTED EventType = "message_rejected"
+	// A reply posted inside a thread, carrying the root's updated reply summary
+	THREAD_REPLY     EventType = "thread_reply"
+	MESSAGE_PINNED   EventType = "message_pinned"
+	MESSAGE_UNPINNED EventType = "message_unpinned"
+	// A saved message gained data after it was sent, such as link previews
+	MESSAGE_UPDATED EventType = "message_updated"
+	// Disappearing messages that were removed, clients drop them from view
+	MESSAGES_EXPIRED EventType = "messages_expired"
+	// A user's draft changed or was cleared, sent to that user's connected clients
+	DRAFT_UPDATED EventType = "draft_updated"
+	// Votes sent by clients; results come back to the whole chat as poll_updated
+	POLL_VOTE   EventType = "poll_vote"
+	POLL_UNVOTE EventType = "poll_unvote"
+	// Live poll results after a vote, and the final results once a poll closes
+	POLL_UPDATED EventType = "poll_updated"
+	POLL_CLOSED  EventType = "poll_closed"
 )
 
 type Event struct {
@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Identity links a user to an account at an external OpenID Connect provider
+type Identity struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    int64              `bson:"user_id" json:"user_id"`
+	Provider  string             `bson:"provider" json:"provider"`
+	Subject   string             `bson:"subject" json:"-"` // Provider's stable user ID ("sub" claim)
+	Email     string             `bson:"email,omitempty" json:"email,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// OIDCLoginState remembers an authorization request until the provider redirects back
+type OIDCLoginState struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	StateHash    string             `bson:"state_hash"`
+	Provider     string             `bson:"provider"`
+	CodeVerifier string             `bson:"code_verifier"` // PKCE verifier, never leaves the server
+	Nonce        string             `bson:"nonce"`
+	LinkUserID   int64              `bson:"link_user_id,omitempty"` // Set when a signed-in user is linking a provider
+	ExpiresAt    time.Time          `bson:"expires_at"`
+	CreatedAt    time.Time          `bson:"created_at"`
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
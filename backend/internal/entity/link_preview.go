@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// LinkPreview is the OpenGraph or <title> metadata fetched for a URL posted in a message
+type LinkPreview struct {
+	URL         string `bson:"url" json:"url"`
+	Title       string `bson:"title,omitempty" json:"title,omitempty"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	ImageURL    string `bson:"image_url,omitempty" json:"image_url,omitempty"`
+	SiteName    string `bson:"site_name,omitempty" json:"site_name,omitempty"`
+}
+
+// CachedLinkPreview is a fetch result kept for reuse; failed fetches are cached too so a dead
+// link is not fetched again for every message that repeats it
+type CachedLinkPreview struct {
+	Preview   *LinkPreview `bson:"preview,omitempty"`
+	URL       string       `bson:"url"`
+	Failed    bool         `bson:"failed"`
+	FetchedAt time.Time    `bson:"fetched_at"`
+	ExpiresAt time.Time    `bson:"expires_at"`
+}
@@ -10,6 +10,7 @@ const (
 	GroupInvitation   NotificationType = "group_invitation"
 	MessageReaction   NotificationType = "message_reaction"
 	MessageReply      NotificationType = "message_reply"
+	MessageMention    NotificationType = "message_mention"
 	GroupMemberJoined NotificationType = "group_member_joined"
 )
 
@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// MessagePoll is the question and options of a message of type "poll"
+type MessagePoll struct {
+	Question       string        `bson:"question" json:"question"`
+	Options        []*PollOption `bson:"options" json:"options"`
+	MultipleChoice bool          `bson:"multiple_choice" json:"multiple_choice"`
+	Anonymous      bool          `bson:"anonymous" json:"anonymous"` // Voters are never revealed, only counts
+	ClosesAt       *time.Time    `bson:"closes_at,omitempty" json:"closes_at,omitempty"`
+	ClosedAt       *time.Time    `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	TotalVoters    int           `bson:"-" json:"total_voters"`
+	MyVotes        []int         `bson:"-" json:"my_votes,omitempty"` // Options the requesting user voted for
+}
+
+// PollOption is one answer; VoteCount is computed from the poll_votes collection, never stored
+type PollOption struct {
+	ID        int     `bson:"id" json:"id"`
+	Text      string  `bson:"text" json:"text"`
+	VoteCount int     `bson:"-" json:"vote_count"`
+	Voters    []int64 `bson:"-" json:"voters,omitempty"` // Filled for polls that are not anonymous
+}
+
+// IsClosed reports whether voting has ended, either explicitly or because the close time passed
+func (p *MessagePoll) IsClosed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !now.Before(*p.ClosesAt))
+}
+
+// PollVote is one user's current choice in a poll
+type PollVote struct {
+	MessageID int64     `bson:"message_id" json:"message_id"`
+	UserID    int64     `bson:"user_id" json:"user_id"`
+	OptionIDs []int     `bson:"option_ids" json:"option_ids"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
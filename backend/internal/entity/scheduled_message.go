@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledPending  ScheduledMessageStatus = "pending"
+	ScheduledSending  ScheduledMessageStatus = "sending" // Claimed by the scheduler until LockedUntil
+	ScheduledSent     ScheduledMessageStatus = "sent"
+	ScheduledCanceled ScheduledMessageStatus = "canceled"
+	ScheduledFailed   ScheduledMessageStatus = "failed" // Could not be sent at the due time, see LastError
+)
+
+// ScheduledMessage is a message written now and sent to its chat at SendAt
+type ScheduledMessage struct {
+	ID          primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	ChatID      int64                  `bson:"chat_id" json:"chat_id"`
+	CreatedBy   int64                  `bson:"created_by" json:"created_by"`
+	Content     string                 `bson:"content" json:"content"`
+	Type        MessageType            `bson:"type" json:"type"`
+	MediaURL    string                 `bson:"media_url,omitempty" json:"media_url,omitempty"`
+	FileName    string                 `bson:"file_name,omitempty" json:"file_name,omitempty"`
+	FileSize    int64                  `bson:"file_size,omitempty" json:"file_size,omitempty"`
+	ReplyToID   *int64                 `bson:"reply_to_id,omitempty" json:"reply_to_id,omitempty"`
+	ThreadID    *int64                 `bson:"thread_id,omitempty" json:"thread_id,omitempty"`
+	SendAt      time.Time              `bson:"send_at" json:"send_at"`
+	Status      ScheduledMessageStatus `bson:"status" json:"status"`
+	LockedUntil *time.Time             `bson:"locked_until,omitempty" json:"-"`
+	MessageID   int64                  `bson:"message_id,omitempty" json:"message_id,omitempty"` // The chat message it became once sent
+	LastError   string                 `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	SentAt      *time.Time             `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt   time.Time              `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time              `bson:"updated_at" json:"updated_at"`
+}
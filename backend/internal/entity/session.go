@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one signed-in device. Access tokens carry its ID so revoking it cuts the device off.
+type Session struct {
+	ID                       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID                   int64              `bson:"user_id" json:"user_id"`
+	RefreshTokenHash         string             `bson:"refresh_token_hash" json:"-"`
+	PreviousRefreshTokenHash string             `bson:"previous_refresh_token_hash,omitempty" json:"-"` // Detects reuse of a rotated token
+	UserAgent                string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IP                       string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	CreatedAt                time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt               time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt                time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt                *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	Current                  bool               `bson:"-" json:"current"`
+}
+
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // Access token expiry
+}
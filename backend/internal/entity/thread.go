@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ThreadFollow subscribes a user to reply notifications for a thread
+type ThreadFollow struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RootID    int64              `bson:"root_id" json:"root_id"`
+	ChatID    int64              `bson:"chat_id" json:"chat_id"`
+	UserID    int64              `bson:"user_id" json:"user_id"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Thread is a root message with a page of its replies
+type Thread struct {
+	Root      *Message   `json:"root"`
+	Replies   []*Message `json:"replies"`
+	Following bool       `json:"following"`
+}
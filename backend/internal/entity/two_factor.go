@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// TwoFactorSetup is shown once while enrolling an authenticator app
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorChallenge is returned by a password login that still needs a TOTP or recovery code
+type TwoFactorChallenge struct {
+	ChallengeToken string    `json:"challenge_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
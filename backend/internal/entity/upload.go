@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// Upload records who stored a file in the uploads directory and what still uses it. Refs are
+// "message:<id>" for sent messages and "scheduled:<id>" for scheduled messages waiting to go out;
+// the file may only be removed once the last reference is gone.
+type Upload struct {
+	Filename  string    `bson:"filename" json:"filename"`
+	OwnerID   int64     `bson:"owner_id" json:"owner_id"`
+	Refs      []string  `bson:"refs" json:"refs"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
@@ -7,16 +7,61 @@ import (
 )
 
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	NumericID int64              `bson:"numeric_id" json:"numeric_id"` // Numeric ID for chat operations
-	Username  string             `bson:"username" json:"username"`
-	Password  string             `bson:"password" json:"-"` // Never send password in JSON
-	Name      string             `bson:"name" json:"name"`
-	Email     string             `bson:"email" json:"email"`
-	Avatar    string             `bson:"avatar,omitempty" json:"avatar,omitempty"`
-	IsGuest   bool               `bson:"is_guest" json:"is_guest"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	NumericID         int64              `bson:"numeric_id" json:"numeric_id"` // Numeric ID for chat operations
+	Username          string             `bson:"username" json:"username"`
+	Password          string             `bson:"password" json:"-"` // Never send password in JSON
+	Name              string             `bson:"name" json:"name"`
+	SearchUsername    string             `bson:"search_username" json:"-"` // Lowercased username and name, indexed for prefix search
+	SearchName        string             `bson:"search_name" json:"-"`
+	Email             string             `bson:"email" json:"email"`
+	EmailVerified     bool               `bson:"email_verified" json:"email_verified"`
+	Avatar            string             `bson:"avatar" json:"avatar,omitempty"`
+	StatusMessage     string             `bson:"status_message" json:"status_message,omitempty"`
+	IsGuest           bool               `bson:"is_guest" json:"is_guest"`
+	IsBot             bool               `bson:"is_bot,omitempty" json:"is_bot,omitempty"`
+	BotOwnerID        int64              `bson:"bot_owner_id,omitempty" json:"bot_owner_id,omitempty"`         // User who created and manages the bot
+	GuestExpiresAt    *time.Time         `bson:"guest_expires_at,omitempty" json:"guest_expires_at,omitempty"` // Extended while the guest stays active
+	UpgradedAt        *time.Time         `bson:"upgraded_at,omitempty" json:"upgraded_at,omitempty"`           // When a guest became a registered account
+	Discoverable      *bool              `bson:"discoverable,omitempty" json:"discoverable,omitempty"`         // Shown in user search; nil means discoverable
+	TwoFactorEnabled  bool               `bson:"two_factor_enabled" json:"two_factor_enabled"`
+	TwoFactorSecret   string             `bson:"two_factor_secret" json:"-"`    // Base32 TOTP secret, pending until two-factor is enabled
+	TwoFactorLastStep int64              `bson:"two_factor_last_step" json:"-"` // Last accepted TOTP time step, so a code cannot be replayed
+	RecoveryCodes     []string           `bson:"recovery_codes" json:"-"`       // SHA-256 hashes of unused recovery codes
+	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// PublicProfile is the subset of a user that is safe to show to other users
+type PublicProfile struct {
+	ID            string `json:"id"`
+	NumericID     int64  `json:"numeric_id"`
+	Username      string `json:"username"`
+	Name          string `json:"name"`
+	Avatar        string `json:"avatar,omitempty"`
+	StatusMessage string `json:"status_message,omitempty"`
+	IsGuest       bool   `json:"is_guest"`
+	IsBot         bool   `json:"is_bot,omitempty"`
+	BotOwnerID    int64  `json:"bot_owner_id,omitempty"`
+}
+
+// IsDiscoverable reports whether the user may be shown to people who do not know them yet
+func (u *User) IsDiscoverable() bool {
+	return u.Discoverable == nil || *u.Discoverable
+}
+
+func (u *User) PublicProfile() *PublicProfile {
+	return &PublicProfile{
+		ID:            u.ID.Hex(),
+		NumericID:     u.NumericID,
+		Username:      u.Username,
+		Name:          u.Name,
+		Avatar:        u.Avatar,
+		StatusMessage: u.StatusMessage,
+		IsGuest:       u.IsGuest,
+		IsBot:         u.IsBot,
+		BotOwnerID:    u.BotOwnerID,
+	}
 }
 
 type FriendshipStatus string
@@ -49,3 +94,23 @@ type FriendInvitation struct {
 	CreatedAt time.Time  `json:"created_at"`
 	IsActive  bool       `json:"is_active"`
 }
+
+type FriendSuggestion struct {
+	User          *PublicProfile `json:"user"`
+	Score         int            `json:"score"`
+	MutualFriends []int64        `json:"mutual_friends"`
+	SharedChats   []int64        `json:"shared_chats"`
+	Reasons       []string       `json:"reasons"`
+}
+
+// GuestStats summarises guest churn for operators
+type GuestStats struct {
+	ActiveGuests     int64      `json:"active_guests"`
+	Window           string     `json:"window"`
+	CreatedInWindow  int64      `json:"created_in_window"`
+	UpgradedInWindow int64      `json:"upgraded_in_window"`
+	UpgradeRate      float64    `json:"upgrade_rate"`
+	ExpiredTotal     int64      `json:"expired_total"` // Since the server started
+	LastSweepAt      *time.Time `json:"last_sweep_at,omitempty"`
+	LastSweepExpired int        `json:"last_sweep_expired"`
+}
@@ -0,0 +1,109 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Chat events delivered to outgoing webhooks
+const (
+	WebhookMessageSent     = "message.sent"
+	WebhookMessageEdited   = "message.edited"
+	WebhookMessageDeleted  = "message.deleted"
+	WebhookMemberJoined    = "member.joined"
+	WebhookMemberLeft      = "member.left"
+	WebhookReactionAdded   = "reaction.added"
+	WebhookReactionRemoved = "reaction.removed"
+)
+
+var WebhookEvents = []string{
+	WebhookMessageSent,
+	WebhookMessageEdited,
+	WebhookMessageDeleted,
+	WebhookMemberJoined,
+	WebhookMemberLeft,
+	WebhookReactionAdded,
+	WebhookReactionRemoved,
+}
+
+// Webhook is an outgoing webhook registered on a chat
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ChatID    int64              `bson:"chat_id" json:"chat_id"`
+	URL       string             `bson:"url" json:"url"`
+	Secret    string             `bson:"secret" json:"-"`      // HMAC key for the signature header, shown once on creation
+	Events    []string           `bson:"events" json:"events"` // Subscribed events, empty means all
+	IsActive  bool               `bson:"is_active" json:"is_active"`
+	CreatedBy int64              `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+func (w *Webhook) Subscribes(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed" // Gave up after the last retry
+)
+
+// WebhookDelivery is one event queued for a webhook, kept as the delivery log
+type WebhookDelivery struct {
+	ID             primitive.ObjectID    `bson:"_id,omitempty" json:"id"`
+	WebhookID      primitive.ObjectID    `bson:"webhook_id" json:"webhook_id"`
+	ChatID         int64                 `bson:"chat_id" json:"chat_id"`
+	Event          string                `bson:"event" json:"event"`
+	Payload        string                `bson:"payload" json:"payload"` // Exact body that is signed and sent
+	Status         WebhookDeliveryStatus `bson:"status" json:"status"`
+	Attempts       int                   `bson:"attempts" json:"attempts"`
+	LastStatusCode int                   `bson:"last_status_code,omitempty" json:"last_status_code,omitempty"`
+	LastError      string                `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt  time.Time             `bson:"next_attempt_at" json:"next_attempt_at"`
+	DeliveredAt    *time.Time            `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time             `bson:"updated_at" json:"updated_at"`
+}
+
+// WebhookPayload is the JSON body posted to a webhook URL
+type WebhookPayload struct {
+	DeliveryID string      `json:"delivery_id"`
+	Event      string      `json:"event"`
+	ChatID     int64       `json:"chat_id"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Data       interface{} `json:"data"`
+}
+
+// IncomingWebhookPrefix marks incoming webhook tokens
+const IncomingWebhookPrefix = "cnh_"
+
+// IncomingWebhook lets external tools post into a chat with a secret URL. Only the token hash is stored.
+type IncomingWebhook struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ChatID     int64              `bson:"chat_id" json:"chat_id"`
+	Name       string             `bson:"name" json:"name"` // Default author name on posted messages
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	CreatedBy  int64              `bson:"created_by" json:"created_by"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// IncomingWebhookPayload is the JSON body external tools post
+type IncomingWebhookPayload struct {
+	Text        string        `json:"text"`
+	DisplayName string        `json:"display_name"`
+	Attachments []*Attachment `json:"attachments"`
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/service"
+)
+
+// apiTokenRouteScopes lists the routes API tokens may call and the scope each one needs.
+// Anything not listed, such as account settings or creating more tokens, is denied.
+var apiTokenRouteScopes = map[string]string{
+	"GET /api/chats":                                entity.ScopeChatsRead,
+	"GET /api/chats/:id":                            entity.ScopeChatsRead,
+	"POST /api/chats/:id/join":                      entity.ScopeChatsJoin,
+	"POST /api/invitations/chat/:code/join":         entity.ScopeChatsJoin,
+	"GET /api/chats/:id/messages":                   entity.ScopeMessagesRead,
+	"POST /api/chats/:id/messages":                  entity.ScopeMessagesWrite,
+	"PUT /api/messages/:id":                         entity.ScopeMessagesWrite,
+	"DELETE /api/messages/:id":                      entity.ScopeMessagesWrite,
+	"POST /api/messages/:id/reactions":              entity.ScopeMessagesWrite,
+	"GET /api/messages/:id/thread":                  entity.ScopeMessagesRead,
+	"GET /api/mentions":                             entity.ScopeMessagesRead,
+	"GET /api/chats/:id/pins":                       entity.ScopeMessagesRead,
+	"POST /api/messages/:id/pin":                    entity.ScopeMessagesWrite,
+	"DELETE /api/messages/:id/pin":                  entity.ScopeMessagesWrite,
+	"POST /api/chats/:id/polls":                     entity.ScopeMessagesWrite,
+	"GET /api/messages/:id/poll":                    entity.ScopeMessagesRead,
+	"POST /api/messages/:id/poll/votes":             entity.ScopeMessagesWrite,
+	"DELETE /api/messages/:id/poll/votes/:optionId": entity.ScopeMessagesWrite,
+	"POST /api/messages/:id/forward":                entity.ScopeMessagesWrite,
+	"POST /api/messages/:id/poll/close":             entity.ScopeMessagesWrite,
+	"POST /api/upload":                              entity.ScopeMessagesWrite,
+	"GET /ws":                                       entity.ScopeWebSocket,
+}
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, entity.APITokenPrefix)
+}
+
+// authenticateAPIToken validates an API token against the matched route and fills the context.
+// It aborts the request and returns false when the token is invalid or lacks the scope.
+func authenticateAPIToken(c *gin.Context, authService service.AuthService, token string) bool {
+	user, apiToken, err := authService.ValidateAPIToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return false
+	}
+
+	scope, allowed := apiTokenRouteScopes[c.Request.Method+" "+c.FullPath()]
+	if !allowed || !apiToken.HasScope(scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API token is not allowed to call this endpoint"})
+		c.Abort()
+		return false
+	}
+
+	c.Set("user", user)
+	c.Set("user_id", user.NumericID)
+	c.Set("user_id_str", user.ID.Hex())
+	c.Set("user_object", user)
+	c.Set("is_guest", user.IsGuest)
+	c.Set("is_bot", user.IsBot)
+	c.Set("api_token_id", apiToken.ID.Hex())
+	c.Set("session_id", service.APITokenSessionID(apiToken))
+	return true
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -27,7 +29,14 @@ func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		user, err := authService.ValidateToken(token)
+		if isAPIToken(token) {
+			if authenticateAPIToken(c, authService, token) {
+				c.Next()
+			}
+			return
+		}
+
+		user, session, err := authService.ValidateToken(token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
@@ -40,39 +49,85 @@ func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 		c.Set("user_id_str", user.ID.Hex()) // Store as string for MongoDB
 		c.Set("user_object", user)          // Store full user object
 		c.Set("is_guest", user.IsGuest)
+		c.Set("session_id", session.ID.Hex())
 		c.Next()
 	}
 }
 
-// OptionalAuthMiddleware allows both authenticated and guest access
-func OptionalAuthMiddleware(authService service.AuthService) gin.HandlerFunc {
+// WebSocketAuthMiddleware requires a valid token for the WebSocket endpoint. Browsers cannot set
+// headers on a WebSocket handshake, so the token may also be passed as the "token" query parameter.
+func WebSocketAuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var token string
-
-		// Try to get token from Authorization header first
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				token = parts[1]
-			}
+		token := c.Query("token")
+		if parts := strings.Split(c.GetHeader("Authorization"), " "); len(parts) == 2 && parts[0] == "Bearer" {
+			token = parts[1]
 		}
 
-		// If no header token, try query parameter (for WebSocket)
 		if token == "" {
-			token = c.Query("token")
-		}
-
-		// Validate token if present
-		if token != "" {
-			user, err := authService.ValidateToken(token)
-			if err == nil {
-				c.Set("user", user)
-				c.Set("user_id", user.NumericID)
-				c.Set("user_id_str", user.ID.Hex())
-				c.Set("user_object", user)
-				c.Set("is_guest", user.IsGuest)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		if isAPIToken(token) {
+			if authenticateAPIToken(c, authService, token) {
+				c.Next()
 			}
+			return
+		}
+
+		user, session, err := authService.ValidateToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user", user)
+		c.Set("user_id", user.NumericID)
+		c.Set("user_id_str", user.ID.Hex())
+		c.Set("user_object", user)
+		c.Set("is_guest", user.IsGuest)
+		c.Set("session_id", session.ID.Hex())
+		c.Next()
+	}
+}
+
+// RegisteredUserMiddleware rejects guest and bot accounts; must run after AuthMiddleware
+func RegisteredUserMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("is_guest") || c.GetBool("is_bot") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action requires a registered account"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OperatorMiddleware only lets through the users listed in OPERATOR_USER_IDS (comma separated
+// numeric IDs); with the list empty every request is refused. Must run after AuthMiddleware
+func OperatorMiddleware() gin.HandlerFunc {
+	operators := make(map[int64]bool)
+	for _, value := range strings.Split(os.Getenv("OPERATOR_USER_IDS"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Printf("Warning: invalid user ID %q in OPERATOR_USER_IDS", value)
+			continue
+		}
+		operators[id] = true
+	}
+
+	return func(c *gin.Context) {
+		if c.GetBool("is_guest") || c.GetBool("is_bot") || !operators[c.GetInt64("user_id")] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is restricted to operators"})
+			c.Abort()
+			return
 		}
 
 		c.Next()
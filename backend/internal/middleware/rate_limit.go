@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rufflogix/computer-network-project/internal/service"
+)
+
+const defaultGuestMessagesPerMinute = 20
+
+// RateLimiter allows up to limit hits per key in each fixed window
+type RateLimiter struct {
+	limit   int
+	window  time.Duration
+	windows map[string]*rateWindow
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// NewGuestMessageLimiter limits how fast guests can post, configured by GUEST_MESSAGES_PER_MINUTE
+func NewGuestMessageLimiter() *RateLimiter {
+	limit := defaultGuestMessagesPerMinute
+	if value := os.Getenv("GUEST_MESSAGES_PER_MINUTE"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid GUEST_MESSAGES_PER_MINUTE %q, using %d", value, limit)
+		} else {
+			limit = parsed
+		}
+	}
+
+	return NewRateLimiter(limit, time.Minute)
+}
+
+// Allow records a hit for key and reports whether it is within the limit, plus how long until the window resets
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		// Drop stale windows now and then so idle keys do not pile up
+		if len(l.windows) > 10000 {
+			l.prune(now)
+		}
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	retryAfter := w.start.Add(l.window).Sub(now)
+	if w.count >= l.limit {
+		return false, retryAfter
+	}
+
+	w.count++
+	return true, retryAfter
+}
+
+func (l *RateLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// GuestRateLimitMiddleware applies the limiter to guest users only; must run after AuthMiddleware
+func GuestRateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("is_guest") {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := limiter.Allow(fmt.Sprintf("user:%d", c.GetInt64("user_id")))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many messages, slow down or register an account"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// LoginThrottleMiddleware slows down credential guessing per client IP: throttled IPs get 429 before the
+// handler runs, and every 401 the handler returns counts as a failed attempt
+func LoginThrottleMiddleware(guard service.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+
+		if err := guard.Allow("", ip); err != nil {
+			AbortWithLockout(c, err)
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusUnauthorized {
+			guard.RecordFailure("", ip)
+		}
+	}
+}
+
+// AbortWithLockout answers 429 with Retry-After for a *service.LockoutError
+func AbortWithLockout(c *gin.Context, err error) {
+	var lockErr *service.LockoutError
+	if errors.As(err, &lockErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockErr.RetryAfter.Seconds()))))
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	c.Abort()
+}
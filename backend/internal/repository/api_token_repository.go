@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type APITokenRepository interface {
+	CreateAPIToken(token *entity.APIToken) error
+	GetAPITokenByID(id primitive.ObjectID) (*entity.APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*entity.APIToken, error)
+	GetAPITokensByUsers(userIDs []int64) ([]*entity.APIToken, error)
+	TouchAPIToken(id primitive.ObjectID) error
+	RevokeAPIToken(id primitive.ObjectID) error
+	RevokeAPITokensByUser(userID int64) ([]primitive.ObjectID, error)
+}
+
+type implAPITokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPITokenRepository(db *mongo.Database) APITokenRepository {
+	return &implAPITokenRepository{
+		collection: db.Collection("api_tokens"),
+	}
+}
+
+func (r *implAPITokenRepository) CreateAPIToken(token *entity.APIToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	token.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implAPITokenRepository) GetAPITokenByID(id primitive.ObjectID) (*entity.APIToken, error) {
+	return r.findOne(bson.M{"_id": id})
+}
+
+func (r *implAPITokenRepository) GetAPITokenByHash(tokenHash string) (*entity.APIToken, error) {
+	return r.findOne(bson.M{"token_hash": tokenHash})
+}
+
+func (r *implAPITokenRepository) findOne(filter bson.M) (*entity.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var token entity.APIToken
+	err := r.collection.FindOne(ctx, filter).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("token not found")
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *implAPITokenRepository) GetAPITokensByUsers(userIDs []int64) ([]*entity.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"user_id":    bson.M{"$in": userIDs},
+		"revoked_at": bson.M{"$exists": false},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []*entity.APIToken{}
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (r *implAPITokenRepository) TouchAPIToken(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}},
+	)
+	return err
+}
+
+func (r *implAPITokenRepository) RevokeAPIToken(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeAPITokensByUser revokes every active token acting as the user and returns their IDs
+func (r *implAPITokenRepository) RevokeAPITokensByUser(userID int64) ([]primitive.ObjectID, error) {
+	tokens, err := r.GetAPITokensByUsers([]int64{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.ID)
+	}
+
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = r.collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuthTokenRepository interface {
+	CreateToken(token *entity.AuthToken) error
+	GetTokenByHash(purpose entity.AuthTokenPurpose, tokenHash string) (*entity.AuthToken, error)
+	MarkTokenUsed(id primitive.ObjectID) error
+	DeleteTokensByUser(userID int64, purpose entity.AuthTokenPurpose) error
+}
+
+type implAuthTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuthTokenRepository(db *mongo.Database) AuthTokenRepository {
+	return &implAuthTokenRepository{
+		collection: db.Collection("auth_tokens"),
+	}
+}
+
+func (r *implAuthTokenRepository) CreateToken(token *entity.AuthToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	token.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implAuthTokenRepository) GetTokenByHash(purpose entity.AuthTokenPurpose, tokenHash string) (*entity.AuthToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var token entity.AuthToken
+	err := r.collection.FindOne(ctx, bson.M{
+		"purpose":    purpose,
+		"token_hash": tokenHash,
+	}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("token not found")
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkTokenUsed fails if the token was already used, so concurrent redemptions cannot both succeed
+func (r *implAuthTokenRepository) MarkTokenUsed(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return fmt.Errorf("token already used")
+	}
+
+	return nil
+}
+
+func (r *implAuthTokenRepository) DeleteTokensByUser(userID int64, purpose entity.AuthTokenPurpose) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{
+		"user_id": userID,
+		"purpose": purpose,
+	})
+	return err
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -9,6 +10,9 @@ import (
 	"github.com/rufflogix/computer-network-project/internal/entity"
 )
 
+// ErrPinLimit is returned by PinMessage when the chat has no pin left
+var ErrPinLimit = errors.New("pin limit reached")
+
 type ChatRepository interface {
 	// Chat operations
 	CreateChat(chat *entity.Chat) error
@@ -17,6 +21,7 @@ type ChatRepository interface {
 	GetPublicChats() ([]*entity.Chat, error)
 	GetAllChats() ([]*entity.Chat, error)
 	UpdateChat(chat *entity.Chat) error
+	SetChatMessageTTL(chatID, seconds int64) error
 	DeleteChat(id int64) error
 
 	// Message operations
@@ -25,9 +30,44 @@ type ChatRepository interface {
 	GetMessagesByChat(chatID int64, limit, offset int) ([]*entity.Message, error)
 	UpdateMessage(message *entity.Message) error
 	DeleteMessage(id int64) error
+	AnonymizeMessagesByUser(userID int64) error
+	GetMentions(userID int64, chatIDs []int64, limit, offset int) ([]*entity.Message, error)
+
+	// Thread operations; GetMessagesByChat leaves thread replies out
+	GetThreadMessages(rootID int64, limit, offset int) ([]*entity.Message, error)
+	IncrementThreadReply(rootID int64, at time.Time, by int64) (*entity.Message, error)
+	RecountThread(rootID int64) (*entity.Message, error)
+	DeleteMessagesByThread(rootID int64) error
+
+	// Pin operations
+	// PinMessage pins the message unless the chat already has limit pins, returning ErrPinLimit then.
+	// It reports false when the message was already pinned
+	PinMessage(chatID, id, pinnedBy int64, pinnedAt time.Time, limit int) (bool, error)
+	// UnpinMessage reports false when the message was not pinned
+	UnpinMessage(chatID, id int64) (bool, error)
+	GetPinnedMessages(chatID int64) ([]*entity.Message, error)
+	// SetMessageLinkPreviews returns the updated message
+	SetMessageLinkPreviews(id int64, previews []*entity.LinkPreview) (*entity.Message, error)
+
+	// Retention operations for disappearing messages
+	GetExpiredMessages(now time.Time, limit int) ([]*entity.Message, error)
+	DeleteMessagesByIDs(ids []int64) error
+	DeleteReactionsByMessages(messageIDs []int64) error
+
+	// Poll operations; each vote method returns the user's options before the change
+	ReplacePollVote(messageID, userID int64, optionIDs []int) ([]int, error)
+	AddPollVoteOption(messageID, userID int64, optionID int) ([]int, error)
+	RemovePollVoteOption(messageID, userID int64, optionID int) ([]int, error)
+	GetPollVotes(messageID int64) ([]*entity.PollVote, error)
+	// ClosePoll returns nil when the poll was already closed
+	ClosePoll(messageID int64, at time.Time) (*entity.Message, error)
+	GetDuePolls(now time.Time, limit int) ([]*entity.Message, error)
+	DeletePollVotesByMessages(messageIDs []int64) error
+	DeletePollVotesByUser(userID int64) error
 
 	// Reaction operations
 	CreateReaction(reaction *entity.Reaction, userID int64) error
+	GetReactionByID(id int64) (*entity.Reaction, error)
 	GetReactionsByMessage(messageID int64) ([]*entity.Reaction, error)
 	DeleteReaction(id int64) error
 
@@ -36,12 +76,16 @@ type ChatRepository interface {
 	GetChatMembers(chatID int64) ([]*entity.ChatMember, error)
 	RemoveChatMember(chatID, userID int64) error
 	IsChatMember(chatID, userID int64) (bool, error)
+	GetChatMember(chatID, userID int64) (*entity.ChatMember, error)
+	SetChatMemberMutedUntil(chatID, userID int64, until *time.Time) error
+	RemoveMembershipsByUser(userID int64) error
 }
 
 type implChatRepository struct {
 	chats        map[int64]*entity.Chat
 	messages     map[int64]*entity.Message
 	reactions    map[int64]*entity.Reaction
+	pollVotes    map[pollVoteKey]*entity.PollVote
 	chatMembers  map[int64][]*entity.ChatMember
 	chatID       int64
 	messageID    int64
@@ -55,6 +99,7 @@ func NewChatRepository() ChatRepository {
 		chats:       make(map[int64]*entity.Chat),
 		messages:    make(map[int64]*entity.Message),
 		reactions:   make(map[int64]*entity.Reaction),
+		pollVotes:   make(map[pollVoteKey]*entity.PollVote),
 		chatMembers: make(map[int64][]*entity.ChatMember),
 	}
 }
@@ -143,6 +188,20 @@ func (r *implChatRepository) UpdateChat(chat *entity.Chat) error {
 	return nil
 }
 
+func (r *implChatRepository) SetChatMessageTTL(chatID, seconds int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	chat, ok := r.chats[chatID]
+	if !ok {
+		return fmt.Errorf("chat not found")
+	}
+
+	chat.MessageTTL = seconds
+	chat.UpdatedAt = time.Now()
+	return nil
+}
+
 func (r *implChatRepository) DeleteChat(id int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -191,13 +250,79 @@ func (r *implChatRepository) GetMessagesByChat(chatID int64, limit, offset int)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	now := time.Now()
+
+	var messages []*entity.Message
+	for _, msg := range r.messages {
+		if msg.ChatID == chatID && msg.ThreadID == nil && !isExpired(msg, now) {
+			messages = append(messages, msg)
+		}
+	}
+
+	return r.paginateMessages(messages, limit, offset), nil
+}
+
+// GetMentions returns messages in the given chats that mention the user, newest first
+func (r *implChatRepository) GetMentions(userID int64, chatIDs []int64, limit, offset int) ([]*entity.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inChats := make(map[int64]bool, len(chatIDs))
+	for _, chatID := range chatIDs {
+		inChats[chatID] = true
+	}
+
+	var messages []*entity.Message
+	for _, msg := range r.messages {
+		if !inChats[msg.ChatID] {
+			continue
+		}
+		for _, mentioned := range msg.Mentions {
+			if mentioned == userID {
+				messages = append(messages, msg)
+				break
+			}
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+
+	if offset > len(messages) {
+		return []*entity.Message{}, nil
+	}
+	end := offset + limit
+	if end > len(messages) {
+		end = len(messages)
+	}
+
+	return messages[offset:end], nil
+}
+
+func (r *implChatRepository) GetThreadMessages(rootID int64, limit, offset int) ([]*entity.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+
 	var messages []*entity.Message
 	for _, msg := range r.messages {
-		if msg.ChatID == chatID {
+		if msg.ThreadID != nil && *msg.ThreadID == rootID && !isExpired(msg, now) {
 			messages = append(messages, msg)
 		}
 	}
 
+	return r.paginateMessages(messages, limit, offset), nil
+}
+
+// isExpired reports whether a disappearing message is past its expiry but not yet removed
+func isExpired(msg *entity.Message, now time.Time) bool {
+	return msg.ExpiresAt != nil && !msg.ExpiresAt.After(now)
+}
+
+// paginateMessages sorts oldest first and attaches reactions and reply references; callers hold the lock
+func (r *implChatRepository) paginateMessages(messages []*entity.Message, limit, offset int) []*entity.Message {
 	sort.Slice(messages, func(i, j int) bool {
 		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
 	})
@@ -206,7 +331,7 @@ func (r *implChatRepository) GetMessagesByChat(chatID int64, limit, offset int)
 	start := offset
 	end := offset + limit
 	if start > len(messages) {
-		return []*entity.Message{}, nil
+		return []*entity.Message{}
 	}
 	if end > len(messages) {
 		end = len(messages)
@@ -232,7 +357,185 @@ func (r *implChatRepository) GetMessagesByChat(chatID int64, limit, offset int)
 		result = append(result, msg)
 	}
 
-	return result, nil
+	return result
+}
+
+func (r *implChatRepository) IncrementThreadReply(rootID int64, at time.Time, by int64) (*entity.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	root, ok := r.messages[rootID]
+	if !ok {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	root.ThreadReplyCount++
+	root.ThreadLastReplyAt = &at
+	root.ThreadLastReplyBy = by
+	return root, nil
+}
+
+func (r *implChatRepository) RecountThread(rootID int64) (*entity.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	root, ok := r.messages[rootID]
+	if !ok {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	root.ThreadReplyCount = 0
+	root.ThreadLastReplyAt = nil
+	root.ThreadLastReplyBy = 0
+	for _, msg := range r.messages {
+		if msg.ThreadID == nil || *msg.ThreadID != rootID {
+			continue
+		}
+		root.ThreadReplyCount++
+		if root.ThreadLastReplyAt == nil || msg.CreatedAt.After(*root.ThreadLastReplyAt) {
+			createdAt := msg.CreatedAt
+			root.ThreadLastReplyAt = &createdAt
+			root.ThreadLastReplyBy = msg.CreatedBy
+		}
+	}
+
+	return root, nil
+}
+
+func (r *implChatRepository) DeleteMessagesByThread(rootID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, msg := range r.messages {
+		if msg.ThreadID != nil && *msg.ThreadID == rootID {
+			delete(r.messages, id)
+		}
+	}
+	return nil
+}
+
+func (r *implChatRepository) PinMessage(chatID, id, pinnedBy int64, pinnedAt time.Time, limit int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.messages[id]
+	if !ok || msg.ChatID != chatID {
+		return false, fmt.Errorf("message not found")
+	}
+	if msg.PinnedAt != nil {
+		return false, nil
+	}
+
+	pinned := 0
+	for _, other := range r.messages {
+		if other.ChatID == chatID && other.PinnedAt != nil {
+			pinned++
+		}
+	}
+	if pinned >= limit {
+		return false, ErrPinLimit
+	}
+
+	msg.PinnedAt = &pinnedAt
+	msg.PinnedBy = pinnedBy
+	return true, nil
+}
+
+func (r *implChatRepository) UnpinMessage(chatID, id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.messages[id]
+	if !ok || msg.ChatID != chatID {
+		return false, fmt.Errorf("message not found")
+	}
+	if msg.PinnedAt == nil {
+		return false, nil
+	}
+
+	msg.PinnedAt = nil
+	msg.PinnedBy = 0
+	return true, nil
+}
+
+func (r *implChatRepository) SetMessageLinkPreviews(id int64, previews []*entity.LinkPreview) (*entity.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.messages[id]
+	if !ok {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	msg.LinkPreviews = previews
+	return msg, nil
+}
+
+// GetPinnedMessages returns the chat's pinned messages, most recently pinned first
+func (r *implChatRepository) GetPinnedMessages(chatID int64) ([]*entity.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := []*entity.Message{}
+	for _, msg := range r.messages {
+		if msg.ChatID == chatID && msg.PinnedAt != nil {
+			messages = append(messages, msg)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].PinnedAt.After(*messages[j].PinnedAt)
+	})
+
+	return messages, nil
+}
+
+// GetExpiredMessages returns messages whose expiry has passed, soonest expired first
+func (r *implChatRepository) GetExpiredMessages(now time.Time, limit int) ([]*entity.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := []*entity.Message{}
+	for _, msg := range r.messages {
+		if msg.ExpiresAt != nil && !msg.ExpiresAt.After(now) {
+			messages = append(messages, msg)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ExpiresAt.Before(*messages[j].ExpiresAt)
+	})
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+func (r *implChatRepository) DeleteMessagesByIDs(ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		delete(r.messages, id)
+	}
+	return nil
+}
+
+func (r *implChatRepository) DeleteReactionsByMessages(messageIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	remove := make(map[int64]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		remove[id] = true
+	}
+	for id, reaction := range r.reactions {
+		if remove[reaction.MessageID] {
+			delete(r.reactions, id)
+		}
+	}
+	return nil
 }
 
 func (r *implChatRepository) UpdateMessage(message *entity.Message) error {
@@ -256,6 +559,159 @@ func (r *implChatRepository) DeleteMessage(id int64) error {
 	return nil
 }
 
+func (r *implChatRepository) AnonymizeMessagesByUser(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.messages {
+		if message.CreatedBy == userID {
+			message.CreatedBy = 0
+			message.CreatedByUser = nil
+			message.AuthorDeleted = true
+		}
+		if message.ForwardedFrom != nil && message.ForwardedFrom.AuthorID == userID {
+			message.ForwardedFrom.AuthorID = 0
+			message.ForwardedFrom.AuthorName = ""
+		}
+	}
+
+	return nil
+}
+
+// Poll operations
+type pollVoteKey struct {
+	messageID int64
+	userID    int64
+}
+
+func (r *implChatRepository) ReplacePollVote(messageID, userID int64, optionIDs []int) ([]int, error) {
+	return r.updatePollVote(messageID, userID, func([]int) []int {
+		return append([]int(nil), optionIDs...)
+	})
+}
+
+func (r *implChatRepository) AddPollVoteOption(messageID, userID int64, optionID int) ([]int, error) {
+	return r.updatePollVote(messageID, userID, func(current []int) []int {
+		for _, id := range current {
+			if id == optionID {
+				return current
+			}
+		}
+		return append(append([]int(nil), current...), optionID)
+	})
+}
+
+func (r *implChatRepository) RemovePollVoteOption(messageID, userID int64, optionID int) ([]int, error) {
+	return r.updatePollVote(messageID, userID, func(current []int) []int {
+		remaining := []int{}
+		for _, id := range current {
+			if id != optionID {
+				remaining = append(remaining, id)
+			}
+		}
+		return remaining
+	})
+}
+
+func (r *implChatRepository) updatePollVote(messageID, userID int64, change func([]int) []int) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := pollVoteKey{messageID: messageID, userID: userID}
+	var previous []int
+	if vote, ok := r.pollVotes[key]; ok {
+		previous = vote.OptionIDs
+	}
+
+	options := change(previous)
+	if len(options) == 0 {
+		delete(r.pollVotes, key)
+	} else {
+		r.pollVotes[key] = &entity.PollVote{
+			MessageID: messageID,
+			UserID:    userID,
+			OptionIDs: options,
+			UpdatedAt: time.Now(),
+		}
+	}
+
+	return previous, nil
+}
+
+func (r *implChatRepository) GetPollVotes(messageID int64) ([]*entity.PollVote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	votes := []*entity.PollVote{}
+	for key, vote := range r.pollVotes {
+		if key.messageID == messageID {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (r *implChatRepository) ClosePoll(messageID int64, at time.Time) (*entity.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.messages[messageID]
+	if !ok || msg.Poll == nil {
+		return nil, fmt.Errorf("poll not found")
+	}
+	if msg.Poll.ClosedAt != nil {
+		return nil, nil
+	}
+
+	msg.Poll.ClosedAt = &at
+	return msg, nil
+}
+
+// GetDuePolls returns open polls whose close time has passed
+func (r *implChatRepository) GetDuePolls(now time.Time, limit int) ([]*entity.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := []*entity.Message{}
+	for _, msg := range r.messages {
+		if msg.Poll != nil && msg.Poll.ClosedAt == nil && msg.Poll.ClosesAt != nil && !msg.Poll.ClosesAt.After(now) {
+			messages = append(messages, msg)
+			if len(messages) == limit {
+				break
+			}
+		}
+	}
+	return messages, nil
+}
+
+func (r *implChatRepository) DeletePollVotesByMessages(messageIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	remove := make(map[int64]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		remove[id] = true
+	}
+	for key := range r.pollVotes {
+		if remove[key.messageID] {
+			delete(r.pollVotes, key)
+		}
+	}
+	return nil
+}
+
+func (r *implChatRepository) DeletePollVotesByUser(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, vote := range r.pollVotes {
+		if vote.UserID == userID {
+			delete(r.pollVotes, key)
+		}
+	}
+	return nil
+}
+
 // Reaction operations
 func (r *implChatRepository) CreateReaction(reaction *entity.Reaction, userID int64) error {
 	r.mu.Lock()
@@ -294,6 +750,18 @@ func (r *implChatRepository) CreateReaction(reaction *entity.Reaction, userID in
 	return nil
 }
 
+func (r *implChatRepository) GetReactionByID(id int64) (*entity.Reaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reaction, ok := r.reactions[id]
+	if !ok {
+		return nil, fmt.Errorf("reaction not found")
+	}
+
+	return reaction, nil
+}
+
 func (r *implChatRepository) GetReactionsByMessage(messageID int64) ([]*entity.Reaction, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -379,6 +847,33 @@ func (r *implChatRepository) RemoveChatMember(chatID, userID int64) error {
 	return fmt.Errorf("member not found")
 }
 
+func (r *implChatRepository) GetChatMember(chatID, userID int64) (*entity.ChatMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, member := range r.chatMembers[chatID] {
+		if member.UserID == userID {
+			return member, nil
+		}
+	}
+
+	return nil, fmt.Errorf("member not found")
+}
+
+func (r *implChatRepository) SetChatMemberMutedUntil(chatID, userID int64, until *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, member := range r.chatMembers[chatID] {
+		if member.UserID == userID {
+			member.MutedUntil = until
+			return nil
+		}
+	}
+
+	return fmt.Errorf("member not found")
+}
+
 func (r *implChatRepository) IsChatMember(chatID, userID int64) (bool, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -396,3 +891,20 @@ func (r *implChatRepository) IsChatMember(chatID, userID int64) (bool, error) {
 
 	return false, nil
 }
+
+func (r *implChatRepository) RemoveMembershipsByUser(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for chatID, members := range r.chatMembers {
+		filtered := make([]*entity.ChatMember, 0, len(members))
+		for _, member := range members {
+			if member.UserID != userID {
+				filtered = append(filtered, member)
+			}
+		}
+		r.chatMembers[chatID] = filtered
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DraftRepository interface {
+	SaveDraft(draft *entity.Draft) error
+	// GetDraft returns nil when the user has no draft in the chat
+	GetDraft(userID, chatID int64) (*entity.Draft, error)
+	GetDraftsByUser(userID int64) ([]*entity.Draft, error)
+	// DeleteDraft reports whether there was a draft to delete
+	DeleteDraft(userID, chatID int64) (bool, error)
+	DeleteDraftsByUser(userID int64) error
+}
+
+type implDraftRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDraftRepository(db *mongo.Database) DraftRepository {
+	return &implDraftRepository{
+		collection: db.Collection("drafts"),
+	}
+}
+
+// SaveDraft creates or replaces the user's draft for the chat
+func (r *implDraftRepository) SaveDraft(draft *entity.Draft) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	draft.UpdatedAt = time.Now()
+
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.M{"user_id": draft.UserID, "chat_id": draft.ChatID},
+		draft,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *implDraftRepository) GetDraft(userID, chatID int64) (*entity.Draft, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var draft entity.Draft
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "chat_id": chatID}).Decode(&draft)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &draft, nil
+}
+
+// GetDraftsByUser returns the user's drafts, most recently edited first
+func (r *implDraftRepository) GetDraftsByUser(userID int64) ([]*entity.Draft, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	drafts := []*entity.Draft{}
+	if err = cursor.All(ctx, &drafts); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+func (r *implDraftRepository) DeleteDraft(userID, chatID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID, "chat_id": chatID})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+func (r *implDraftRepository) DeleteDraftsByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
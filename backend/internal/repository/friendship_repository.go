@@ -12,9 +12,11 @@ type FriendshipRepository interface {
 	CreateFriendship(userID, friendID int64) (*entity.Friendship, error)
 	GetFriendship(userID, friendID int64) (*entity.Friendship, error)
 	GetFriendshipsByUser(userID int64) ([]*entity.Friendship, error)
+	GetAllFriendshipsByUser(userID int64) ([]*entity.Friendship, error)
 	GetPendingFriendships(userID int64) ([]*entity.Friendship, error)
 	UpdateFriendshipStatus(userID, friendID int64, status entity.FriendshipStatus) error
 	DeleteFriendship(userID, friendID int64) error
+	DeleteFriendshipsByUser(userID int64) error
 }
 
 type implFriendshipRepository struct {
@@ -75,6 +77,20 @@ func (r *implFriendshipRepository) GetFriendshipsByUser(userID int64) ([]*entity
 	return friendships, nil
 }
 
+func (r *implFriendshipRepository) GetAllFriendshipsByUser(userID int64) ([]*entity.Friendship, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var friendships []*entity.Friendship
+	for _, friendship := range r.friendships {
+		if friendship.UserID == userID || friendship.FriendID == userID {
+			friendships = append(friendships, friendship)
+		}
+	}
+
+	return friendships, nil
+}
+
 func (r *implFriendshipRepository) GetPendingFriendships(userID int64) ([]*entity.Friendship, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -119,3 +135,16 @@ func (r *implFriendshipRepository) DeleteFriendship(userID, friendID int64) erro
 
 	return fmt.Errorf("friendship not found")
 }
+
+func (r *implFriendshipRepository) DeleteFriendshipsByUser(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, friendship := range r.friendships {
+		if friendship.UserID == userID || friendship.FriendID == userID {
+			delete(r.friendships, id)
+		}
+	}
+
+	return nil
+}
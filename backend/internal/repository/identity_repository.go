@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IdentityRepository interface {
+	CreateIdentity(identity *entity.Identity) error
+	GetIdentity(provider, subject string) (*entity.Identity, error)
+	GetIdentitiesByUser(userID int64) ([]*entity.Identity, error)
+	DeleteIdentity(id primitive.ObjectID, userID int64) error
+
+	// Pending authorization requests
+	CreateLoginState(state *entity.OIDCLoginState) error
+	ConsumeLoginState(stateHash string) (*entity.OIDCLoginState, error)
+}
+
+type implIdentityRepository struct {
+	identities *mongo.Collection
+	states     *mongo.Collection
+}
+
+func NewIdentityRepository(db *mongo.Database) IdentityRepository {
+	return &implIdentityRepository{
+		identities: db.Collection("identities"),
+		states:     db.Collection("oidc_states"),
+	}
+}
+
+func (r *implIdentityRepository) CreateIdentity(identity *entity.Identity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	identity.CreatedAt = time.Now()
+
+	result, err := r.identities.InsertOne(ctx, identity)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("this account is already linked")
+		}
+		return err
+	}
+
+	identity.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implIdentityRepository) GetIdentity(provider, subject string) (*entity.Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var identity entity.Identity
+	err := r.identities.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("identity not found")
+		}
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (r *implIdentityRepository) GetIdentitiesByUser(userID int64) ([]*entity.Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.identities.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	identities := []*entity.Identity{}
+	if err = cursor.All(ctx, &identities); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (r *implIdentityRepository) DeleteIdentity(id primitive.ObjectID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.identities.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("identity not found")
+	}
+
+	return nil
+}
+
+func (r *implIdentityRepository) CreateLoginState(state *entity.OIDCLoginState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state.CreatedAt = time.Now()
+
+	_, err := r.states.InsertOne(ctx, state)
+	return err
+}
+
+// ConsumeLoginState returns and deletes the state in one step, so a redirect can only be completed once
+func (r *implIdentityRepository) ConsumeLoginState(stateHash string) (*entity.OIDCLoginState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var state entity.OIDCLoginState
+	err := r.states.FindOneAndDelete(ctx, bson.M{"state_hash": stateHash}).Decode(&state)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("login state not found")
+		}
+		return nil, err
+	}
+
+	return &state, nil
+}
@@ -50,6 +50,39 @@ func CreateChatIndexes(db *mongo.Database) error {
 		{
 			Keys: bson.D{{Key: "created_by", Value: 1}},
 		},
+		{
+			// Thread replies, oldest first
+			Keys: bson.D{
+				{Key: "thread_id", Value: 1},
+				{Key: "created_at", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// Pinned messages of a chat
+			Keys: bson.D{
+				{Key: "chat_id", Value: 1},
+				{Key: "pinned_at", Value: -1},
+			},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"pinned_at": bson.M{"$exists": true}}),
+		},
+		{
+			// Retention sweeper looking for expired disappearing messages
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// Open polls waiting for their close time
+			Keys:    bson.D{{Key: "poll.closes_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// Mentions of a user, newest first
+			Keys: bson.D{
+				{Key: "mentions", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
 	})
 	if err != nil {
 		log.Printf("Warning: Failed to create messages indexes: %v", err)
@@ -80,6 +113,26 @@ func CreateChatIndexes(db *mongo.Database) error {
 		return err
 	}
 
+	// Poll votes collection indexes, one vote document per user and poll
+	pollVotesCol := db.Collection("poll_votes")
+	_, err = pollVotesCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "message_id", Value: 1},
+				{Key: "user_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Removing a deleted user's votes
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create poll_votes indexes: %v", err)
+		return err
+	}
+
 	// Chat members collection indexes
 	chatMembersCol := db.Collection("chat_members")
 	_, err = chatMembersCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
@@ -178,3 +231,394 @@ func CreateNotificationIndexes(db *mongo.Database) error {
 	log.Println("Notification indexes created successfully")
 	return nil
 }
+
+// CreateUserIndexes creates indexes for users collection
+func CreateUserIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Users collection indexes
+	usersCol := db.Collection("users")
+	_, err := usersCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "numeric_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: 1}},
+		},
+		{
+			// Case-insensitive prefix search over usernames and names
+			Keys: bson.D{{Key: "search_username", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "search_name", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+		},
+		{
+			Keys: bson.D{
+				{Key: "is_guest", Value: 1},
+				{Key: "guest_expires_at", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create users indexes: %v", err)
+		return err
+	}
+
+	log.Println("User indexes created successfully")
+	return nil
+}
+
+// CreateAuthTokenIndexes creates indexes for auth_tokens collection
+func CreateAuthTokenIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Auth tokens collection indexes
+	authTokensCol := db.Collection("auth_tokens")
+	_, err := authTokensCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "purpose", Value: 1},
+			},
+		},
+		{
+			// Let MongoDB drop expired tokens
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create auth_tokens indexes: %v", err)
+		return err
+	}
+
+	log.Println("Auth token indexes created successfully")
+	return nil
+}
+
+// CreateSessionIndexes creates indexes for sessions collection
+func CreateSessionIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Sessions collection indexes
+	sessionsCol := db.Collection("sessions")
+	_, err := sessionsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "refresh_token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "previous_refresh_token_hash", Value: 1}},
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "last_used_at", Value: -1},
+			},
+		},
+		{
+			// Let MongoDB drop sessions once their refresh token has expired
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create sessions indexes: %v", err)
+		return err
+	}
+
+	log.Println("Session indexes created successfully")
+	return nil
+}
+
+func CreateIdentityIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Identities collection indexes
+	identitiesCol := db.Collection("identities")
+	_, err := identitiesCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "provider", Value: 1},
+				{Key: "subject", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create identities indexes: %v", err)
+		return err
+	}
+
+	// OIDC login states collection indexes
+	statesCol := db.Collection("oidc_states")
+	_, err = statesCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "state_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Abandoned logins disappear on their own
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create oidc_states indexes: %v", err)
+		return err
+	}
+
+	log.Println("Identity indexes created successfully")
+	return nil
+}
+
+func CreateAPITokenIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// API tokens collection indexes
+	apiTokensCol := db.Collection("api_tokens")
+	_, err := apiTokensCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create api_tokens indexes: %v", err)
+		return err
+	}
+
+	log.Println("API token indexes created successfully")
+	return nil
+}
+
+func CreateWebhookIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Webhooks collection indexes
+	webhooksCol := db.Collection("webhooks")
+	_, err := webhooksCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "chat_id", Value: 1},
+				{Key: "is_active", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create webhooks indexes: %v", err)
+		return err
+	}
+
+	// Webhook deliveries collection indexes
+	deliveriesCol := db.Collection("webhook_deliveries")
+	_, err = deliveriesCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// Worker polling for due deliveries
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "next_attempt_at", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "webhook_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+		{
+			// Keep the delivery log for 30 days
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60),
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create webhook_deliveries indexes: %v", err)
+		return err
+	}
+
+	// Incoming webhooks collection indexes
+	incomingCol := db.Collection("incoming_webhooks")
+	_, err = incomingCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "chat_id", Value: 1}},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create incoming_webhooks indexes: %v", err)
+		return err
+	}
+
+	log.Println("Webhook indexes created successfully")
+	return nil
+}
+
+func CreateThreadIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Thread follows collection indexes
+	followsCol := db.Collection("thread_follows")
+	_, err := followsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "root_id", Value: 1},
+				{Key: "user_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Removing a deleted user's follows
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create thread_follows indexes: %v", err)
+		return err
+	}
+
+	log.Println("Thread indexes created successfully")
+	return nil
+}
+
+// CreateScheduledMessageIndexes creates indexes for the scheduled_messages collection
+func CreateScheduledMessageIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	scheduledCol := db.Collection("scheduled_messages")
+	_, err := scheduledCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// Scheduler polling for due messages
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "send_at", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "created_by", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "send_at", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create scheduled_messages indexes: %v", err)
+		return err
+	}
+
+	log.Println("Scheduled message indexes created successfully")
+	return nil
+}
+
+// CreateLinkPreviewIndexes creates indexes for the link_previews cache collection
+func CreateLinkPreviewIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	previewsCol := db.Collection("link_previews")
+	_, err := previewsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "url", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Let MongoDB drop cache entries once they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create link_previews indexes: %v", err)
+		return err
+	}
+
+	log.Println("Link preview indexes created successfully")
+	return nil
+}
+
+// CreateDraftIndexes creates indexes for the drafts collection
+func CreateDraftIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	draftsCol := db.Collection("drafts")
+	_, err := draftsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// One draft per user and chat
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "chat_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "updated_at", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create drafts indexes: %v", err)
+		return err
+	}
+
+	log.Println("Draft indexes created successfully")
+	return nil
+}
+
+// CreateUploadIndexes creates indexes for the uploads collection
+func CreateUploadIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	uploadsCol := db.Collection("uploads")
+	_, err := uploadsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "filename", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Finding the files a message uses
+			Keys: bson.D{{Key: "refs", Value: 1}},
+		},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create uploads indexes: %v", err)
+		return err
+	}
+
+	log.Println("Upload indexes created successfully")
+	return nil
+}
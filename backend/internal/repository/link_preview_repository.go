@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LinkPreviewRepository interface {
+	// GetCachedPreviews returns the unexpired cache entries for the given URLs, keyed by URL
+	GetCachedPreviews(urls []string, now time.Time) (map[string]*entity.CachedLinkPreview, error)
+	SaveCachedPreview(preview *entity.CachedLinkPreview) error
+}
+
+type implLinkPreviewRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLinkPreviewRepository(db *mongo.Database) LinkPreviewRepository {
+	return &implLinkPreviewRepository{
+		collection: db.Collection("link_previews"),
+	}
+}
+
+func (r *implLinkPreviewRepository) GetCachedPreviews(urls []string, now time.Time) (map[string]*entity.CachedLinkPreview, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"url":        bson.M{"$in": urls},
+		"expires_at": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var cached []*entity.CachedLinkPreview
+	if err = cursor.All(ctx, &cached); err != nil {
+		return nil, err
+	}
+
+	previews := make(map[string]*entity.CachedLinkPreview, len(cached))
+	for _, preview := range cached {
+		previews[preview.URL] = preview
+	}
+	return previews, nil
+}
+
+// SaveCachedPreview replaces any earlier entry for the same URL
+func (r *implLinkPreviewRepository) SaveCachedPreview(preview *entity.CachedLinkPreview) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"url": preview.URL}, preview, options.Replace().SetUpsert(true))
+	return err
+}
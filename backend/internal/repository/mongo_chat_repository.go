@@ -17,6 +17,7 @@ type MongoChatRepository struct {
 	chatsCol       *mongo.Collection
 	messagesCol    *mongo.Collection
 	reactionsCol   *mongo.Collection
+	pollVotesCol   *mongo.Collection
 	chatMembersCol *mongo.Collection
 	chatIDCounter  *mongo.Collection
 }
@@ -27,6 +28,7 @@ func NewMongoChatRepository(db *mongo.Database) ChatRepository {
 		chatsCol:       db.Collection("chats"),
 		messagesCol:    db.Collection("messages"),
 		reactionsCol:   db.Collection("reactions"),
+		pollVotesCol:   db.Collection("poll_votes"),
 		chatMembersCol: db.Collection("chat_members"),
 		chatIDCounter:  db.Collection("counters"),
 	}
@@ -279,6 +281,30 @@ func (r *MongoChatRepository) UpdateChat(chat *entity.Chat) error {
 	return err
 }
 
+func (r *MongoChatRepository) SetChatMessageTTL(chatID, seconds int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"message_ttl": seconds, "updated_at": time.Now()},
+	}
+	if seconds == 0 {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": time.Now()},
+			"$unset": bson.M{"message_ttl": ""},
+		}
+	}
+
+	result, err := r.chatsCol.UpdateOne(ctx, bson.M{"id": chatID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("chat not found")
+	}
+	return nil
+}
+
 func (r *MongoChatRepository) DeleteChat(id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -339,7 +365,10 @@ func (r *MongoChatRepository) GetMessagesByChat(chatID int64, limit, offset int)
 		SetLimit(int64(limit)).
 		SetSkip(int64(offset))
 
-	cursor, err := r.messagesCol.Find(ctx, bson.M{"chat_id": chatID}, opts)
+	// Thread replies are read through GetThreadMessages
+	filter := bson.M{"chat_id": chatID, "thread_id": bson.M{"$exists": false}, "$or": notExpired()}
+
+	cursor, err := r.messagesCol.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -350,7 +379,27 @@ func (r *MongoChatRepository) GetMessagesByChat(chatID int64, limit, offset int)
 		return nil, err
 	}
 
-	// Populate user information and reactions for each message
+	r.populateMessages(ctx, messages)
+
+	// Reverse to get chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// notExpired matches messages that are not disappearing or whose expiry is still ahead,
+// hiding expired messages the retention sweeper has not removed yet
+func notExpired() []bson.M {
+	return []bson.M{
+		{"expires_at": bson.M{"$exists": false}},
+		{"expires_at": bson.M{"$gt": time.Now()}},
+	}
+}
+
+// populateMessages loads the author, replied message and reactions of each message
+func (r *MongoChatRepository) populateMessages(ctx context.Context, messages []*entity.Message) {
 	usersCol := r.db.Collection("users")
 	for _, msg := range messages {
 		var user entity.User
@@ -373,34 +422,552 @@ func (r *MongoChatRepository) GetMessagesByChat(chatID int64, limit, offset int)
 			msg.Reactions = reactions
 		}
 	}
+}
 
-	// Reverse to get chronological order
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+// GetThreadMessages returns the replies of a thread, oldest first
+// GetMentions returns messages in the given chats that mention the user, newest first
+func (r *MongoChatRepository) GetMentions(userID int64, chatIDs []int64, limit, offset int) ([]*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	filter := bson.M{"mentions": userID, "chat_id": bson.M{"$in": chatIDs}}
+
+	cursor, err := r.messagesCol.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*entity.Message{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	r.populateMessages(ctx, messages)
+	return messages, nil
+}
+
+func (r *MongoChatRepository) GetThreadMessages(rootID int64, limit, offset int) ([]*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := r.messagesCol.Find(ctx, bson.M{"thread_id": rootID, "$or": notExpired()}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*entity.Message{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	r.populateMessages(ctx, messages)
+	return messages, nil
+}
+
+// IncrementThreadReply records a new reply on the root atomically and returns the updated root
+func (r *MongoChatRepository) IncrementThreadReply(rootID int64, at time.Time, by int64) (*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$inc": bson.M{"thread_reply_count": 1},
+		"$set": bson.M{"thread_last_reply_at": at, "thread_last_reply_by": by},
+	}
+
+	var root entity.Message
+	err := r.messagesCol.FindOneAndUpdate(ctx, bson.M{"id": rootID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&root)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("message not found")
+		}
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+// RecountThread recomputes the root's thread metadata from its replies, e.g. after one is deleted
+func (r *MongoChatRepository) RecountThread(rootID int64) (*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := r.messagesCol.CountDocuments(ctx, bson.M{"thread_id": rootID})
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{"$unset": bson.M{
+		"thread_reply_count":   "",
+		"thread_last_reply_at": "",
+		"thread_last_reply_by": "",
+	}}
+
+	if count > 0 {
+		var last entity.Message
+		err := r.messagesCol.FindOne(ctx, bson.M{"thread_id": rootID},
+			options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&last)
+		if err != nil {
+			return nil, err
+		}
+
+		update = bson.M{"$set": bson.M{
+			"thread_reply_count":   count,
+			"thread_last_reply_at": last.CreatedAt,
+			"thread_last_reply_by": last.CreatedBy,
+		}}
+	}
+
+	var root entity.Message
+	err = r.messagesCol.FindOneAndUpdate(ctx, bson.M{"id": rootID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&root)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("message not found")
+		}
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+func (r *MongoChatRepository) DeleteMessagesByThread(rootID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := r.messagesCol.DeleteMany(ctx, bson.M{"thread_id": rootID})
+	return err
+}
+
+// PinMessage takes one of the chat's pin slots with a conditional increment of its pinned_count,
+// so concurrent pins cannot push the chat past limit, then marks the message pinned
+func (r *MongoChatRepository) PinMessage(chatID, id, pinnedBy int64, pinnedAt time.Time, limit int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reserved, err := r.reservePinSlot(ctx, chatID, limit)
+	if err != nil {
+		return false, err
+	}
+	if !reserved {
+		return false, ErrPinLimit
+	}
+
+	result, err := r.messagesCol.UpdateOne(
+		ctx,
+		bson.M{"id": id, "chat_id": chatID, "pinned_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"pinned_at": pinnedAt, "pinned_by": pinnedBy}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		// Already pinned, or gone: give the slot back
+		r.releasePinSlots(ctx, chatID, 1)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *MongoChatRepository) reservePinSlot(ctx context.Context, chatID int64, limit int) (bool, error) {
+	result, err := r.chatsCol.UpdateOne(
+		ctx,
+		bson.M{"id": chatID, "pinned_count": bson.M{"$lt": limit}},
+		bson.M{"$inc": bson.M{"pinned_count": 1}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+
+	// Chats from before the counter existed start from the pins they already have
+	count, err := r.messagesCol.CountDocuments(ctx, bson.M{"chat_id": chatID, "pinned_at": bson.M{"$exists": true}})
+	if err != nil {
+		return false, err
+	}
+	initialized, err := r.chatsCol.UpdateOne(
+		ctx,
+		bson.M{"id": chatID, "pinned_count": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"pinned_count": count}},
+	)
+	if err != nil || initialized.MatchedCount == 0 {
+		return false, err
+	}
+
+	result, err = r.chatsCol.UpdateOne(
+		ctx,
+		bson.M{"id": chatID, "pinned_count": bson.M{"$lt": limit}},
+		bson.M{"$inc": bson.M{"pinned_count": 1}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *MongoChatRepository) releasePinSlots(ctx context.Context, chatID int64, count int) {
+	if _, err := r.chatsCol.UpdateOne(
+		ctx,
+		bson.M{"id": chatID, "pinned_count": bson.M{"$gte": count}},
+		bson.M{"$inc": bson.M{"pinned_count": -count}},
+	); err != nil {
+		log.Printf("Error releasing pin slots of chat %d: %v", chatID, err)
+	}
+}
+
+func (r *MongoChatRepository) UnpinMessage(chatID, id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.messagesCol.UpdateOne(
+		ctx,
+		bson.M{"id": id, "chat_id": chatID, "pinned_at": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"pinned_at": "", "pinned_by": ""}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return false, err
+	}
+
+	r.releasePinSlots(ctx, chatID, 1)
+	return true, nil
+}
+
+func (r *MongoChatRepository) SetMessageLinkPreviews(id int64, previews []*entity.LinkPreview) (*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var message entity.Message
+	err := r.messagesCol.FindOneAndUpdate(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"link_previews": previews}}, opts).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("message not found")
+		}
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// GetPinnedMessages returns the chat's pinned messages, most recently pinned first
+func (r *MongoChatRepository) GetPinnedMessages(chatID int64) ([]*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "pinned_at", Value: -1}})
+	filter := bson.M{"chat_id": chatID, "pinned_at": bson.M{"$exists": true}}
+
+	cursor, err := r.messagesCol.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*entity.Message{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	r.populateMessages(ctx, messages)
+	return messages, nil
+}
+
+// GetExpiredMessages returns messages whose expiry has passed, soonest expired first
+func (r *MongoChatRepository) GetExpiredMessages(now time.Time, limit int) ([]*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "expires_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.messagesCol.Find(ctx, bson.M{"expires_at": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*entity.Message{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
 	}
 
 	return messages, nil
 }
 
+func (r *MongoChatRepository) DeleteMessagesByIDs(ids []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Pinned messages give their slot back, counted per chat from what was actually deleted
+	cursor, err := r.messagesCol.Find(
+		ctx,
+		bson.M{"id": bson.M{"$in": ids}, "pinned_at": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"id": 1, "chat_id": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	var pinned []*entity.Message
+	if err = cursor.All(ctx, &pinned); err != nil {
+		return err
+	}
+
+	released := make(map[int64]int)
+	for _, message := range pinned {
+		result, err := r.messagesCol.DeleteOne(ctx, bson.M{"id": message.ID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount > 0 {
+			released[message.ChatID]++
+		}
+	}
+	for chatID, count := range released {
+		r.releasePinSlots(ctx, chatID, count)
+	}
+
+	_, err = r.messagesCol.DeleteMany(ctx, bson.M{"id": bson.M{"$in": ids}})
+	return err
+}
+
+func (r *MongoChatRepository) DeleteReactionsByMessages(messageIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := r.reactionsCol.DeleteMany(ctx, bson.M{"message_id": bson.M{"$in": messageIDs}})
+	return err
+}
+
 func (r *MongoChatRepository) UpdateMessage(message *entity.Message) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	message.UpdatedAt = time.Now()
 
-	_, err := r.messagesCol.UpdateOne(
+	update := bson.M{"$set": message}
+
+	// Omitted fields are left alone by $set, so mentions and formatting removed by an edit are cleared explicitly
+	unset := bson.M{}
+	if len(message.Mentions) == 0 {
+		unset["mentions"] = ""
+	}
+	if !message.MentionsEveryone {
+		unset["mentions_everyone"] = ""
+	}
+	if message.ContentHTML == "" {
+		unset["content_html"] = ""
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	_, err := r.messagesCol.UpdateOne(ctx, bson.M{"id": message.ID}, update)
+	return err
+}
+
+func (r *MongoChatRepository) DeleteMessage(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var deleted entity.Message
+	err := r.messagesCol.FindOneAndDelete(ctx, bson.M{"id": id}).Decode(&deleted)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	if deleted.PinnedAt != nil {
+		r.releasePinSlots(ctx, deleted.ChatID, 1)
+	}
+	return nil
+}
+
+func (r *MongoChatRepository) AnonymizeMessagesByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := r.messagesCol.UpdateMany(
 		ctx,
-		bson.M{"id": message.ID},
-		bson.M{"$set": message},
+		bson.M{"created_by": userID},
+		bson.M{"$set": bson.M{
+			"created_by":     int64(0),
+			"author_deleted": true,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Forwarded copies credit the author by name as well
+	_, err = r.messagesCol.UpdateMany(
+		ctx,
+		bson.M{"forwarded_from.author_id": userID},
+		bson.M{"$unset": bson.M{
+			"forwarded_from.author_id":   "",
+			"forwarded_from.author_name": "",
+		}},
 	)
 	return err
 }
 
-func (r *MongoChatRepository) DeleteMessage(id int64) error {
+// Poll operations
+func (r *MongoChatRepository) ReplacePollVote(messageID, userID int64, optionIDs []int) ([]int, error) {
+	if len(optionIDs) == 0 {
+		return r.deletePollVote(messageID, userID)
+	}
+	return r.updatePollVote(messageID, userID, bson.M{"$set": bson.M{"option_ids": optionIDs, "updated_at": time.Now()}}, true)
+}
+
+func (r *MongoChatRepository) AddPollVoteOption(messageID, userID int64, optionID int) ([]int, error) {
+	return r.updatePollVote(messageID, userID, bson.M{
+		"$addToSet": bson.M{"option_ids": optionID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}, true)
+}
+
+func (r *MongoChatRepository) RemovePollVoteOption(messageID, userID int64, optionID int) ([]int, error) {
+	previous, err := r.updatePollVote(messageID, userID, bson.M{
+		"$pull": bson.M{"option_ids": optionID},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop votes left without options so they do not count as voters
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = r.pollVotesCol.DeleteOne(ctx, bson.M{"message_id": messageID, "user_id": userID, "option_ids": bson.M{"$size": 0}})
+	return previous, err
+}
+
+// updatePollVote applies update to the user's vote, optionally creating it, and returns the options it had before
+func (r *MongoChatRepository) updatePollVote(messageID, userID int64, update bson.M, upsert bool) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().
+		SetUpsert(upsert).
+		SetReturnDocument(options.Before)
+
+	var previous entity.PollVote
+	err := r.pollVotesCol.FindOneAndUpdate(ctx, bson.M{"message_id": messageID, "user_id": userID}, update, opts).Decode(&previous)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return previous.OptionIDs, nil
+}
+
+func (r *MongoChatRepository) deletePollVote(messageID, userID int64) ([]int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := r.messagesCol.DeleteOne(ctx, bson.M{"id": id})
+	var previous entity.PollVote
+	err := r.pollVotesCol.FindOneAndDelete(ctx, bson.M{"message_id": messageID, "user_id": userID}).Decode(&previous)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return previous.OptionIDs, nil
+}
+
+func (r *MongoChatRepository) GetPollVotes(messageID int64) ([]*entity.PollVote, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.pollVotesCol.Find(ctx, bson.M{"message_id": messageID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	votes := []*entity.PollVote{}
+	if err = cursor.All(ctx, &votes); err != nil {
+		return nil, err
+	}
+
+	return votes, nil
+}
+
+func (r *MongoChatRepository) ClosePoll(messageID int64, at time.Time) (*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": messageID, "poll": bson.M{"$exists": true}, "poll.closed_at": bson.M{"$exists": false}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var message entity.Message
+	err := r.messagesCol.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"poll.closed_at": at}}, opts).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// GetDuePolls returns open polls whose close time has passed
+func (r *MongoChatRepository) GetDuePolls(now time.Time, limit int) ([]*entity.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"poll.closes_at": bson.M{"$lte": now},
+		"poll.closed_at": bson.M{"$exists": false},
+	}
+
+	cursor, err := r.messagesCol.Find(ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*entity.Message{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (r *MongoChatRepository) DeletePollVotesByMessages(messageIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := r.pollVotesCol.DeleteMany(ctx, bson.M{"message_id": bson.M{"$in": messageIDs}})
+	return err
+}
+
+func (r *MongoChatRepository) DeletePollVotesByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := r.pollVotesCol.DeleteMany(ctx, bson.M{"user_id": userID})
 	return err
 }
 
@@ -488,6 +1055,22 @@ func (r *MongoChatRepository) CreateReaction(reaction *entity.Reaction, userID i
 	}
 }
 
+func (r *MongoChatRepository) GetReactionByID(id int64) (*entity.Reaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var reaction entity.Reaction
+	err := r.reactionsCol.FindOne(ctx, bson.M{"id": id}).Decode(&reaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("reaction not found")
+		}
+		return nil, err
+	}
+
+	return &reaction, nil
+}
+
 func (r *MongoChatRepository) GetReactionsByMessage(messageID int64) ([]*entity.Reaction, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -570,6 +1153,44 @@ func (r *MongoChatRepository) RemoveChatMember(chatID, userID int64) error {
 	return err
 }
 
+func (r *MongoChatRepository) GetChatMember(chatID, userID int64) (*entity.ChatMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var member entity.ChatMember
+	err := r.chatMembersCol.FindOne(ctx, bson.M{"chat_id": chatID, "user_id": userID}).Decode(&member)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("member not found")
+		}
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// SetChatMemberMutedUntil mutes the member until the given time, or unmutes them when until is nil
+func (r *MongoChatRepository) SetChatMemberMutedUntil(chatID, userID int64, until *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"muted_until": ""}}
+	if until != nil {
+		update = bson.M{"$set": bson.M{"muted_until": *until}}
+	}
+
+	result, err := r.chatMembersCol.UpdateOne(ctx, bson.M{"chat_id": chatID, "user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("member not found")
+	}
+
+	return nil
+}
+
 func (r *MongoChatRepository) IsChatMember(chatID, userID int64) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -584,3 +1205,11 @@ func (r *MongoChatRepository) IsChatMember(chatID, userID int64) (bool, error) {
 
 	return count > 0, nil
 }
+
+func (r *MongoChatRepository) RemoveMembershipsByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.chatMembersCol.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
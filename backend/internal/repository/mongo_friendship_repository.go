@@ -136,6 +136,36 @@ func (r *MongoFriendshipRepository) GetFriendshipsByUser(userID int64) ([]*entit
 	return friendships, nil
 }
 
+// GetAllFriendshipsByUser returns every relationship involving the user, regardless of status
+func (r *MongoFriendshipRepository) GetAllFriendshipsByUser(userID int64) ([]*entity.Friendship, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"$or": []bson.M{
+			{"user_id": userID},
+			{"friend_id": userID},
+		},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var friendships []*entity.Friendship
+	for cursor.Next(ctx) {
+		var friendship entity.Friendship
+		if err := cursor.Decode(&friendship); err != nil {
+			return nil, err
+		}
+		friendships = append(friendships, &friendship)
+	}
+
+	return friendships, nil
+}
+
 func (r *MongoFriendshipRepository) GetPendingFriendships(userID int64) ([]*entity.Friendship, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -199,3 +229,18 @@ func (r *MongoFriendshipRepository) DeleteFriendship(userID, friendID int64) err
 	_, err := r.collection.DeleteOne(ctx, filter)
 	return err
 }
+
+func (r *MongoFriendshipRepository) DeleteFriendshipsByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"$or": []bson.M{
+			{"user_id": userID},
+			{"friend_id": userID},
+		},
+	}
+
+	_, err := r.collection.DeleteMany(ctx, filter)
+	return err
+}
@@ -159,3 +159,17 @@ func (r *MongoNotificationRepository) DeleteNotification(id int64) error {
 	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
 	return err
 }
+
+// DeleteNotificationsByUser removes notifications sent to or by the user
+func (r *MongoNotificationRepository) DeleteNotificationsByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteMany(ctx, bson.M{
+		"$or": []bson.M{
+			{"recipient_id": userID},
+			{"sender_id": userID},
+		},
+	})
+	return err
+}
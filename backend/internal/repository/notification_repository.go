@@ -15,6 +15,7 @@ type NotificationRepository interface {
 	GetUnreadNotificationsByUser(userID int64) ([]*entity.Notification, error)
 	UpdateNotificationStatus(id int64, status entity.NotificationStatus) error
 	DeleteNotification(id int64) error
+	DeleteNotificationsByUser(userID int64) error
 }
 
 type implNotificationRepository struct {
@@ -104,3 +105,17 @@ func (r *implNotificationRepository) DeleteNotification(id int64) error {
 	delete(r.notifications, id)
 	return nil
 }
+
+// DeleteNotificationsByUser removes notifications sent to or by the user
+func (r *implNotificationRepository) DeleteNotificationsByUser(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, notif := range r.notifications {
+		if notif.RecipientID == userID || notif.SenderID == userID {
+			delete(r.notifications, id)
+		}
+	}
+
+	return nil
+}
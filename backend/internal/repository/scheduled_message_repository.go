@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ScheduledMessageRepository interface {
+	CreateScheduledMessage(message *entity.ScheduledMessage) error
+	GetScheduledMessageByID(id primitive.ObjectID) (*entity.ScheduledMessage, error)
+	GetPendingScheduledMessages(userID int64, chatID *int64) ([]*entity.ScheduledMessage, error)
+	CountPendingScheduledMessages(userID int64) (int64, error)
+	// UpdatePendingScheduledMessage and CancelScheduledMessage only change messages that are still pending
+	UpdatePendingScheduledMessage(message *entity.ScheduledMessage) error
+	CancelScheduledMessage(id primitive.ObjectID) error
+	// ClaimDueScheduledMessage locks one due message for sending, also reclaiming sends whose lock ran out;
+	// it returns nil when nothing is due
+	ClaimDueScheduledMessage(now time.Time, lease time.Duration) (*entity.ScheduledMessage, error)
+	CompleteScheduledMessage(message *entity.ScheduledMessage) error
+}
+
+type implScheduledMessageRepository struct {
+	collection *mongo.Collection
+}
+
+func NewScheduledMessageRepository(db *mongo.Database) ScheduledMessageRepository {
+	return &implScheduledMessageRepository{
+		collection: db.Collection("scheduled_messages"),
+	}
+}
+
+func (r *implScheduledMessageRepository) CreateScheduledMessage(message *entity.ScheduledMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message.Status = entity.ScheduledPending
+	message.CreatedAt = time.Now()
+	message.UpdatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, message)
+	if err != nil {
+		return err
+	}
+
+	message.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implScheduledMessageRepository) GetScheduledMessageByID(id primitive.ObjectID) (*entity.ScheduledMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var message entity.ScheduledMessage
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("scheduled message not found")
+		}
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// GetPendingScheduledMessages lists the user's unsent messages, soonest first, optionally for one chat
+func (r *implScheduledMessageRepository) GetPendingScheduledMessages(userID int64, chatID *int64) ([]*entity.ScheduledMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"created_by": userID, "status": entity.ScheduledPending}
+	if chatID != nil {
+		filter["chat_id"] = *chatID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "send_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*entity.ScheduledMessage{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (r *implScheduledMessageRepository) CountPendingScheduledMessages(userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return r.collection.CountDocuments(ctx, bson.M{"created_by": userID, "status": entity.ScheduledPending})
+}
+
+func (r *implScheduledMessageRepository) UpdatePendingScheduledMessage(message *entity.ScheduledMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message.UpdatedAt = time.Now()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": message.ID, "status": entity.ScheduledPending},
+		bson.M{"$set": bson.M{
+			"content":    message.Content,
+			"send_at":    message.SendAt,
+			"updated_at": message.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("scheduled message was already sent or canceled")
+	}
+	return nil
+}
+
+func (r *implScheduledMessageRepository) CancelScheduledMessage(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": entity.ScheduledPending},
+		bson.M{"$set": bson.M{"status": entity.ScheduledCanceled, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("scheduled message was already sent or canceled")
+	}
+	return nil
+}
+
+func (r *implScheduledMessageRepository) ClaimDueScheduledMessage(now time.Time, lease time.Duration) (*entity.ScheduledMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{
+		{"status": entity.ScheduledPending, "send_at": bson.M{"$lte": now}},
+		// A scheduler that stopped mid-send leaves its claim behind
+		{"status": entity.ScheduledSending, "locked_until": bson.M{"$lte": now}},
+	}}
+	update := bson.M{"$set": bson.M{
+		"status":       entity.ScheduledSending,
+		"locked_until": now.Add(lease),
+		"updated_at":   now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "send_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var message entity.ScheduledMessage
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// CompleteScheduledMessage records the outcome of a claimed send and releases the lock
+func (r *implScheduledMessageRepository) CompleteScheduledMessage(message *entity.ScheduledMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message.LockedUntil = nil
+	message.UpdatedAt = time.Now()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": message.ID}, message)
+	return err
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionRepository interface {
+	CreateSession(session *entity.Session) error
+	GetSessionByID(id primitive.ObjectID) (*entity.Session, error)
+	GetSessionByRefreshHash(tokenHash string) (*entity.Session, error)
+	GetSessionByPreviousRefreshHash(tokenHash string) (*entity.Session, error)
+	RotateRefreshToken(id primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) error
+	RevokeSession(id primitive.ObjectID) error
+	RevokeUserSessions(userID int64, exceptID *primitive.ObjectID) ([]primitive.ObjectID, error)
+	GetActiveSessionsByUser(userID int64) ([]*entity.Session, error)
+}
+
+type implSessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(db *mongo.Database) SessionRepository {
+	return &implSessionRepository{
+		collection: db.Collection("sessions"),
+	}
+}
+
+func (r *implSessionRepository) CreateSession(session *entity.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+
+	result, err := r.collection.InsertOne(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implSessionRepository) GetSessionByID(id primitive.ObjectID) (*entity.Session, error) {
+	return r.findOne(bson.M{"_id": id})
+}
+
+func (r *implSessionRepository) GetSessionByRefreshHash(tokenHash string) (*entity.Session, error) {
+	return r.findOne(bson.M{"refresh_token_hash": tokenHash})
+}
+
+func (r *implSessionRepository) GetSessionByPreviousRefreshHash(tokenHash string) (*entity.Session, error) {
+	return r.findOne(bson.M{"previous_refresh_token_hash": tokenHash})
+}
+
+func (r *implSessionRepository) findOne(filter bson.M) (*entity.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session entity.Session
+	err := r.collection.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RotateRefreshToken only succeeds if oldHash is still current, so two concurrent refreshes cannot both win
+func (r *implSessionRepository) RotateRefreshToken(id primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id":                id,
+			"refresh_token_hash": oldHash,
+			"revoked_at":         bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{
+			"refresh_token_hash":          newHash,
+			"previous_refresh_token_hash": oldHash,
+			"last_used_at":                time.Now(),
+			"expires_at":                  expiresAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return fmt.Errorf("session is no longer valid")
+	}
+
+	return nil
+}
+
+func (r *implSessionRepository) RevokeSession(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeUserSessions revokes every active session of the user except exceptID and returns the revoked IDs
+func (r *implSessionRepository) RevokeUserSessions(userID int64, exceptID *primitive.ObjectID) ([]primitive.ObjectID, error) {
+	sessions, err := r.GetActiveSessionsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(sessions))
+	for _, session := range sessions {
+		if exceptID != nil && session.ID == *exceptID {
+			continue
+		}
+		ids = append(ids, session.ID)
+	}
+
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = r.collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (r *implSessionRepository) GetActiveSessionsByUser(userID int64) ([]*entity.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*entity.Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
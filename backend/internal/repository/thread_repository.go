@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ThreadRepository interface {
+	FollowThread(follow *entity.ThreadFollow) error
+	UnfollowThread(rootID, userID int64) error
+	IsFollowingThread(rootID, userID int64) (bool, error)
+	GetThreadFollowers(rootID int64) ([]int64, error)
+	DeleteThreadFollows(rootID int64) error
+	DeleteFollowsByUser(userID int64) error
+}
+
+type implThreadRepository struct {
+	follows *mongo.Collection
+}
+
+func NewThreadRepository(db *mongo.Database) ThreadRepository {
+	return &implThreadRepository{
+		follows: db.Collection("thread_follows"),
+	}
+}
+
+// FollowThread is idempotent; following twice keeps the original follow
+func (r *implThreadRepository) FollowThread(follow *entity.ThreadFollow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	follow.CreatedAt = time.Now()
+
+	_, err := r.follows.UpdateOne(
+		ctx,
+		bson.M{"root_id": follow.RootID, "user_id": follow.UserID},
+		bson.M{"$setOnInsert": bson.M{
+			"chat_id":    follow.ChatID,
+			"created_at": follow.CreatedAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *implThreadRepository) UnfollowThread(rootID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.follows.DeleteOne(ctx, bson.M{"root_id": rootID, "user_id": userID})
+	return err
+}
+
+func (r *implThreadRepository) IsFollowingThread(rootID, userID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := r.follows.CountDocuments(ctx, bson.M{"root_id": rootID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *implThreadRepository) GetThreadFollowers(rootID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.follows.Find(ctx, bson.M{"root_id": rootID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var follows []*entity.ThreadFollow
+	if err = cursor.All(ctx, &follows); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]int64, 0, len(follows))
+	for _, follow := range follows {
+		userIDs = append(userIDs, follow.UserID)
+	}
+
+	return userIDs, nil
+}
+
+func (r *implThreadRepository) DeleteThreadFollows(rootID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.follows.DeleteMany(ctx, bson.M{"root_id": rootID})
+	return err
+}
+
+func (r *implThreadRepository) DeleteFollowsByUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.follows.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UploadRepository interface {
+	CreateUpload(upload *entity.Upload) error
+	// AddUploadReference only succeeds for the file's owner; it reports whether the reference was recorded
+	AddUploadReference(filename string, ownerID int64, ref string) (bool, error)
+	// CopyUploadReferences lets toRef use every file fromRef uses, as a forwarded copy does
+	CopyUploadReferences(fromRef, toRef string) error
+	// RemoveUploadReferences drops ref and returns the files it left without any reference
+	RemoveUploadReferences(ref string) ([]string, error)
+	// DeleteUnreferencedUpload removes the record if nothing references the file, reporting whether it did
+	DeleteUnreferencedUpload(filename string) (bool, error)
+}
+
+type implUploadRepository struct {
+	collection *mongo.Collection
+}
+
+func NewUploadRepository(db *mongo.Database) UploadRepository {
+	return &implUploadRepository{
+		collection: db.Collection("uploads"),
+	}
+}
+
+func (r *implUploadRepository) CreateUpload(upload *entity.Upload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	upload.CreatedAt = time.Now()
+	if upload.Refs == nil {
+		upload.Refs = []string{}
+	}
+
+	_, err := r.collection.InsertOne(ctx, upload)
+	return err
+}
+
+func (r *implUploadRepository) AddUploadReference(filename string, ownerID int64, ref string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"filename": filename, "owner_id": ownerID},
+		bson.M{"$addToSet": bson.M{"refs": ref}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+func (r *implUploadRepository) CopyUploadReferences(fromRef, toRef string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"refs": fromRef},
+		bson.M{"$addToSet": bson.M{"refs": toRef}},
+	)
+	return err
+}
+
+func (r *implUploadRepository) RemoveUploadReferences(ref string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"refs": ref})
+	if err != nil {
+		return nil, err
+	}
+	var uploads []*entity.Upload
+	if err = cursor.All(ctx, &uploads); err != nil {
+		return nil, err
+	}
+	if len(uploads) == 0 {
+		return nil, nil
+	}
+
+	if _, err := r.collection.UpdateMany(ctx, bson.M{"refs": ref}, bson.M{"$pull": bson.M{"refs": ref}}); err != nil {
+		return nil, err
+	}
+
+	filenames := make([]string, 0, len(uploads))
+	for _, upload := range uploads {
+		filenames = append(filenames, upload.Filename)
+	}
+
+	// Another message may have taken a reference in the meantime, so only report those now empty
+	cursor, err = r.collection.Find(ctx, bson.M{"filename": bson.M{"$in": filenames}, "refs": bson.M{"$size": 0}})
+	if err != nil {
+		return nil, err
+	}
+	var unreferenced []*entity.Upload
+	if err = cursor.All(ctx, &unreferenced); err != nil {
+		return nil, err
+	}
+
+	filenames = filenames[:0]
+	for _, upload := range unreferenced {
+		filenames = append(filenames, upload.Filename)
+	}
+	return filenames, nil
+}
+
+func (r *implUploadRepository) DeleteUnreferencedUpload(filename string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"filename": filename, "refs": bson.M{"$size": 0}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount > 0, nil
+}
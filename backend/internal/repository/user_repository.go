@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rufflogix/computer-network-project/internal/entity"
 	"go.mongodb.org/mongo-driver/bson"
@@ -20,6 +23,21 @@ type UserRepository interface {
 	UpdateUser(user *entity.User) error
 	DeleteUser(id primitive.ObjectID) error
 	GetAllUsers() ([]*entity.User, error)
+	SearchUsers(query string, includeGuests bool, excludeIDs []int64, limit, offset int) ([]*entity.User, error)
+
+	// Bots
+	GetBotsByOwner(ownerID int64) ([]*entity.User, error)
+
+	// Two-factor authentication
+	AdvanceTwoFactorStep(id int64, step int64) (bool, error)
+	ConsumeRecoveryCode(id int64, codeHash string) (bool, error)
+
+	// Guest lifecycle
+	ExtendGuestExpiry(id int64, expiresAt time.Time) error
+	GetExpiredGuests(now time.Time, ttl time.Duration, limit int) ([]*entity.User, error)
+	CountGuests() (int64, error)
+	CountGuestsCreatedSince(since time.Time) (int64, error)
+	CountGuestsUpgradedSince(since time.Time) (int64, error)
 }
 
 type implUserRepository struct {
@@ -28,10 +46,55 @@ type implUserRepository struct {
 }
 
 func NewUserRepository(db *mongo.Database) UserRepository {
-	return &implUserRepository{
+	repo := &implUserRepository{
 		db:         db,
 		collection: db.Collection("users"),
 	}
+
+	if err := repo.backfillSearchFields(); err != nil {
+		log.Printf("warning: failed to backfill user search fields: %v", err)
+	}
+
+	return repo
+}
+
+// setSearchFields keeps the lowercased copies that SearchUsers matches on in step with the user
+func setSearchFields(user *entity.User) {
+	user.SearchUsername = strings.ToLower(user.Username)
+	user.SearchName = strings.ToLower(user.Name)
+}
+
+// backfillSearchFields fills the search fields of users created before they existed
+func (r *implUserRepository) backfillSearchFields() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"search_username": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1, "username": 1, "name": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user entity.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		setSearchFields(&user)
+
+		if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+			"search_username": user.SearchUsername,
+			"search_name":     user.SearchName,
+		}}); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
 }
 
 func (r *implUserRepository) CreateUser(user *entity.User) error {
@@ -59,6 +122,7 @@ func (r *implUserRepository) CreateUser(user *entity.User) error {
 	}
 
 	user.NumericID = result.Seq
+	setSearchFields(user)
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
@@ -128,6 +192,7 @@ func (r *implUserRepository) UpdateUser(user *entity.User) error {
 	defer cancel()
 
 	user.UpdatedAt = time.Now()
+	setSearchFields(user)
 
 	_, err := r.collection.UpdateOne(
 		ctx,
@@ -163,3 +228,190 @@ func (r *implUserRepository) GetAllUsers() ([]*entity.User, error) {
 
 	return users, nil
 }
+
+// SearchUsers does a case-insensitive prefix match on username and name, skipping users who opted out of discovery
+func (r *implUserRepository) SearchUsers(query string, includeGuests bool, excludeIDs []int64, limit, offset int) ([]*entity.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A range over the lowercased fields is a prefix match the indexes can answer directly
+	prefix := strings.ToLower(query)
+	match := bson.M{"$gte": prefix, "$lt": prefixUpperBound(prefix)}
+	filter := bson.M{
+		"$or": []bson.M{
+			{"search_username": match},
+			{"search_name": match},
+		},
+		"discoverable": bson.M{"$ne": false},
+	}
+	if !includeGuests {
+		filter["is_guest"] = false
+	}
+	if len(excludeIDs) > 0 {
+		filter["numeric_id"] = bson.M{"$nin": excludeIDs}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "username", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*entity.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// prefixUpperBound returns the smallest string greater than every string starting with prefix
+func prefixUpperBound(prefix string) string {
+	runes := []rune(prefix)
+	for len(runes) > 0 {
+		last := runes[len(runes)-1] + 1
+		if last >= 0xD800 && last <= 0xDFFF {
+			last = 0xE000 // Surrogates cannot be encoded, skip past them
+		}
+		if last <= utf8.MaxRune {
+			runes[len(runes)-1] = last
+			return string(runes)
+		}
+		runes = runes[:len(runes)-1]
+	}
+	// Only reached when every rune is already the largest one
+	return string(utf8.MaxRune)
+}
+
+func (r *implUserRepository) ExtendGuestExpiry(id int64, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"numeric_id": id, "is_guest": true},
+		bson.M{"$set": bson.M{"guest_expires_at": expiresAt}},
+	)
+	return err
+}
+
+// GetExpiredGuests returns guests past their expiry; guests created before expiries were tracked fall back to created_at + ttl
+func (r *implUserRepository) GetExpiredGuests(now time.Time, ttl time.Duration, limit int) ([]*entity.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"is_guest": true,
+		"$or": []bson.M{
+			{"guest_expires_at": bson.M{"$lt": now}},
+			{
+				"guest_expires_at": bson.M{"$exists": false},
+				"created_at":       bson.M{"$lt": now.Add(-ttl)},
+			},
+		},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*entity.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *implUserRepository) CountGuests() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return r.collection.CountDocuments(ctx, bson.M{"is_guest": true})
+}
+
+func (r *implUserRepository) CountGuestsCreatedSince(since time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Upgraded guests still count as guests created in the window
+	return r.collection.CountDocuments(ctx, bson.M{
+		"created_at": bson.M{"$gte": since},
+		"$or": []bson.M{
+			{"is_guest": true},
+			{"upgraded_at": bson.M{"$exists": true}},
+		},
+	})
+}
+
+func (r *implUserRepository) CountGuestsUpgradedSince(since time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return r.collection.CountDocuments(ctx, bson.M{"upgraded_at": bson.M{"$gte": since}})
+}
+
+// AdvanceTwoFactorStep records step as the last used TOTP step; it returns false if that step or a later one was already used
+func (r *implUserRepository) AdvanceTwoFactorStep(id int64, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{
+			"numeric_id": id,
+			"$or": []bson.M{
+				{"two_factor_last_step": bson.M{"$lt": step}},
+				{"two_factor_last_step": bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$set": bson.M{"two_factor_last_step": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// ConsumeRecoveryCode removes the code hash if present; it returns false if the code was unknown or already used
+func (r *implUserRepository) ConsumeRecoveryCode(id int64, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"numeric_id": id, "recovery_codes": codeHash},
+		bson.M{"$pull": bson.M{"recovery_codes": codeHash}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *implUserRepository) GetBotsByOwner(ownerID int64) ([]*entity.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"is_bot": true, "bot_owner_id": ownerID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*entity.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookRepository interface {
+	CreateWebhook(webhook *entity.Webhook) error
+	GetWebhookByID(id primitive.ObjectID) (*entity.Webhook, error)
+	GetWebhooksByChat(chatID int64) ([]*entity.Webhook, error)
+	GetActiveWebhooksByChat(chatID int64) ([]*entity.Webhook, error)
+	DeleteWebhook(id primitive.ObjectID) error
+
+	// Delivery log
+	CreateDelivery(delivery *entity.WebhookDelivery) error
+	ClaimDueDelivery(now time.Time, lease time.Duration) (*entity.WebhookDelivery, error)
+	UpdateDelivery(delivery *entity.WebhookDelivery) error
+	GetDeliveriesByWebhook(webhookID primitive.ObjectID, limit int) ([]*entity.WebhookDelivery, error)
+
+	// Incoming webhooks
+	CreateIncomingWebhook(webhook *entity.IncomingWebhook) error
+	GetIncomingWebhookByID(id primitive.ObjectID) (*entity.IncomingWebhook, error)
+	GetIncomingWebhookByHash(tokenHash string) (*entity.IncomingWebhook, error)
+	GetIncomingWebhooksByChat(chatID int64) ([]*entity.IncomingWebhook, error)
+	TouchIncomingWebhook(id primitive.ObjectID) error
+	DeleteIncomingWebhook(id primitive.ObjectID) error
+}
+
+type implWebhookRepository struct {
+	webhooks   *mongo.Collection
+	deliveries *mongo.Collection
+	incoming   *mongo.Collection
+}
+
+func NewWebhookRepository(db *mongo.Database) WebhookRepository {
+	return &implWebhookRepository{
+		webhooks:   db.Collection("webhooks"),
+		deliveries: db.Collection("webhook_deliveries"),
+		incoming:   db.Collection("incoming_webhooks"),
+	}
+}
+
+func (r *implWebhookRepository) CreateWebhook(webhook *entity.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = time.Now()
+
+	result, err := r.webhooks.InsertOne(ctx, webhook)
+	if err != nil {
+		return err
+	}
+
+	webhook.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implWebhookRepository) GetWebhookByID(id primitive.ObjectID) (*entity.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var webhook entity.Webhook
+	err := r.webhooks.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (r *implWebhookRepository) GetWebhooksByChat(chatID int64) ([]*entity.Webhook, error) {
+	return r.findWebhooks(bson.M{"chat_id": chatID})
+}
+
+func (r *implWebhookRepository) GetActiveWebhooksByChat(chatID int64) ([]*entity.Webhook, error) {
+	return r.findWebhooks(bson.M{"chat_id": chatID, "is_active": true})
+}
+
+func (r *implWebhookRepository) findWebhooks(filter bson.M) ([]*entity.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.webhooks.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	webhooks := []*entity.Webhook{}
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes the webhook and its delivery log
+func (r *implWebhookRepository) DeleteWebhook(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.webhooks.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	_, err = r.deliveries.DeleteMany(ctx, bson.M{"webhook_id": id})
+	return err
+}
+
+func (r *implWebhookRepository) CreateDelivery(delivery *entity.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = time.Now()
+
+	result, err := r.deliveries.InsertOne(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	delivery.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ClaimDueDelivery picks the oldest pending delivery that is due and pushes its next attempt out by
+// the lease, so another worker does not pick it up while it is being sent. Returns nil when none is due.
+func (r *implWebhookRepository) ClaimDueDelivery(now time.Time, lease time.Duration) (*entity.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":          entity.DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery entity.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (r *implWebhookRepository) UpdateDelivery(delivery *entity.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	delivery.UpdatedAt = time.Now()
+
+	_, err := r.deliveries.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	return err
+}
+
+func (r *implWebhookRepository) GetDeliveriesByWebhook(webhookID primitive.ObjectID, limit int) ([]*entity.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.deliveries.Find(ctx, bson.M{"webhook_id": webhookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*entity.WebhookDelivery{}
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *implWebhookRepository) CreateIncomingWebhook(webhook *entity.IncomingWebhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	webhook.CreatedAt = time.Now()
+
+	result, err := r.incoming.InsertOne(ctx, webhook)
+	if err != nil {
+		return err
+	}
+
+	webhook.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *implWebhookRepository) GetIncomingWebhookByID(id primitive.ObjectID) (*entity.IncomingWebhook, error) {
+	return r.findIncomingWebhook(bson.M{"_id": id})
+}
+
+func (r *implWebhookRepository) GetIncomingWebhookByHash(tokenHash string) (*entity.IncomingWebhook, error) {
+	return r.findIncomingWebhook(bson.M{"token_hash": tokenHash})
+}
+
+func (r *implWebhookRepository) findIncomingWebhook(filter bson.M) (*entity.IncomingWebhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var webhook entity.IncomingWebhook
+	err := r.incoming.FindOne(ctx, filter).Decode(&webhook)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (r *implWebhookRepository) GetIncomingWebhooksByChat(chatID int64) ([]*entity.IncomingWebhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.incoming.Find(ctx, bson.M{"chat_id": chatID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	webhooks := []*entity.IncomingWebhook{}
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *implWebhookRepository) TouchIncomingWebhook(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.incoming.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+	return err
+}
+
+func (r *implWebhookRepository) DeleteIncomingWebhook(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.incoming.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
@@ -1,7 +1,13 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
 	"os"
 	"time"
 
@@ -12,40 +18,115 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ClientInfo describes the device a session is created from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
 type AuthService interface {
-	Register(username, password, name, email string) (*entity.User, string, error)
-	Login(username, password string) (*entity.User, string, error)
-	CreateGuestUser(name string) (*entity.User, string, error)
-	ValidateToken(tokenString string) (*entity.User, error)
+	Register(username, password, name, email string, client ClientInfo) (*entity.User, *entity.TokenPair, error)
+	// Login returns a challenge instead of tokens when the account has two-factor authentication enabled
+	Login(username, password string, client ClientInfo) (*entity.User, *entity.TokenPair, *entity.TwoFactorChallenge, error)
+	CreateGuestUser(name string, client ClientInfo) (*entity.User, *entity.TokenPair, error)
+	UpgradeGuest(userID int64, username, password, email, name string, client ClientInfo) (*entity.User, *entity.TokenPair, error)
+	ValidateToken(tokenString string) (*entity.User, *entity.Session, error)
+	ValidateAPIToken(token string) (*entity.User, *entity.APIToken, error)
 	GetUserByNumericID(id int64) (*entity.User, error)
+	// CreateSessionForUser signs in a user already authenticated elsewhere (e.g. by an OIDC provider)
+	CreateSessionForUser(user *entity.User, client ClientInfo) (*entity.TokenPair, *entity.TwoFactorChallenge, error)
+
+	// Session management
+	RefreshSession(refreshToken string) (*entity.User, *entity.TokenPair, error)
+	Logout(sessionID string) error
+	LogoutAll(userID int64) error
+	GetSessions(userID int64, currentSessionID string) ([]*entity.Session, error)
+	RevokeSession(userID int64, sessionID string) error
+
+	// Password and email management
+	ChangePassword(userID int64, currentSessionID, currentPassword, newPassword string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) error
+	SendVerificationEmail(userID int64) error
+	VerifyEmail(token string) error
+
+	// Two-factor authentication
+	CompleteTwoFactorLogin(challengeToken, code string, client ClientInfo) (*entity.User, *entity.TokenPair, error)
+	BeginTwoFactorSetup(userID int64) (*entity.TwoFactorSetup, error)
+	EnableTwoFactor(userID int64, code string) ([]string, error)
+	DisableTwoFactor(userID int64, password, code string) error
+	RegenerateRecoveryCodes(userID int64, code string) ([]string, error)
 }
 
+const (
+	passwordResetTTL      = time.Hour
+	emailVerificationTTL  = 48 * time.Hour
+	defaultGuestTTL       = 24 * time.Hour
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
 type implAuthService struct {
-	userRepo repository.UserRepository
+	userRepo        repository.UserRepository
+	tokenRepo       repository.AuthTokenRepository
+	sessionRepo     repository.SessionRepository
+	apiTokenRepo    repository.APITokenRepository
+	roomService     RoomService
+	mailer          Mailer
+	loginGuard      LoginGuard
+	keyProvider     KeyProvider
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	guestTTL        time.Duration
+	sessions        *sessionCache
+	now             func() time.Time
 }
 
-func NewAuthService(userRepo repository.UserRepository) AuthService {
+func NewAuthService(
+	userRepo repository.UserRepository,
+	tokenRepo repository.AuthTokenRepository,
+	sessionRepo repository.SessionRepository,
+	apiTokenRepo repository.APITokenRepository,
+	roomService RoomService,
+	mailer Mailer,
+	loginGuard LoginGuard,
+	keyProvider KeyProvider,
+) AuthService {
+	// The web client does not refresh tokens yet, so access tokens keep the old 7 day lifetime;
+	// they are still tied to their session and stop working once it is revoked
 	return &implAuthService{
-		userRepo: userRepo,
+		userRepo:        userRepo,
+		tokenRepo:       tokenRepo,
+		sessionRepo:     sessionRepo,
+		apiTokenRepo:    apiTokenRepo,
+		roomService:     roomService,
+		mailer:          mailer,
+		loginGuard:      loginGuard,
+		keyProvider:     keyProvider,
+		accessTokenTTL:  envDuration("ACCESS_TOKEN_TTL", 7*24*time.Hour),
+		refreshTokenTTL: envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		guestTTL:        envDuration("GUEST_TTL", defaultGuestTTL),
+		sessions:        newSessionCache(envDuration("SESSION_CACHE_TTL", 30*time.Second)),
+		now:             time.Now,
 	}
 }
 
-func (s *implAuthService) Register(username, password, name, email string) (*entity.User, string, error) {
+func (s *implAuthService) Register(username, password, name, email string, client ClientInfo) (*entity.User, *entity.TokenPair, error) {
 	// Check if user already exists
 	existingUser, _ := s.userRepo.GetUserByUsername(username)
 	if existingUser != nil {
-		return nil, "", errors.New("username already exists")
+		return nil, nil, errors.New("username already exists")
 	}
 
 	existingEmail, _ := s.userRepo.GetUserByEmail(email)
 	if existingEmail != nil {
-		return nil, "", errors.New("email already exists")
+		return nil, nil, errors.New("email already exists")
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	// Create user
@@ -60,118 +141,635 @@ func (s *implAuthService) Register(username, password, name, email string) (*ent
 	}
 
 	if err := s.userRepo.CreateUser(user); err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	// Generate token
-	token, err := s.generateToken(user)
+	// Registration succeeds even if the verification email cannot be sent; it can be resent later
+	if err := s.SendVerificationEmail(user.NumericID); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.NumericID, err)
+	}
+
+	// Start a session
+	tokens, err := s.createSession(user, client)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-func (s *implAuthService) Login(username, password string) (*entity.User, string, error) {
+func (s *implAuthService) Login(username, password string, client ClientInfo) (*entity.User, *entity.TokenPair, *entity.TwoFactorChallenge, error) {
+	// Throttle per username; unknown usernames are tracked too so they look the same as real ones
+	if err := s.loginGuard.Allow(username, ""); err != nil {
+		return nil, nil, nil, err
+	}
+
 	// Find user
 	user, err := s.userRepo.GetUserByUsername(username)
 	if err != nil {
-		return nil, "", errors.New("invalid username or password")
+		s.loginGuard.RecordFailure(username, "")
+		return nil, nil, nil, errors.New("invalid username or password")
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid username or password")
+		s.loginGuard.RecordFailure(username, "")
+		return nil, nil, nil, errors.New("invalid username or password")
 	}
 
-	// Generate token
-	token, err := s.generateToken(user)
+	// The password alone is not enough; hand out a short-lived challenge for the second step
+	if user.TwoFactorEnabled {
+		challenge, err := s.issueTwoFactorChallenge(user)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return user, nil, challenge, nil
+	}
+
+	s.loginGuard.RecordSuccess(username)
+
+	// Start a session
+	tokens, err := s.createSession(user, client)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil, nil
 }
 
-func (s *implAuthService) CreateGuestUser(name string) (*entity.User, string, error) {
-	// Create guest user
+func (s *implAuthService) CreateGuestUser(name string, client ClientInfo) (*entity.User, *entity.TokenPair, error) {
+	// Create guest user; it expires unless it keeps refreshing its session or upgrades
+	expiresAt := time.Now().Add(s.guestTTL)
 	user := &entity.User{
-		Username:  "guest_" + primitive.NewObjectID().Hex(),
-		Name:      name,
-		IsGuest:   true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Username:       "guest_" + primitive.NewObjectID().Hex(),
+		Name:           name,
+		IsGuest:        true,
+		GuestExpiresAt: &expiresAt,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
 	}
 
 	if err := s.userRepo.CreateUser(user); err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	// Generate token
-	token, err := s.generateToken(user)
+	// Start a session
+	tokens, err := s.createSession(user, client)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-func (s *implAuthService) ValidateToken(tokenString string) (*entity.User, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key-change-this-in-production"
+// UpgradeGuest turns a guest into a registered account in place, so its numeric ID and everything keyed on it survives
+func (s *implAuthService) UpgradeGuest(userID int64, username, password, email, name string, client ClientInfo) (*entity.User, *entity.TokenPair, error) {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, nil, errors.New("user not found")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(jwtSecret), nil
-	})
+	if !user.IsGuest {
+		return nil, nil, errors.New("account is already registered")
+	}
+
+	existingUser, _ := s.userRepo.GetUserByUsername(username)
+	if existingUser != nil {
+		return nil, nil, errors.New("username already exists")
+	}
+
+	existingEmail, _ := s.userRepo.GetUserByEmail(email)
+	if existingEmail != nil {
+		return nil, nil, errors.New("email already exists")
+	}
 
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	user.Username = username
+	user.Password = string(hashedPassword)
+	user.Email = email
+	user.EmailVerified = false
+	user.IsGuest = false
+	user.GuestExpiresAt = nil
+	now := time.Now()
+	user.UpgradedAt = &now
+	if name != "" {
+		user.Name = name
+	}
+
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.SendVerificationEmail(user.NumericID); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.NumericID, err)
+	}
+
+	// Existing tokens still claim is_guest=true, so replace the guest sessions with a fresh one
+	if err := s.revokeUserSessions(user.NumericID, nil); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.createSession(user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+func (s *implAuthService) ValidateToken(tokenString string) (*entity.User, *entity.Session, error) {
+	token, err := jwt.Parse(tokenString, s.keyProvider.Keyfunc, jwt.WithValidMethods(s.keyProvider.ValidMethods()))
+
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		userIDStr, ok := claims["user_id"].(string)
 		if !ok {
-			return nil, errors.New("invalid token claims")
+			return nil, nil, errors.New("invalid token claims")
+		}
+
+		sessionIDStr, ok := claims["sid"].(string)
+		if !ok {
+			return nil, nil, errors.New("invalid token claims")
 		}
 
 		userID, err := primitive.ObjectIDFromHex(userIDStr)
 		if err != nil {
-			return nil, errors.New("invalid user ID")
+			return nil, nil, errors.New("invalid user ID")
+		}
+
+		if user, session, ok := s.sessions.get(sessionIDStr); ok {
+			if user.ID != userID {
+				return nil, nil, errors.New("invalid token")
+			}
+			return user, session, nil
+		}
+
+		// The session check is what makes logout and revocation take effect before the token expires
+		session, err := s.getActiveSession(sessionIDStr)
+		if err != nil {
+			return nil, nil, err
 		}
 
 		user, err := s.userRepo.GetUserByID(userID)
 		if err != nil {
-			return nil, errors.New("user not found")
+			return nil, nil, errors.New("user not found")
+		}
+
+		if session.UserID != user.NumericID {
+			return nil, nil, errors.New("invalid token")
 		}
 
-		return user, nil
+		s.sessions.put(user, session)
+		return user, session, nil
 	}
 
-	return nil, errors.New("invalid token")
+	return nil, nil, errors.New("invalid token")
 }
 
-func (s *implAuthService) generateToken(user *entity.User) (string, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key-change-this-in-production"
+// ValidateAPIToken checks a long-lived API token and returns the account it acts as
+func (s *implAuthService) ValidateAPIToken(token string) (*entity.User, *entity.APIToken, error) {
+	apiToken, err := s.apiTokenRepo.GetAPITokenByHash(hashToken(token))
+	if err != nil {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	if apiToken.RevokedAt != nil || (apiToken.ExpiresAt != nil && time.Now().After(*apiToken.ExpiresAt)) {
+		return nil, nil, errors.New("token has been revoked or has expired")
+	}
+
+	user, err := s.userRepo.GetUserByNumericID(apiToken.UserID)
+	if err != nil {
+		return nil, nil, errors.New("user not found")
 	}
 
+	// Tokens are used on every request; recording each use would mean a write per call
+	if apiToken.LastUsedAt == nil || time.Since(*apiToken.LastUsedAt) > time.Minute {
+		if err := s.apiTokenRepo.TouchAPIToken(apiToken.ID); err != nil {
+			log.Printf("Error recording use of API token %s: %v", apiToken.ID.Hex(), err)
+		}
+	}
+
+	return user, apiToken, nil
+}
+
+func (s *implAuthService) generateToken(user *entity.User, sessionID string, expiresAt time.Time) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":  user.ID.Hex(),
+		"sid":      sessionID,
 		"username": user.Username,
 		"is_guest": user.IsGuest,
-		"exp":      time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		"exp":      expiresAt.Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	return s.keyProvider.Sign(claims)
 }
 
 func (s *implAuthService) GetUserByNumericID(id int64) (*entity.User, error) {
 	return s.userRepo.GetUserByNumericID(id)
 }
+
+func (s *implAuthService) CreateSessionForUser(user *entity.User, client ClientInfo) (*entity.TokenPair, *entity.TwoFactorChallenge, error) {
+	// An external login replaces the password, not the second factor
+	if user.TwoFactorEnabled {
+		challenge, err := s.issueTwoFactorChallenge(user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
+	}
+
+	tokens, err := s.createSession(user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, nil, nil
+}
+
+// RefreshSession rotates the refresh token; presenting an already rotated token revokes the whole session
+func (s *implAuthService) RefreshSession(refreshToken string) (*entity.User, *entity.TokenPair, error) {
+	tokenHash := hashToken(refreshToken)
+
+	session, err := s.sessionRepo.GetSessionByRefreshHash(tokenHash)
+	if err != nil {
+		if reused, err := s.sessionRepo.GetSessionByPreviousRefreshHash(tokenHash); err == nil {
+			log.Printf("Refresh token reuse detected for session %s, revoking", reused.ID.Hex())
+			s.revokeSession(reused.ID)
+		}
+		return nil, nil, errors.New("invalid or expired refresh token")
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, nil, errors.New("invalid or expired refresh token")
+	}
+
+	user, err := s.userRepo.GetUserByNumericID(session.UserID)
+	if err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	newRefreshToken, err := generateSecureToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshExpiresAt := time.Now().Add(s.sessionTTL(user))
+	if err := s.sessionRepo.RotateRefreshToken(session.ID, tokenHash, hashToken(newRefreshToken), refreshExpiresAt); err != nil {
+		return nil, nil, errors.New("invalid or expired refresh token")
+	}
+
+	// An active guest keeps pushing its expiry forward
+	if user.IsGuest {
+		if err := s.userRepo.ExtendGuestExpiry(user.NumericID, time.Now().Add(s.guestTTL)); err != nil {
+			log.Printf("Error extending guest %d expiry: %v", user.NumericID, err)
+		}
+	}
+
+	accessExpiresAt := time.Now().Add(s.accessTokenTTL)
+	accessToken, err := s.generateToken(user, session.ID.Hex(), accessExpiresAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, &entity.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    accessExpiresAt,
+	}, nil
+}
+
+func (s *implAuthService) Logout(sessionID string) error {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return errors.New("invalid session ID")
+	}
+
+	return s.revokeSession(id)
+}
+
+func (s *implAuthService) LogoutAll(userID int64) error {
+	return s.revokeUserSessions(userID, nil)
+}
+
+func (s *implAuthService) GetSessions(userID int64, currentSessionID string) ([]*entity.Session, error) {
+	sessions, err := s.sessionRepo.GetActiveSessionsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID.Hex() == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+func (s *implAuthService) RevokeSession(userID int64, sessionID string) error {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return errors.New("invalid session ID")
+	}
+
+	session, err := s.sessionRepo.GetSessionByID(id)
+	if err != nil || session.UserID != userID {
+		return errors.New("session not found")
+	}
+
+	return s.revokeSession(id)
+}
+
+func (s *implAuthService) createSession(user *entity.User, client ClientInfo) (*entity.TokenPair, error) {
+	refreshToken, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &entity.Session{
+		UserID:           user.NumericID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        client.UserAgent,
+		IP:               client.IP,
+		ExpiresAt:        time.Now().Add(s.sessionTTL(user)),
+	}
+
+	if err := s.sessionRepo.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	accessExpiresAt := time.Now().Add(s.accessTokenTTL)
+	accessToken, err := s.generateToken(user, session.ID.Hex(), accessExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    accessExpiresAt,
+	}, nil
+}
+
+// sessionTTL keeps guest sessions from outliving the guest account itself
+func (s *implAuthService) sessionTTL(user *entity.User) time.Duration {
+	if user.IsGuest && s.guestTTL < s.refreshTokenTTL {
+		return s.guestTTL
+	}
+	return s.refreshTokenTTL
+}
+
+func (s *implAuthService) getActiveSession(sessionID string) (*entity.Session, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, errors.New("invalid session")
+	}
+
+	session, err := s.sessionRepo.GetSessionByID(id)
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, errors.New("session has been revoked")
+	}
+
+	return session, nil
+}
+
+func (s *implAuthService) revokeSession(id primitive.ObjectID) error {
+	if err := s.sessionRepo.RevokeSession(id); err != nil {
+		return err
+	}
+
+	s.sessions.forgetSession(id.Hex())
+	s.roomService.DisconnectSession(id.Hex())
+	return nil
+}
+
+func (s *implAuthService) revokeUserSessions(userID int64, exceptID *primitive.ObjectID) error {
+	revoked, err := s.sessionRepo.RevokeUserSessions(userID, exceptID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range revoked {
+		s.sessions.forgetSession(id.Hex())
+		s.roomService.DisconnectSession(id.Hex())
+	}
+
+	return nil
+}
+
+func (s *implAuthService) ChangePassword(userID int64, currentSessionID, currentPassword, newPassword string) error {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.IsGuest {
+		return errors.New("guest accounts do not have a password")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return errors.New("current password is incorrect")
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return err
+	}
+
+	// Keep the device that changed the password signed in
+	var exceptID *primitive.ObjectID
+	if id, err := primitive.ObjectIDFromHex(currentSessionID); err == nil {
+		exceptID = &id
+	}
+
+	return s.revokeUserSessions(userID, exceptID)
+}
+
+// RequestPasswordReset always succeeds for unknown emails so callers cannot probe which accounts exist
+func (s *implAuthService) RequestPasswordReset(email string) error {
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil || user.IsGuest {
+		return nil
+	}
+
+	// Only the most recent reset link stays valid
+	if err := s.tokenRepo.DeleteTokensByUser(user.NumericID, entity.PasswordResetToken); err != nil {
+		return err
+	}
+
+	token, err := s.issueAuthToken(user, entity.PasswordResetToken, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to reset your password. It expires in %s.\n\n%s/reset-password?token=%s\n\nIf you did not request this, you can ignore this email.",
+			user.Name, passwordResetTTL, os.Getenv("FRONTEND_URL"), token),
+	})
+}
+
+func (s *implAuthService) ResetPassword(token, newPassword string) error {
+	authToken, err := s.redeemAuthToken(entity.PasswordResetToken, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByNumericID(authToken.UserID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return err
+	}
+
+	// Proving control of the mailbox is how a locked out owner gets back in
+	s.loginGuard.ClearLockout(user.Username)
+
+	// Whoever knew the old password should not stay signed in
+	return s.revokeUserSessions(user.NumericID, nil)
+}
+
+func (s *implAuthService) SendVerificationEmail(userID int64) error {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.Email == "" {
+		return errors.New("no email address on this account")
+	}
+
+	if user.EmailVerified {
+		return errors.New("email is already verified")
+	}
+
+	if err := s.tokenRepo.DeleteTokensByUser(user.NumericID, entity.EmailVerificationToken); err != nil {
+		return err
+	}
+
+	token, err := s.issueAuthToken(user, entity.EmailVerificationToken, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below. It expires in %s.\n\n%s/verify-email?token=%s",
+			user.Name, emailVerificationTTL, os.Getenv("FRONTEND_URL"), token),
+	})
+}
+
+func (s *implAuthService) VerifyEmail(token string) error {
+	authToken, err := s.redeemAuthToken(entity.EmailVerificationToken, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByNumericID(authToken.UserID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	// The address may have changed since the link was sent
+	if user.Email != authToken.Email {
+		return errors.New("invalid or expired token")
+	}
+
+	user.EmailVerified = true
+	return s.userRepo.UpdateUser(user)
+}
+
+func (s *implAuthService) setPassword(user *entity.User, password string) error {
+	if len(password) < 6 {
+		return errors.New("password must be at least 6 characters")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.Password = string(hashedPassword)
+	return s.userRepo.UpdateUser(user)
+}
+
+// issueAuthToken stores a hashed single-use token and returns the raw value to send to the user
+func (s *implAuthService) issueAuthToken(user *entity.User, purpose entity.AuthTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	authToken := &entity.AuthToken{
+		UserID:    user.NumericID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := s.tokenRepo.CreateToken(authToken); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *implAuthService) redeemAuthToken(purpose entity.AuthTokenPurpose, token string) (*entity.AuthToken, error) {
+	authToken, err := s.tokenRepo.GetTokenByHash(purpose, hashToken(token))
+	if err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	if authToken.UsedAt != nil || time.Now().After(authToken.ExpiresAt) {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	if err := s.tokenRepo.MarkTokenUsed(authToken.ID); err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	return authToken, nil
+}
+
+func generateSecureToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// envDuration reads a duration such as "15m" or "720h" from the environment
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+
+	return duration
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *implAuthService) issueTwoFactorChallenge(user *entity.User) (*entity.TwoFactorChallenge, error) {
+	token, err := s.issueAuthToken(user, entity.TwoFactorChallengeToken, twoFactorChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.TwoFactorChallenge{
+		ChallengeToken: token,
+		ExpiresAt:      time.Now().Add(twoFactorChallengeTTL),
+	}, nil
+}
+
+// CompleteTwoFactorLogin finishes a login started with a password, accepting either a TOTP code or a recovery code
+func (s *implAuthService) CompleteTwoFactorLogin(challengeToken, code string, client ClientInfo) (*entity.User, *entity.TokenPair, error) {
+	// The challenge is only redeemed once the code is right, so a typo does not force a new password login
+	challenge, err := s.tokenRepo.GetTokenByHash(entity.TwoFactorChallengeToken, hashToken(challengeToken))
+	if err != nil || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, nil, errors.New("invalid or expired challenge")
+	}
+
+	user, err := s.userRepo.GetUserByNumericID(challenge.UserID)
+	if err != nil || !user.TwoFactorEnabled {
+		return nil, nil, errors.New("invalid or expired challenge")
+	}
+
+	// Code guesses count towards the same lockout as password guesses
+	if err := s.loginGuard.Allow(user.Username, ""); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.verifySecondFactor(user, code, true); err != nil {
+		s.loginGuard.RecordFailure(user.Username, "")
+		return nil, nil, err
+	}
+
+	if err := s.tokenRepo.MarkTokenUsed(challenge.ID); err != nil {
+		return nil, nil, errors.New("invalid or expired challenge")
+	}
+
+	s.loginGuard.RecordSuccess(user.Username)
+
+	tokens, err := s.createSession(user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// BeginTwoFactorSetup generates a new secret; it only takes effect once EnableTwoFactor confirms a code from it
+func (s *implAuthService) BeginTwoFactorSetup(userID int64) (*entity.TwoFactorSetup, error) {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.IsGuest {
+		return nil, errors.New("guest accounts cannot enable two-factor authentication")
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TwoFactorSecret = secret
+	user.TwoFactorLastStep = 0
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+
+	return &entity.TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURI: totpURI(totpIssuer(), account, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirms the pending secret with a code and returns the recovery codes, shown only this once
+func (s *implAuthService) EnableTwoFactor(userID int64, code string) ([]string, error) {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	if user.TwoFactorSecret == "" {
+		return nil, errors.New("start two-factor setup first")
+	}
+
+	if err := s.verifySecondFactor(user, code, false); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload so the step recorded by verifySecondFactor is not overwritten
+	user, err = s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	user.TwoFactorEnabled = true
+	user.RecoveryCodes = hashes
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor requires both the password and a current code or recovery code
+func (s *implAuthService) DisableTwoFactor(userID int64, password, code string) error {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if !user.TwoFactorEnabled {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return errors.New("password is incorrect")
+	}
+
+	if err := s.verifySecondFactor(user, code, true); err != nil {
+		return err
+	}
+
+	user, err = s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	user.TwoFactorEnabled = false
+	user.TwoFactorSecret = ""
+	user.TwoFactorLastStep = 0
+	user.RecoveryCodes = nil
+	return s.userRepo.UpdateUser(user)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code; it needs a TOTP code because a lost recovery code may be why it is called
+func (s *implAuthService) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+
+	if err := s.verifySecondFactor(user, code, false); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	user.RecoveryCodes = hashes
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts a TOTP code once per time step, and optionally a single-use recovery code
+func (s *implAuthService) verifySecondFactor(user *entity.User, code string, allowRecovery bool) error {
+	if step, ok := validateTOTP(user.TwoFactorSecret, code, s.now()); ok {
+		fresh, err := s.userRepo.AdvanceTwoFactorStep(user.NumericID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errors.New("code has already been used, wait for the next one")
+		}
+		return nil
+	}
+
+	if allowRecovery {
+		used, err := s.userRepo.ConsumeRecoveryCode(user.NumericID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if used {
+			log.Printf("User %d signed in with a recovery code", user.NumericID)
+			return nil
+		}
+	}
+
+	return errors.New("invalid authentication code")
+}
+
+// generateRecoveryCodes returns the codes to show the user and the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		secret, err := generateTOTPSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(secret[:10])
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// totpIssuer is the account name prefix shown in authenticator apps
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Chat"
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxBotsPerOwner = 10
+
+// BotService manages bot accounts and the API tokens scripts and bots authenticate with
+type BotService interface {
+	CreateBot(ownerID int64, username, name string) (*entity.User, error)
+	GetBots(ownerID int64) ([]*entity.User, error)
+	DeleteBot(ownerID, botID int64) error
+
+	// CreateAPIToken returns the stored token and the plaintext, which is shown only once
+	CreateAPIToken(requesterID, userID int64, name string, scopes []string, expiresAt *time.Time) (*entity.APIToken, string, error)
+	GetAPITokens(requesterID int64) ([]*entity.APIToken, error)
+	RevokeAPIToken(requesterID int64, tokenID string) error
+}
+
+type implBotService struct {
+	userRepo     repository.UserRepository
+	apiTokenRepo repository.APITokenRepository
+	chatRepo     repository.ChatRepository
+	roomService  RoomService
+}
+
+func NewBotService(
+	userRepo repository.UserRepository,
+	apiTokenRepo repository.APITokenRepository,
+	chatRepo repository.ChatRepository,
+	roomService RoomService,
+) BotService {
+	return &implBotService{
+		userRepo:     userRepo,
+		apiTokenRepo: apiTokenRepo,
+		chatRepo:     chatRepo,
+		roomService:  roomService,
+	}
+}
+
+func (s *implBotService) CreateBot(ownerID int64, username, name string) (*entity.User, error) {
+	owner, err := s.userRepo.GetUserByNumericID(ownerID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if owner.IsGuest || owner.IsBot {
+		return nil, errors.New("only registered users can create bots")
+	}
+
+	bots, err := s.userRepo.GetBotsByOwner(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(bots) >= maxBotsPerOwner {
+		return nil, fmt.Errorf("you can own at most %d bots", maxBotsPerOwner)
+	}
+
+	if existing, _ := s.userRepo.GetUserByUsername(username); existing != nil {
+		return nil, errors.New("username already exists")
+	}
+
+	// Bots have no password; they can only authenticate with API tokens
+	bot := &entity.User{
+		Username:   username,
+		Name:       name,
+		IsBot:      true,
+		BotOwnerID: ownerID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := s.userRepo.CreateUser(bot); err != nil {
+		return nil, err
+	}
+
+	return bot, nil
+}
+
+func (s *implBotService) GetBots(ownerID int64) ([]*entity.User, error) {
+	return s.userRepo.GetBotsByOwner(ownerID)
+}
+
+// DeleteBot revokes the bot's tokens and removes it from its chats; its messages stay, marked as sent by a bot
+func (s *implBotService) DeleteBot(ownerID, botID int64) error {
+	bot, err := s.getOwnedBot(ownerID, botID)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.apiTokenRepo.RevokeAPITokensByUser(bot.NumericID)
+	if err != nil {
+		return err
+	}
+	for _, id := range revoked {
+		s.roomService.DisconnectSession(apiTokenSessionID(id))
+	}
+
+	if err := s.chatRepo.RemoveMembershipsByUser(bot.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.AnonymizeMessagesByUser(bot.NumericID); err != nil {
+		return err
+	}
+
+	return s.userRepo.DeleteUser(bot.ID)
+}
+
+func (s *implBotService) getOwnedBot(ownerID, botID int64) (*entity.User, error) {
+	bot, err := s.userRepo.GetUserByNumericID(botID)
+	if err != nil || !bot.IsBot || bot.BotOwnerID != ownerID {
+		return nil, errors.New("bot not found")
+	}
+	return bot, nil
+}
+
+func (s *implBotService) CreateAPIToken(requesterID, userID int64, name string, scopes []string, expiresAt *time.Time) (*entity.APIToken, string, error) {
+	requester, err := s.userRepo.GetUserByNumericID(requesterID)
+	if err != nil {
+		return nil, "", errors.New("user not found")
+	}
+
+	if requester.IsGuest || requester.IsBot {
+		return nil, "", errors.New("only registered users can create API tokens")
+	}
+
+	// Tokens act either as the requester or as one of their bots
+	if userID != requesterID {
+		if _, err := s.getOwnedBot(requesterID, userID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !isValidScope(scope) {
+			return nil, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return nil, "", errors.New("expiry must be in the future")
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := entity.APITokenPrefix + secret
+
+	token := &entity.APIToken{
+		UserID:    userID,
+		CreatedBy: requesterID,
+		Name:      name,
+		Prefix:    plaintext[:len(entity.APITokenPrefix)+6],
+		TokenHash: hashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.apiTokenRepo.CreateAPIToken(token); err != nil {
+		return nil, "", err
+	}
+
+	return token, plaintext, nil
+}
+
+// GetAPITokens lists the active tokens of the requester and of their bots
+func (s *implBotService) GetAPITokens(requesterID int64) ([]*entity.APIToken, error) {
+	userIDs := []int64{requesterID}
+
+	bots, err := s.userRepo.GetBotsByOwner(requesterID)
+	if err != nil {
+		return nil, err
+	}
+	for _, bot := range bots {
+		userIDs = append(userIDs, bot.NumericID)
+	}
+
+	return s.apiTokenRepo.GetAPITokensByUsers(userIDs)
+}
+
+func (s *implBotService) RevokeAPIToken(requesterID int64, tokenID string) error {
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return errors.New("token not found")
+	}
+
+	token, err := s.apiTokenRepo.GetAPITokenByID(id)
+	if err != nil || token.CreatedBy != requesterID {
+		return errors.New("token not found")
+	}
+
+	if err := s.apiTokenRepo.RevokeAPIToken(id); err != nil {
+		return err
+	}
+
+	// Close a WebSocket the token may have opened
+	s.roomService.DisconnectSession(apiTokenSessionID(id))
+	log.Printf("API token %s revoked by user %d", token.Prefix, requesterID)
+	return nil
+}
+
+// apiTokenSessionID is the session ID connections authenticated with an API token are bound to
+func apiTokenSessionID(id primitive.ObjectID) string {
+	return "api:" + id.Hex()
+}
+
+// APITokenSessionID exposes the binding for the auth middleware
+func APITokenSessionID(token *entity.APIToken) string {
+	return apiTokenSessionID(token.ID)
+}
+
+func isValidScope(scope string) bool {
+	for _, s := range entity.APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
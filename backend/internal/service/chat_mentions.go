@@ -0,0 +1,156 @@
+package service
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+const (
+	// maxMentionsPerMessage bounds the username lookups a single message can trigger
+	maxMentionsPerMessage = 50
+	everyoneMention       = "everyone"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// parseMentions returns the distinct usernames mentioned in content, in order of appearance
+func parseMentions(content string) []string {
+	seen := make(map[string]bool)
+	var usernames []string
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// Sentence punctuation directly after a mention is not part of the name
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+
+		if len(usernames) == maxMentionsPerMessage {
+			break
+		}
+	}
+
+	return usernames
+}
+
+// resolveMentions sets Mentions and MentionsEveryone on the message from its content, as written
+// by writerID. Only chat members can be mentioned, and @everyone only counts when the writer is
+// a chat admin at the time of writing.
+func (s *implChatService) resolveMentions(message *entity.Message, writerID int64) {
+	message.Mentions = nil
+	message.MentionsEveryone = false
+
+	if message.Type == entity.System {
+		return
+	}
+
+	usernames := parseMentions(message.Content)
+	if len(usernames) == 0 {
+		return
+	}
+
+	seen := make(map[int64]bool)
+	for _, username := range usernames {
+		if username == everyoneMention {
+			if writerID != 0 && ensureChatAdmin(s.chatRepository, message.ChatID, writerID) == nil {
+				message.MentionsEveryone = true
+			}
+			continue
+		}
+
+		user, err := s.userRepository.GetUserByUsername(username)
+		if err != nil || seen[user.NumericID] {
+			continue
+		}
+		if isMember, err := s.chatRepository.IsChatMember(message.ChatID, user.NumericID); err != nil || !isMember {
+			continue
+		}
+
+		seen[user.NumericID] = true
+		message.Mentions = append(message.Mentions, user.NumericID)
+	}
+
+	if message.MentionsEveryone {
+		members, err := s.chatRepository.GetChatMembers(message.ChatID)
+		if err != nil {
+			log.Printf("Error loading members of chat %d for @everyone: %v", message.ChatID, err)
+			return
+		}
+		for _, member := range members {
+			if !seen[member.UserID] {
+				seen[member.UserID] = true
+				message.Mentions = append(message.Mentions, member.UserID)
+			}
+		}
+	}
+}
+
+// notifyMentions notifies mentioned users who have not been notified about the message yet
+// and returns the updated set of notified users
+func (s *implChatService) notifyMentions(message *entity.Message, notified map[int64]bool) map[int64]bool {
+	if notified == nil {
+		notified = make(map[int64]bool)
+	}
+
+	for _, userID := range message.Mentions {
+		if userID == message.CreatedBy || notified[userID] {
+			continue
+		}
+		notified[userID] = true
+
+		s.notificationService.SendNotification(&entity.Notification{
+			RecipientID: userID,
+			SenderID:    message.CreatedBy,
+			Type:        entity.MessageMention,
+			Status:      entity.NotificationUnread,
+			Title:       authorName(message) + " mentioned you",
+			Message:     snippet(message.Content, 100),
+			ReferenceID: &message.ID,
+		})
+	}
+
+	return notified
+}
+
+// notifyReplyTarget tells the author of the replied-to message about the reply, unless already notified.
+// System messages such as pin announcements point at a message without being a reply to it
+func (s *implChatService) notifyReplyTarget(message *entity.Message, notified map[int64]bool) {
+	if message.ReplyToID == nil || message.Type == entity.System {
+		return
+	}
+
+	target, err := s.chatRepository.GetMessageByID(*message.ReplyToID)
+	if err != nil || target.ChatID != message.ChatID {
+		return
+	}
+	if target.CreatedBy == 0 || target.CreatedBy == message.CreatedBy || notified[target.CreatedBy] {
+		return
+	}
+	notified[target.CreatedBy] = true
+
+	s.notificationService.SendNotification(&entity.Notification{
+		RecipientID: target.CreatedBy,
+		SenderID:    message.CreatedBy,
+		Type:        entity.MessageReply,
+		Status:      entity.NotificationUnread,
+		Title:       authorName(message) + " replied to your message",
+		Message:     snippet(message.Content, 100),
+		ReferenceID: &message.ID,
+	})
+}
+
+// authorName is the name shown for a message's author in notifications
+func authorName(message *entity.Message) string {
+	if message.CreatedByUser != nil {
+		return message.CreatedByUser.Username
+	}
+	if message.DisplayName != "" {
+		return message.DisplayName
+	}
+	return "Someone"
+}
@@ -1,10 +1,21 @@
 package service
 
 import (
+	"errors"
+	"log"
+	"time"
+
 	"github.com/rufflogix/computer-network-project/internal/entity"
 	"github.com/rufflogix/computer-network-project/internal/repository"
 )
 
+var (
+	ErrMutedInChat      = errors.New("you are muted in this chat")
+	ErrThreadNotFound   = errors.New("thread not found")
+	ErrNotChatMember    = errors.New("you are not a member of this chat")
+	ErrNotMessageAuthor = errors.New("only the author can change this message")
+)
+
 type ChatService interface {
 	// Chat operations
 	CreateChat(chat *entity.Chat) error
@@ -15,15 +26,28 @@ type ChatService interface {
 
 	// Message operations
 	SendMessage(message *entity.Message) error
-	GetMessages(chatID int64, limit, offset int) ([]*entity.Message, error)
-	EditMessage(messageID int64, content string) error
-	DeleteMessage(messageID int64) error
+	GetMessage(messageID int64) (*entity.Message, error)
+	// GetMessages lists a chat's messages for userID, who must be a member unless the chat is public
+	GetMessages(userID, chatID int64, limit, offset int) ([]*entity.Message, error)
+	GetMentions(userID int64, limit, offset int) ([]*entity.Message, error)
+	// EditMessage replaces the content of a message on behalf of its author and returns the updated message
+	EditMessage(editorID, messageID int64, content string) (*entity.Message, error)
+	// DeleteMessage removes a message on behalf of its author
+	DeleteMessage(userID, messageID int64) error
+	// RegisterUpload records the user as owner of a file just stored in the uploads directory;
+	// only messages from the owner can claim it
+	RegisterUpload(userID int64, filename string) error
 
 	// Reaction operations
 	AddReaction(reaction *entity.Reaction, userID int64) error
 	RemoveReaction(reactionID int64, userID int64) error
 	GetMessageReactions(messageID int64) ([]*entity.Reaction, error)
 
+	// Thread operations
+	GetThread(userID, rootID int64, limit, offset int) (*entity.Thread, error)
+	FollowThread(userID, rootID int64) error
+	UnfollowThread(userID, rootID int64) error
+
 	// Member operations
 	AddMember(chatID, userID int64, role string) error
 	RemoveMember(chatID, userID int64) error
@@ -31,14 +55,32 @@ type ChatService interface {
 }
 
 type implChatService struct {
-	chatRepository repository.ChatRepository
-	userRepository repository.UserRepository
+	chatRepository      repository.ChatRepository
+	userRepository      repository.UserRepository
+	threadRepository    repository.ThreadRepository
+	uploadRepository    repository.UploadRepository
+	notificationService NotificationService
+	webhookService      WebhookService
+	linkPreviews        LinkPreviewService
 }
 
-func NewChatService(chatRepository repository.ChatRepository, userRepository repository.UserRepository) ChatService {
+func NewChatService(
+	chatRepository repository.ChatRepository,
+	userRepository repository.UserRepository,
+	threadRepository repository.ThreadRepository,
+	uploadRepository repository.UploadRepository,
+	notificationService NotificationService,
+	webhookService WebhookService,
+	linkPreviews LinkPreviewService,
+) ChatService {
 	return &implChatService{
-		chatRepository: chatRepository,
-		userRepository: userRepository,
+		chatRepository:      chatRepository,
+		userRepository:      userRepository,
+		threadRepository:    threadRepository,
+		uploadRepository:    uploadRepository,
+		notificationService: notificationService,
+		webhookService:      webhookService,
+		linkPreviews:        linkPreviews,
 	}
 }
 
@@ -98,20 +140,204 @@ func (s *implChatService) GetAllChats() ([]*entity.Chat, error) {
 
 // Message operations
 func (s *implChatService) SendMessage(message *entity.Message) error {
-	if err := s.chatRepository.CreateMessage(message); err != nil {
+	// Poll messages carry their options and are only created through the poll service
+	if message.Type == entity.Poll && message.Poll == nil {
+		return errors.New("polls must be created through the polls endpoint")
+	}
+	if err := formatMessage(message); err != nil {
 		return err
 	}
 
+	// System messages (joins, leaves, ...) are written on behalf of the user and are never blocked
+	if message.CreatedBy != 0 && message.Type != entity.System {
+		member, err := s.chatRepository.GetChatMember(message.ChatID, message.CreatedBy)
+		if err != nil {
+			return ErrNotChatMember
+		}
+		if member.MutedUntil != nil && time.Now().Before(*member.MutedUntil) {
+			return ErrMutedInChat
+		}
+	}
+
 	if message.CreatedBy != 0 {
 		if user, err := s.userRepository.GetUserByNumericID(message.CreatedBy); err == nil {
 			message.CreatedByUser = user
+			message.SentByBot = user.IsBot
+		}
+	}
+
+	var root *entity.Message
+	if message.ThreadID != nil {
+		var err error
+		if root, err = s.threadRoot(message); err != nil {
+			return err
 		}
 	}
 
+	s.resolveMentions(message, message.CreatedBy)
+	s.setExpiry(message, root)
+
+	// Cached previews go out with the message, the rest follow in a message_updated event
+	var pendingLinks []string
+	if message.Type != entity.System && message.Type != entity.Poll {
+		message.LinkPreviews, pendingLinks = s.linkPreviews.CachedPreviews(message.Content)
+	}
+
+	if err := s.chatRepository.CreateMessage(message); err != nil {
+		return err
+	}
+	s.linkPreviews.FetchAsync(message, pendingLinks)
+	if message.CreatedBy != 0 {
+		claimUploads(s.uploadRepository, message.CreatedBy, messageUploadRef(message.ID), uploadNames(message.MediaURL, message.Attachments))
+	}
+
+	notified := s.notifyMentions(message, nil)
+	s.notifyReplyTarget(message, notified)
+	if root != nil {
+		s.recordThreadReply(root, message, notified)
+	}
+
+	s.webhookService.Publish(message.ChatID, entity.WebhookMessageSent, messageEventData(message))
 	return nil
 }
 
-func (s *implChatService) GetMessages(chatID int64, limit, offset int) ([]*entity.Message, error) {
+// setExpiry applies the chat's disappearing message timer; thread replies never outlive their root
+func (s *implChatService) setExpiry(message *entity.Message, root *entity.Message) {
+	if chat, err := s.chatRepository.GetChatByID(message.ChatID); err == nil && chat.MessageTTL > 0 {
+		expiresAt := time.Now().Add(time.Duration(chat.MessageTTL) * time.Second)
+		message.ExpiresAt = &expiresAt
+	}
+
+	if root != nil && root.ExpiresAt != nil && (message.ExpiresAt == nil || root.ExpiresAt.Before(*message.ExpiresAt)) {
+		expiresAt := *root.ExpiresAt
+		message.ExpiresAt = &expiresAt
+	}
+}
+
+// threadRoot validates a reply's thread and points it at the root; replies to replies join the same thread
+func (s *implChatService) threadRoot(message *entity.Message) (*entity.Message, error) {
+	root, err := s.chatRepository.GetMessageByID(*message.ThreadID)
+	if err != nil {
+		return nil, ErrThreadNotFound
+	}
+
+	if root.ThreadID != nil {
+		if root, err = s.chatRepository.GetMessageByID(*root.ThreadID); err != nil {
+			return nil, ErrThreadNotFound
+		}
+	}
+
+	if root.ChatID != message.ChatID || root.Type == entity.System {
+		return nil, errors.New("cannot reply in this thread")
+	}
+
+	message.ThreadID = &root.ID
+	return root, nil
+}
+
+// recordThreadReply updates the root's reply metadata, subscribes the participants and notifies
+// followers who were not already notified about the reply
+func (s *implChatService) recordThreadReply(root, reply *entity.Message, notified map[int64]bool) {
+	updated, err := s.chatRepository.IncrementThreadReply(root.ID, reply.CreatedAt, reply.CreatedBy)
+	if err != nil {
+		log.Printf("Error updating thread %d: %v", root.ID, err)
+		return
+	}
+	reply.Thread = threadSummary(updated)
+
+	// The root author follows from the first reply on; repliers follow when they reply
+	if updated.ThreadReplyCount == 1 && root.CreatedBy != 0 {
+		s.followThread(root, root.CreatedBy)
+	}
+	if reply.CreatedBy != 0 {
+		s.followThread(root, reply.CreatedBy)
+	}
+
+	followers, err := s.threadRepository.GetThreadFollowers(root.ID)
+	if err != nil {
+		log.Printf("Error loading followers of thread %d: %v", root.ID, err)
+		return
+	}
+
+	for _, followerID := range followers {
+		if followerID == reply.CreatedBy || notified[followerID] {
+			continue
+		}
+
+		s.notificationService.SendNotification(&entity.Notification{
+			RecipientID: followerID,
+			SenderID:    reply.CreatedBy,
+			Type:        entity.MessageReply,
+			Status:      entity.NotificationUnread,
+			Title:       authorName(reply) + " replied in a thread",
+			Message:     snippet(reply.Content, 100),
+			ReferenceID: &root.ID,
+		})
+	}
+}
+
+func (s *implChatService) followThread(root *entity.Message, userID int64) {
+	err := s.threadRepository.FollowThread(&entity.ThreadFollow{
+		RootID: root.ID,
+		ChatID: root.ChatID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error following thread %d for user %d: %v", root.ID, userID, err)
+	}
+}
+
+func threadSummary(root *entity.Message) *entity.ThreadSummary {
+	return &entity.ThreadSummary{
+		RootID:      root.ID,
+		ReplyCount:  root.ThreadReplyCount,
+		LastReplyAt: root.ThreadLastReplyAt,
+		LastReplyBy: root.ThreadLastReplyBy,
+	}
+}
+
+// snippet shortens text for notification previews
+func snippet(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "…"
+}
+
+// GetMentions lists messages mentioning the user in chats they are still a member of
+func (s *implChatService) GetMentions(userID int64, limit, offset int) ([]*entity.Message, error) {
+	chats, err := s.chatRepository.GetChatsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	chatIDs := make([]int64, 0, len(chats))
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ID)
+	}
+	if len(chatIDs) == 0 {
+		return []*entity.Message{}, nil
+	}
+
+	return s.chatRepository.GetMentions(userID, chatIDs, limit, offset)
+}
+
+func (s *implChatService) GetMessage(messageID int64) (*entity.Message, error) {
+	return s.chatRepository.GetMessageByID(messageID)
+}
+
+func (s *implChatService) GetMessages(userID, chatID int64, limit, offset int) ([]*entity.Message, error) {
+	chat, err := s.chatRepository.GetChatByID(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.IsPublic {
+		if isMember, err := s.chatRepository.IsChatMember(chatID, userID); err != nil || !isMember {
+			return nil, ErrNotChatMember
+		}
+	}
+
 	messages, err := s.chatRepository.GetMessagesByChat(chatID, limit, offset)
 	if err != nil {
 		return nil, err
@@ -130,47 +356,248 @@ func (s *implChatService) GetMessages(chatID int64, limit, offset int) ([]*entit
 	return messages, nil
 }
 
-func (s *implChatService) EditMessage(messageID int64, content string) error {
+func (s *implChatService) EditMessage(editorID, messageID int64, content string) (*entity.Message, error) {
 	message, err := s.chatRepository.GetMessageByID(messageID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if message.CreatedBy != editorID {
+		return nil, ErrNotMessageAuthor
+	}
+
+	previous := make(map[int64]bool, len(message.Mentions))
+	for _, userID := range message.Mentions {
+		previous[userID] = true
 	}
 
 	message.Content = content
-	return s.chatRepository.UpdateMessage(message)
+	if err := formatMessage(message); err != nil {
+		return nil, err
+	}
+	s.resolveMentions(message, editorID)
+	if err := s.chatRepository.UpdateMessage(message); err != nil {
+		return nil, err
+	}
+
+	if user, err := s.userRepository.GetUserByNumericID(message.CreatedBy); err == nil {
+		message.CreatedByUser = user
+	}
+
+	// Only users newly mentioned by the edit are notified
+	s.notifyMentions(message, previous)
+	s.webhookService.Publish(message.ChatID, entity.WebhookMessageEdited, messageEventData(message))
+	return message, nil
+}
+
+func (s *implChatService) DeleteMessage(userID, messageID int64) error {
+	message, err := s.chatRepository.GetMessageByID(messageID)
+	if err != nil {
+		return err
+	}
+	if message.CreatedBy != userID {
+		return ErrNotMessageAuthor
+	}
+
+	if err := s.chatRepository.DeleteMessage(messageID); err != nil {
+		return err
+	}
+
+	if message.ThreadID != nil {
+		if _, err := s.chatRepository.RecountThread(*message.ThreadID); err != nil {
+			log.Printf("Error recounting thread %d: %v", *message.ThreadID, err)
+		}
+	} else if message.ThreadReplyCount > 0 {
+		// Replies cannot be reached once their root is gone
+		if err := s.chatRepository.DeleteMessagesByThread(message.ID); err != nil {
+			log.Printf("Error deleting replies of thread %d: %v", message.ID, err)
+		}
+		if err := s.threadRepository.DeleteThreadFollows(message.ID); err != nil {
+			log.Printf("Error deleting follows of thread %d: %v", message.ID, err)
+		}
+	}
+
+	if message.Poll != nil {
+		if err := s.chatRepository.DeletePollVotesByMessages([]int64{message.ID}); err != nil {
+			log.Printf("Error deleting votes of poll %d: %v", message.ID, err)
+		}
+	}
+
+	s.webhookService.Publish(message.ChatID, entity.WebhookMessageDeleted, map[string]interface{}{"message_id": messageID})
+	return nil
 }
 
-func (s *implChatService) DeleteMessage(messageID int64) error {
-	return s.chatRepository.DeleteMessage(messageID)
+func (s *implChatService) RegisterUpload(userID int64, filename string) error {
+	return s.uploadRepository.CreateUpload(&entity.Upload{Filename: filename, OwnerID: userID})
 }
 
 // Reaction operations
 func (s *implChatService) AddReaction(reaction *entity.Reaction, userID int64) error {
 	// For the new count-based model, we don't need toggle logic here
 	// The repository handles adding users to reaction counts
-	return s.chatRepository.CreateReaction(reaction, userID)
+	if err := s.chatRepository.CreateReaction(reaction, userID); err != nil {
+		return err
+	}
+
+	s.publishReaction(entity.WebhookReactionAdded, reaction, userID)
+	return nil
 }
 
 func (s *implChatService) RemoveReaction(reactionID int64, userID int64) error {
-	return s.chatRepository.DeleteReaction(reactionID)
+	reaction, err := s.chatRepository.GetReactionByID(reactionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.chatRepository.DeleteReaction(reactionID); err != nil {
+		return err
+	}
+
+	s.publishReaction(entity.WebhookReactionRemoved, reaction, userID)
+	return nil
+}
+
+func (s *implChatService) publishReaction(event string, reaction *entity.Reaction, userID int64) {
+	message, err := s.chatRepository.GetMessageByID(reaction.MessageID)
+	if err != nil {
+		return
+	}
+
+	s.webhookService.Publish(message.ChatID, event, map[string]interface{}{
+		"message_id": reaction.MessageID,
+		"reaction":   reaction.Type,
+		"user_id":    userID,
+	})
 }
 
 func (s *implChatService) GetMessageReactions(messageID int64) ([]*entity.Reaction, error) {
 	return s.chatRepository.GetReactionsByMessage(messageID)
 }
 
+// Thread operations
+func (s *implChatService) GetThread(userID, rootID int64, limit, offset int) (*entity.Thread, error) {
+	root, err := s.accessibleThreadRoot(userID, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := s.chatRepository.GetThreadMessages(root.ID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if root.CreatedBy != 0 {
+		if user, err := s.userRepository.GetUserByNumericID(root.CreatedBy); err == nil {
+			root.CreatedByUser = user
+		}
+	}
+	for _, reply := range replies {
+		if reply.CreatedByUser == nil && reply.CreatedBy != 0 {
+			if user, err := s.userRepository.GetUserByNumericID(reply.CreatedBy); err == nil {
+				reply.CreatedByUser = user
+			}
+		}
+	}
+
+	following, err := s.threadRepository.IsFollowingThread(root.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.Thread{Root: root, Replies: replies, Following: following}, nil
+}
+
+func (s *implChatService) FollowThread(userID, rootID int64) error {
+	root, err := s.accessibleThreadRoot(userID, rootID)
+	if err != nil {
+		return err
+	}
+
+	return s.threadRepository.FollowThread(&entity.ThreadFollow{
+		RootID: root.ID,
+		ChatID: root.ChatID,
+		UserID: userID,
+	})
+}
+
+func (s *implChatService) UnfollowThread(userID, rootID int64) error {
+	return s.threadRepository.UnfollowThread(rootID, userID)
+}
+
+// accessibleThreadRoot loads a root message the user can read: its chat is public or they are a member
+func (s *implChatService) accessibleThreadRoot(userID, rootID int64) (*entity.Message, error) {
+	root, err := s.chatRepository.GetMessageByID(rootID)
+	if err != nil {
+		return nil, ErrThreadNotFound
+	}
+	if root.ThreadID != nil {
+		return nil, errors.New("message is a reply, open its thread instead")
+	}
+
+	chat, err := s.chatRepository.GetChatByID(root.ChatID)
+	if err != nil {
+		return nil, ErrThreadNotFound
+	}
+
+	if !chat.IsPublic {
+		if isMember, err := s.chatRepository.IsChatMember(chat.ID, userID); err != nil || !isMember {
+			return nil, ErrThreadNotFound
+		}
+	}
+
+	return root, nil
+}
+
 // Member operations
 func (s *implChatService) AddMember(chatID, userID int64, role string) error {
+	// Re-adding an existing member is a no-op and must not announce a join
+	if isMember, err := s.chatRepository.IsChatMember(chatID, userID); err == nil && isMember {
+		return nil
+	}
+
 	member := &entity.ChatMember{
 		ChatID: chatID,
 		UserID: userID,
 		Role:   role,
 	}
-	return s.chatRepository.AddChatMember(member)
+	if err := s.chatRepository.AddChatMember(member); err != nil {
+		return err
+	}
+
+	s.webhookService.Publish(chatID, entity.WebhookMemberJoined, memberEventData(s.userRepository, member))
+	return nil
 }
 
 func (s *implChatService) RemoveMember(chatID, userID int64) error {
-	return s.chatRepository.RemoveChatMember(chatID, userID)
+	if err := s.chatRepository.RemoveChatMember(chatID, userID); err != nil {
+		return err
+	}
+
+	s.webhookService.Publish(chatID, entity.WebhookMemberLeft, memberEventData(s.userRepository, &entity.ChatMember{ChatID: chatID, UserID: userID}))
+	return nil
+}
+
+// messageEventData is the webhook view of a message; the author is reduced to their public profile
+func messageEventData(message *entity.Message) map[string]interface{} {
+	data := *message
+	data.CreatedByUser = nil
+
+	var author *entity.PublicProfile
+	if message.CreatedByUser != nil {
+		author = message.CreatedByUser.PublicProfile()
+	}
+
+	return map[string]interface{}{"message": data, "author": author}
+}
+
+func memberEventData(userRepo repository.UserRepository, member *entity.ChatMember) map[string]interface{} {
+	data := map[string]interface{}{"user_id": member.UserID}
+	if member.Role != "" {
+		data["role"] = member.Role
+	}
+	if user, err := userRepo.GetUserByNumericID(member.UserID); err == nil {
+		data["user"] = user.PublicProfile()
+	}
+	return data
 }
 
 func (s *implChatService) GetMembers(chatID int64) ([]*entity.ChatMember, error) {
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const (
+	chatTestAdminID    = 1
+	chatTestMemberID   = 2
+	chatTestOutsiderID = 3
+)
+
+type chatTestEnv struct {
+	service       *implChatService
+	chatRepo      repository.ChatRepository
+	users         *fakeUserRepository
+	notifications *fakeNotificationService
+	chatID        int64
+}
+
+// newChatTestEnv sets up a private group with an admin and a member; the outsider has an account
+// but is not in the chat
+func newChatTestEnv(t *testing.T) *chatTestEnv {
+	t.Helper()
+
+	env := &chatTestEnv{
+		chatRepo:      repository.NewChatRepository(),
+		users:         &fakeUserRepository{},
+		notifications: &fakeNotificationService{},
+	}
+	env.users.add(entity.User{NumericID: chatTestAdminID, Username: "admin"})
+	env.users.add(entity.User{NumericID: chatTestMemberID, Username: "member"})
+	env.users.add(entity.User{NumericID: chatTestOutsiderID, Username: "outsider"})
+	env.chatID = newTestChat(t, env.chatRepo, map[int64]string{
+		chatTestAdminID:  "admin",
+		chatTestMemberID: "member",
+	})
+
+	env.service = NewChatService(env.chatRepo, env.users, nil, &fakeUploadRepository{}, env.notifications,
+		&fakeWebhookPublisher{}, &fakeLinkPreviewService{}).(*implChatService)
+	return env
+}
+
+func (env *chatTestEnv) send(t *testing.T, userID int64, content string) *entity.Message {
+	t.Helper()
+
+	message := &entity.Message{ChatID: env.chatID, Content: content, Type: entity.Text, CreatedBy: userID}
+	if err := env.service.SendMessage(message); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	return message
+}
+
+func TestSendMessageRequiresMembership(t *testing.T) {
+	env := newChatTestEnv(t)
+
+	env.send(t, chatTestMemberID, "hello")
+
+	message := &entity.Message{ChatID: env.chatID, Content: "let me in", Type: entity.Text, CreatedBy: chatTestOutsiderID}
+	if err := env.service.SendMessage(message); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("outsider sent a message: %v", err)
+	}
+
+	messages, err := env.service.GetMessages(chatTestMemberID, env.chatID, 50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "hello" {
+		t.Fatalf("got %d messages, want only the member's", len(messages))
+	}
+}
+
+func TestGetMessagesRequiresMembership(t *testing.T) {
+	env := newChatTestEnv(t)
+	env.send(t, chatTestMemberID, "private")
+
+	if _, err := env.service.GetMessages(chatTestOutsiderID, env.chatID, 50, 0); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("outsider read a private chat: %v", err)
+	}
+
+	// Anyone may join a public chat, so anyone may read it
+	public := &entity.Chat{Name: "lobby", Type: entity.PublicGroup, IsPublic: true}
+	if err := env.chatRepo.CreateChat(public); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.GetMessages(chatTestOutsiderID, public.ID, 50, 0); err != nil {
+		t.Fatalf("outsider could not read a public chat: %v", err)
+	}
+}
+
+func TestDeleteMessageOnlyByAuthor(t *testing.T) {
+	env := newChatTestEnv(t)
+	message := env.send(t, chatTestMemberID, "mine")
+
+	for _, userID := range []int64{chatTestAdminID, chatTestOutsiderID} {
+		if err := env.service.DeleteMessage(userID, message.ID); !errors.Is(err, ErrNotMessageAuthor) {
+			t.Fatalf("user %d deleted another user's message: %v", userID, err)
+		}
+	}
+	if _, err := env.chatRepo.GetMessageByID(message.ID); err != nil {
+		t.Fatal("the message is gone after refused deletes")
+	}
+
+	if err := env.service.DeleteMessage(chatTestMemberID, message.ID); err != nil {
+		t.Fatalf("author could not delete their message: %v", err)
+	}
+	if _, err := env.chatRepo.GetMessageByID(message.ID); err == nil {
+		t.Fatal("the message survived its author's delete")
+	}
+}
+
+func TestEditMessageOnlyByAuthor(t *testing.T) {
+	env := newChatTestEnv(t)
+	message := env.send(t, chatTestMemberID, "first draft")
+
+	if _, err := env.service.EditMessage(chatTestAdminID, message.ID, "rewritten"); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Fatalf("an admin edited another user's message: %v", err)
+	}
+	stored, _ := env.chatRepo.GetMessageByID(message.ID)
+	if stored.Content != "first draft" {
+		t.Fatalf("content = %q after a refused edit", stored.Content)
+	}
+
+	if _, err := env.service.EditMessage(chatTestMemberID, message.ID, "final"); err != nil {
+		t.Fatalf("author could not edit their message: %v", err)
+	}
+}
+
+func TestEditMessageMentions(t *testing.T) {
+	env := newChatTestEnv(t)
+
+	// A member's @everyone stays plain text, before and after an edit
+	message := env.send(t, chatTestMemberID, "hi @everyone")
+	if message.MentionsEveryone || len(message.Mentions) != 0 {
+		t.Fatalf("a member's @everyone mentioned %v", message.Mentions)
+	}
+	edited, err := env.service.EditMessage(chatTestMemberID, message.ID, "hi @everyone, really")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.MentionsEveryone {
+		t.Fatal("editing let a member mention @everyone")
+	}
+
+	// Adding a mention in an edit notifies only the newly mentioned user, once
+	edited, err = env.service.EditMessage(chatTestMemberID, message.ID, "hi @admin and @outsider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.Mentions) != 1 || edited.Mentions[0] != chatTestAdminID {
+		t.Fatalf("mentions = %v, want only the admin; the outsider is not in the chat", edited.Mentions)
+	}
+	if _, err := env.service.EditMessage(chatTestMemberID, message.ID, "hi @admin!"); err != nil {
+		t.Fatal(err)
+	}
+	if notified := env.notifications.notified(entity.MessageMention); len(notified) != 1 || notified[0] != chatTestAdminID {
+		t.Fatalf("mention notifications went to %v, want the admin once", notified)
+	}
+
+	// The admin's own @everyone reaches every member
+	announcement := env.send(t, chatTestAdminID, "@everyone meeting at noon")
+	if !announcement.MentionsEveryone || len(announcement.Mentions) != 2 {
+		t.Fatalf("admin's @everyone mentioned %v", announcement.Mentions)
+	}
+}
@@ -0,0 +1,516 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const (
+	defaultMuteDuration = time.Hour
+	maxMuteDuration     = 30 * 24 * time.Hour
+	maxTopicLength      = 250
+)
+
+// Command is a slash command users can type in place of a message
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	AdminOnly   bool // Only chat admins may run it
+	GroupOnly   bool // Not available in one-to-one chats
+	Handler     func(inv *CommandInvocation) (*entity.CommandResult, error)
+}
+
+// CommandInvocation is one run of a command by a chat member
+type CommandInvocation struct {
+	UserID int64
+	Chat   *entity.Chat
+	Member *entity.ChatMember
+	Name   string
+	Args   string // Everything after the command name, trimmed
+}
+
+func (inv *CommandInvocation) IsAdmin() bool {
+	return inv.Member.Role == "admin"
+}
+
+// CommandService recognises "/command args" messages and runs the registered handler
+type CommandService interface {
+	IsCommand(content string) bool
+	// Execute runs the command, sends its ephemeral response to the invoker and broadcasts any message it posts
+	Execute(userID, chatID int64, content string) *entity.CommandResult
+	Register(command *Command)
+	Commands() []*Command
+}
+
+type implCommandService struct {
+	chatRepo    repository.ChatRepository
+	userRepo    repository.UserRepository
+	chatService ChatService
+	roomService RoomService
+	pollService PollService
+	commands    map[string]*Command
+}
+
+func NewCommandService(
+	chatRepo repository.ChatRepository,
+	userRepo repository.UserRepository,
+	chatService ChatService,
+	roomService RoomService,
+	pollService PollService,
+) CommandService {
+	s := &implCommandService{
+		chatRepo:    chatRepo,
+		userRepo:    userRepo,
+		chatService: chatService,
+		roomService: roomService,
+		pollService: pollService,
+		commands:    make(map[string]*Command),
+	}
+	s.registerBuiltins()
+	return s
+}
+
+func (s *implCommandService) Register(command *Command) {
+	s.commands[command.Name] = command
+}
+
+func (s *implCommandService) Commands() []*Command {
+	commands := make([]*Command, 0, len(s.commands))
+	for _, command := range s.commands {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// IsCommand reports whether content starts with "/name" followed by a space or the end,
+// so that paths such as "/usr/bin" are still sent as plain text
+func (s *implCommandService) IsCommand(content string) bool {
+	name, _, ok := parseCommand(content)
+	return ok && name != ""
+}
+
+func parseCommand(content string) (string, string, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "/") {
+		return "", "", false
+	}
+
+	end := 1
+	for end < len(content) && content[end] < unicode.MaxASCII && unicode.IsLetter(rune(content[end])) {
+		end++
+	}
+	if end < len(content) && !unicode.IsSpace(rune(content[end])) {
+		return "", "", false
+	}
+
+	return strings.ToLower(content[1:end]), strings.TrimSpace(content[end:]), true
+}
+
+func (s *implCommandService) Execute(userID, chatID int64, content string) *entity.CommandResult {
+	name, args, _ := parseCommand(content)
+	result, err := s.run(userID, chatID, name, args)
+	if err != nil {
+		result = &entity.CommandResult{Response: err.Error(), IsError: true}
+	}
+	result.ChatID = chatID
+	result.Command = name
+
+	if result.Message != nil {
+		broadcastMessage(s.roomService, result.Message)
+	}
+
+	if result.Response != "" {
+		s.roomService.SendToUser(userID, entity.Event{
+			Type: entity.COMMAND_RESPONSE,
+			Data: map[string]interface{}{
+				"chat_id":  chatID,
+				"command":  name,
+				"response": result.Response,
+				"is_error": result.IsError,
+			},
+		})
+	}
+
+	return result
+}
+
+func (s *implCommandService) run(userID, chatID int64, name, args string) (*entity.CommandResult, error) {
+	command, ok := s.commands[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown command /%s, type /help to see what is available", name)
+	}
+
+	chat, err := s.chatRepo.GetChatByID(chatID)
+	if err != nil {
+		return nil, errors.New("chat not found")
+	}
+
+	member, err := s.chatRepo.GetChatMember(chatID, userID)
+	if err != nil {
+		return nil, errors.New("you are not a member of this chat")
+	}
+
+	if command.GroupOnly && chat.Type == entity.Individual {
+		return nil, fmt.Errorf("/%s only works in group chats", name)
+	}
+	if command.AdminOnly && member.Role != "admin" {
+		return nil, fmt.Errorf("only chat admins can use /%s", name)
+	}
+
+	return command.Handler(&CommandInvocation{
+		UserID: userID,
+		Chat:   chat,
+		Member: member,
+		Name:   name,
+		Args:   args,
+	})
+}
+
+func (s *implCommandService) registerBuiltins() {
+	s.Register(&Command{
+		Name:        "help",
+		Usage:       "/help",
+		Description: "List the available commands",
+		Handler:     s.help,
+	})
+	s.Register(&Command{
+		Name:        "me",
+		Usage:       "/me <action>",
+		Description: "Describe what you are doing",
+		Handler:     s.me,
+	})
+	s.Register(&Command{
+		Name:        "topic",
+		Usage:       "/topic [new topic]",
+		Description: "Show the chat topic, or change it (admins)",
+		GroupOnly:   true,
+		Handler:     s.topic,
+	})
+	s.Register(&Command{
+		Name:        "invite",
+		Usage:       "/invite @username",
+		Description: "Add a user to this chat",
+		GroupOnly:   true,
+		Handler:     s.invite,
+	})
+	s.Register(&Command{
+		Name:        "kick",
+		Usage:       "/kick @username",
+		Description: "Remove a member from this chat",
+		AdminOnly:   true,
+		GroupOnly:   true,
+		Handler:     s.kick,
+	})
+	s.Register(&Command{
+		Name:        "mute",
+		Usage:       "/mute @username [duration, e.g. 30m, 2h, 1d]",
+		Description: "Stop a member from posting for a while (default 1h)",
+		AdminOnly:   true,
+		GroupOnly:   true,
+		Handler:     s.mute,
+	})
+	s.Register(&Command{
+		Name:        "unmute",
+		Usage:       "/unmute @username",
+		Description: "Let a muted member post again",
+		AdminOnly:   true,
+		GroupOnly:   true,
+		Handler:     s.unmute,
+	})
+	s.Register(&Command{
+		Name:        "poll",
+		Usage:       `/poll "question" "option 1" "option 2" ...`,
+		Description: "Ask the chat a question",
+		GroupOnly:   true,
+		Handler:     s.poll,
+	})
+}
+
+func (s *implCommandService) help(inv *CommandInvocation) (*entity.CommandResult, error) {
+	lines := []string{"Available commands:"}
+	for _, command := range s.Commands() {
+		if command.AdminOnly && !inv.IsAdmin() {
+			continue
+		}
+		if command.GroupOnly && inv.Chat.Type == entity.Individual {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", command.Usage, command.Description))
+	}
+
+	return &entity.CommandResult{Response: strings.Join(lines, "\n")}, nil
+}
+
+func (s *implCommandService) me(inv *CommandInvocation) (*entity.CommandResult, error) {
+	if inv.Args == "" {
+		return nil, errors.New("usage: /me <action>")
+	}
+
+	message := &entity.Message{
+		ChatID:    inv.Chat.ID,
+		Content:   inv.Args,
+		Type:      entity.Action,
+		CreatedBy: inv.UserID,
+	}
+	if err := s.chatService.SendMessage(message); err != nil {
+		return nil, err
+	}
+
+	return &entity.CommandResult{Message: message}, nil
+}
+
+func (s *implCommandService) topic(inv *CommandInvocation) (*entity.CommandResult, error) {
+	if inv.Args == "" {
+		if inv.Chat.Topic == "" {
+			return &entity.CommandResult{Response: "This chat has no topic"}, nil
+		}
+		return &entity.CommandResult{Response: "Topic: " + inv.Chat.Topic}, nil
+	}
+
+	if !inv.IsAdmin() {
+		return nil, errors.New("only chat admins can change the topic")
+	}
+	if len(inv.Args) > maxTopicLength {
+		return nil, fmt.Errorf("the topic must be at most %d characters", maxTopicLength)
+	}
+
+	inv.Chat.Topic = inv.Args
+	if err := s.chatRepo.UpdateChat(inv.Chat); err != nil {
+		return nil, err
+	}
+
+	message, err := s.postSystemMessage(inv, "changed the topic to: "+inv.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.CommandResult{Message: message}, nil
+}
+
+func (s *implCommandService) invite(inv *CommandInvocation) (*entity.CommandResult, error) {
+	target, err := s.resolveUser(inv.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if isMember, _ := s.chatRepo.IsChatMember(inv.Chat.ID, target.NumericID); isMember {
+		return nil, fmt.Errorf("@%s is already in this chat", target.Username)
+	}
+
+	if err := s.chatService.AddMember(inv.Chat.ID, target.NumericID, "member"); err != nil {
+		return nil, err
+	}
+	s.roomService.JoinRoom(target.NumericID, inv.Chat.ID)
+
+	message, err := s.postSystemMessage(inv, "added @"+target.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.CommandResult{Message: message}, nil
+}
+
+func (s *implCommandService) kick(inv *CommandInvocation) (*entity.CommandResult, error) {
+	target, member, err := s.resolveMember(inv)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.chatService.RemoveMember(inv.Chat.ID, member.UserID); err != nil {
+		return nil, err
+	}
+	s.roomService.LeaveRoom(member.UserID, inv.Chat.ID)
+
+	s.roomService.SendToUser(member.UserID, entity.Event{
+		Type: entity.COMMAND_RESPONSE,
+		Data: map[string]interface{}{
+			"chat_id":  inv.Chat.ID,
+			"command":  inv.Name,
+			"response": fmt.Sprintf("You were removed from %s", inv.Chat.Name),
+		},
+	})
+
+	message, err := s.postSystemMessage(inv, "removed @"+target.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.CommandResult{Message: message}, nil
+}
+
+func (s *implCommandService) mute(inv *CommandInvocation) (*entity.CommandResult, error) {
+	username, rawDuration, _ := strings.Cut(inv.Args, " ")
+
+	duration := defaultMuteDuration
+	if rawDuration = strings.TrimSpace(rawDuration); rawDuration != "" {
+		parsed, err := parseMuteDuration(rawDuration)
+		if err != nil {
+			return nil, err
+		}
+		duration = parsed
+	}
+
+	target, member, err := s.resolveMember(&CommandInvocation{UserID: inv.UserID, Chat: inv.Chat, Args: username})
+	if err != nil {
+		return nil, err
+	}
+
+	until := time.Now().Add(duration)
+	if err := s.chatRepo.SetChatMemberMutedUntil(inv.Chat.ID, member.UserID, &until); err != nil {
+		return nil, err
+	}
+
+	s.roomService.SendToUser(member.UserID, entity.Event{
+		Type: entity.COMMAND_RESPONSE,
+		Data: map[string]interface{}{
+			"chat_id":     inv.Chat.ID,
+			"command":     inv.Name,
+			"response":    fmt.Sprintf("You were muted in %s for %s", inv.Chat.Name, duration),
+			"muted_until": until,
+		},
+	})
+
+	return &entity.CommandResult{Response: fmt.Sprintf("Muted @%s for %s", target.Username, duration)}, nil
+}
+
+func (s *implCommandService) unmute(inv *CommandInvocation) (*entity.CommandResult, error) {
+	target, member, err := s.resolveMember(inv)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.chatRepo.SetChatMemberMutedUntil(inv.Chat.ID, member.UserID, nil); err != nil {
+		return nil, err
+	}
+
+	return &entity.CommandResult{Response: fmt.Sprintf("Unmuted @%s", target.Username)}, nil
+}
+
+// poll posts a single choice poll message for members to vote on
+func (s *implCommandService) poll(inv *CommandInvocation) (*entity.CommandResult, error) {
+	args := splitCommandArgs(inv.Args)
+	if len(args) < 3 {
+		return nil, errors.New(`usage: /poll "question" "option 1" "option 2" ...`)
+	}
+
+	message, err := s.pollService.CreatePoll(inv.UserID, inv.Chat.ID, &PollInput{
+		Question: args[0],
+		Options:  args[1:],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.CommandResult{Message: message}, nil
+}
+
+func (s *implCommandService) postSystemMessage(inv *CommandInvocation, content string) (*entity.Message, error) {
+	message := &entity.Message{
+		ChatID:    inv.Chat.ID,
+		Content:   content,
+		Type:      entity.System,
+		CreatedBy: inv.UserID,
+	}
+	if err := s.chatService.SendMessage(message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (s *implCommandService) resolveUser(arg string) (*entity.User, error) {
+	username := strings.TrimPrefix(strings.TrimSpace(arg), "@")
+	if username == "" || strings.ContainsAny(username, " \t") {
+		return nil, errors.New("name exactly one @username")
+	}
+
+	user, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("no user named @%s", username)
+	}
+	return user, nil
+}
+
+// resolveMember finds the member named in the arguments; admins and the invoker cannot be targeted
+func (s *implCommandService) resolveMember(inv *CommandInvocation) (*entity.User, *entity.ChatMember, error) {
+	target, err := s.resolveUser(inv.Args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if target.NumericID == inv.UserID {
+		return nil, nil, errors.New("you cannot use this command on yourself")
+	}
+
+	member, err := s.chatRepo.GetChatMember(inv.Chat.ID, target.NumericID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("@%s is not in this chat", target.Username)
+	}
+	if member.Role == "admin" {
+		return nil, nil, fmt.Errorf("@%s is an admin", target.Username)
+	}
+
+	return target, member, nil
+}
+
+// parseMuteDuration accepts Go durations such as 30m or 2h, and whole days such as 1d
+func parseMuteDuration(raw string) (time.Duration, error) {
+	var duration time.Duration
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", raw)
+		}
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", raw)
+		}
+		duration = parsed
+	}
+
+	if duration <= 0 || duration > maxMuteDuration {
+		return 0, errors.New("duration must be positive and at most 30 days")
+	}
+	return duration, nil
+}
+
+// splitCommandArgs splits on spaces, keeping "quoted phrases" together
+func splitCommandArgs(raw string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	hasArg := false
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case unicode.IsSpace(r) && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+// DraftService keeps half-written messages per user and chat so they follow the user between devices.
+// Every change is announced with a draft_updated event to the user's other sessions; the session that
+// made the change already has it.
+type DraftService interface {
+	// SaveDraft stores the draft; blank content deletes it instead and returns nil
+	SaveDraft(userID, chatID int64, sessionID, content string, replyToID *int64) (*entity.Draft, error)
+	GetDraft(userID, chatID int64) (*entity.Draft, error)
+	GetDrafts(userID int64) ([]*entity.Draft, error)
+	DeleteDraft(userID, chatID int64, sessionID string) error
+	// ClearDraft removes the draft after the user sent a message in the chat
+	ClearDraft(userID, chatID int64)
+}
+
+type implDraftService struct {
+	draftRepo   repository.DraftRepository
+	chatRepo    repository.ChatRepository
+	roomService RoomService
+}
+
+func NewDraftService(draftRepo repository.DraftRepository, chatRepo repository.ChatRepository, roomService RoomService) DraftService {
+	return &implDraftService{
+		draftRepo:   draftRepo,
+		chatRepo:    chatRepo,
+		roomService: roomService,
+	}
+}
+
+func (s *implDraftService) SaveDraft(userID, chatID int64, sessionID, content string, replyToID *int64) (*entity.Draft, error) {
+	if err := s.ensureMember(userID, chatID); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(content) == "" && replyToID == nil {
+		return nil, s.DeleteDraft(userID, chatID, sessionID)
+	}
+	if err := validateMessageContent(content); err != nil {
+		return nil, err
+	}
+
+	draft := &entity.Draft{
+		UserID:    userID,
+		ChatID:    chatID,
+		Content:   content,
+		ReplyToID: replyToID,
+	}
+	if err := s.draftRepo.SaveDraft(draft); err != nil {
+		return nil, err
+	}
+
+	s.announce(userID, chatID, sessionID, draft)
+	return draft, nil
+}
+
+func (s *implDraftService) GetDraft(userID, chatID int64) (*entity.Draft, error) {
+	if err := s.ensureMember(userID, chatID); err != nil {
+		return nil, err
+	}
+
+	return s.draftRepo.GetDraft(userID, chatID)
+}
+
+func (s *implDraftService) GetDrafts(userID int64) ([]*entity.Draft, error) {
+	return s.draftRepo.GetDraftsByUser(userID)
+}
+
+func (s *implDraftService) DeleteDraft(userID, chatID int64, sessionID string) error {
+	deleted, err := s.draftRepo.DeleteDraft(userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		s.announce(userID, chatID, sessionID, nil)
+	}
+	return nil
+}
+
+func (s *implDraftService) ClearDraft(userID, chatID int64) {
+	if err := s.DeleteDraft(userID, chatID, ""); err != nil {
+		log.Printf("Error clearing draft of user %d in chat %d: %v", userID, chatID, err)
+	}
+}
+
+func (s *implDraftService) ensureMember(userID, chatID int64) error {
+	if isMember, err := s.chatRepo.IsChatMember(chatID, userID); err != nil || !isMember {
+		return errors.New("you are not a member of this chat")
+	}
+	return nil
+}
+
+// announce tells the user's other connected sessions about the change; a nil draft means it was removed.
+// An empty sessionID, as when sending clears the draft, reaches every session
+func (s *implDraftService) announce(userID, chatID int64, sessionID string, draft *entity.Draft) {
+	s.roomService.SendToUserExcept(userID, sessionID, entity.Event{
+		Type: entity.DRAFT_UPDATED,
+		Data: map[string]interface{}{
+			"chat_id": chatID,
+			"draft":   draft,
+		},
+		CreatedBy: userID,
+	})
+}
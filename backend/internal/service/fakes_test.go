@@ -0,0 +1,712 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// In-memory stand-ins shared by the service tests. Repositories apply the same conditions as
+// their Mongo versions; fakes that embed an interface only implement what the services under
+// test call, anything else panics on the nil interface.
+
+// testClock is a settable clock for the services' now field
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestChat creates a group chat in chatRepo with the given members, user ID to role
+func newTestChat(t *testing.T, chatRepo repository.ChatRepository, members map[int64]string) int64 {
+	t.Helper()
+
+	chat := &entity.Chat{Name: "test", Type: entity.PrivateGroup}
+	if err := chatRepo.CreateChat(chat); err != nil {
+		t.Fatal(err)
+	}
+	for userID, role := range members {
+		if err := chatRepo.AddChatMember(&entity.ChatMember{ChatID: chat.ID, UserID: userID, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chat.ID
+}
+
+// fakeUserRepository stores copies, so a service only sees its changes once it saves them
+type fakeUserRepository struct {
+	repository.UserRepository
+	mu     sync.Mutex
+	users  []*entity.User
+	nextID int64
+}
+
+func (r *fakeUserRepository) CreateUser(user *entity.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	user.NumericID = r.nextID
+	stored := *user
+	r.users = append(r.users, &stored)
+	return nil
+}
+
+// add stores user with a fixed ID
+func (r *fakeUserRepository) add(user entity.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.NumericID > r.nextID {
+		r.nextID = user.NumericID
+	}
+	r.users = append(r.users, &user)
+}
+
+func (r *fakeUserRepository) find(match func(*entity.User) bool) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepository) GetUserByNumericID(id int64) (*entity.User, error) {
+	return r.find(func(user *entity.User) bool { return user.NumericID == id })
+}
+
+func (r *fakeUserRepository) GetUserByUsername(username string) (*entity.User, error) {
+	return r.find(func(user *entity.User) bool { return user.Username == username })
+}
+
+func (r *fakeUserRepository) GetUserByEmail(email string) (*entity.User, error) {
+	return r.find(func(user *entity.User) bool { return strings.EqualFold(user.Email, email) })
+}
+
+// UpdateUser applies the user as a $set, the way the Mongo repository does: fields the bson
+// encoding leaves out keep their stored value
+func (r *fakeUserRepository) UpdateUser(user *entity.User) error {
+	set, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.users {
+		if stored.ID != user.ID || stored.NumericID != user.NumericID {
+			continue
+		}
+		current, err := bson.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		var doc bson.M
+		if err := bson.Unmarshal(current, &doc); err != nil {
+			return err
+		}
+		if err := bson.Unmarshal(set, &doc); err != nil {
+			return err
+		}
+		merged, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		var updated entity.User
+		if err := bson.Unmarshal(merged, &updated); err != nil {
+			return err
+		}
+		*stored = updated
+		return nil
+	}
+	return errors.New("user not found")
+}
+
+// update applies change to the stored user under the lock
+func (r *fakeUserRepository) update(id int64, change func(*entity.User) bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.NumericID == id {
+			return change(user)
+		}
+	}
+	return false
+}
+
+func (r *fakeUserRepository) AdvanceTwoFactorStep(id int64, step int64) (bool, error) {
+	return r.update(id, func(user *entity.User) bool {
+		if user.TwoFactorLastStep >= step {
+			return false
+		}
+		user.TwoFactorLastStep = step
+		return true
+	}), nil
+}
+
+func (r *fakeUserRepository) ConsumeRecoveryCode(id int64, codeHash string) (bool, error) {
+	return r.update(id, func(user *entity.User) bool {
+		for i, hash := range user.RecoveryCodes {
+			if hash == codeHash {
+				user.RecoveryCodes = append(user.RecoveryCodes[:i], user.RecoveryCodes[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// fakeWebhookRepository keeps webhooks and deliveries in memory and claims deliveries the way
+// the Mongo repository does
+type fakeWebhookRepository struct {
+	mu         sync.Mutex
+	webhooks   map[primitive.ObjectID]*entity.Webhook
+	deliveries map[primitive.ObjectID]*entity.WebhookDelivery
+}
+
+func newFakeWebhookRepository() *fakeWebhookRepository {
+	return &fakeWebhookRepository{
+		webhooks:   make(map[primitive.ObjectID]*entity.Webhook),
+		deliveries: make(map[primitive.ObjectID]*entity.WebhookDelivery),
+	}
+}
+
+func (r *fakeWebhookRepository) CreateWebhook(webhook *entity.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetWebhookByID(id primitive.ObjectID) (*entity.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, errors.New("webhook not found")
+	}
+	return webhook, nil
+}
+
+func (r *fakeWebhookRepository) GetWebhooksByChat(chatID int64) ([]*entity.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var webhooks []*entity.Webhook
+	for _, webhook := range r.webhooks {
+		if webhook.ChatID == chatID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *fakeWebhookRepository) GetActiveWebhooksByChat(chatID int64) ([]*entity.Webhook, error) {
+	webhooks, _ := r.GetWebhooksByChat(chatID)
+
+	active := webhooks[:0]
+	for _, webhook := range webhooks {
+		if webhook.IsActive {
+			active = append(active, webhook)
+		}
+	}
+	return active, nil
+}
+
+func (r *fakeWebhookRepository) DeleteWebhook(id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.webhooks, id)
+	return nil
+}
+
+func (r *fakeWebhookRepository) CreateDelivery(delivery *entity.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = delivery.CreatedAt
+	stored := *delivery
+	r.deliveries[delivery.ID] = &stored
+	return nil
+}
+
+func (r *fakeWebhookRepository) ClaimDueDelivery(now time.Time, lease time.Duration) (*entity.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, delivery := range r.deliveries {
+		if delivery.Status == entity.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			delivery.NextAttemptAt = now.Add(lease)
+			claimed := *delivery
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) UpdateDelivery(delivery *entity.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery.UpdatedAt = time.Now()
+	stored := *delivery
+	r.deliveries[delivery.ID] = &stored
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetDeliveriesByWebhook(webhookID primitive.ObjectID, limit int) ([]*entity.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deliveries []*entity.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// onlyDelivery returns the one delivery a test queued
+func (r *fakeWebhookRepository) onlyDelivery(t *testing.T) *entity.WebhookDelivery {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(r.deliveries))
+	}
+	for _, delivery := range r.deliveries {
+		copied := *delivery
+		return &copied
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepository) CreateIncomingWebhook(webhook *entity.IncomingWebhook) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) GetIncomingWebhookByID(id primitive.ObjectID) (*entity.IncomingWebhook, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) GetIncomingWebhookByHash(tokenHash string) (*entity.IncomingWebhook, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) GetIncomingWebhooksByChat(chatID int64) ([]*entity.IncomingWebhook, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) TouchIncomingWebhook(id primitive.ObjectID) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) DeleteIncomingWebhook(id primitive.ObjectID) error {
+	return errors.New("not implemented")
+}
+
+// fakeScheduledMessageRepository applies the same status conditions as the Mongo repository.
+// beforeWrite, when set, runs just before a conditional update so a test can let the scheduler
+// claim the message between a user's read and write.
+type fakeScheduledMessageRepository struct {
+	mu          sync.Mutex
+	messages    map[primitive.ObjectID]*entity.ScheduledMessage
+	beforeWrite func(id primitive.ObjectID)
+}
+
+func newFakeScheduledMessageRepository() *fakeScheduledMessageRepository {
+	return &fakeScheduledMessageRepository{messages: make(map[primitive.ObjectID]*entity.ScheduledMessage)}
+}
+
+func (r *fakeScheduledMessageRepository) CreateScheduledMessage(message *entity.ScheduledMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message.ID = primitive.NewObjectID()
+	message.Status = entity.ScheduledPending
+	message.CreatedAt = time.Now()
+	message.UpdatedAt = message.CreatedAt
+	stored := *message
+	r.messages[message.ID] = &stored
+	return nil
+}
+
+func (r *fakeScheduledMessageRepository) GetScheduledMessageByID(id primitive.ObjectID) (*entity.ScheduledMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, errors.New("scheduled message not found")
+	}
+	copied := *message
+	return &copied, nil
+}
+
+func (r *fakeScheduledMessageRepository) GetPendingScheduledMessages(userID int64, chatID *int64) ([]*entity.ScheduledMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := []*entity.ScheduledMessage{}
+	for _, message := range r.messages {
+		if message.CreatedBy == userID && message.Status == entity.ScheduledPending &&
+			(chatID == nil || message.ChatID == *chatID) {
+			copied := *message
+			messages = append(messages, &copied)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].SendAt.Before(messages[j].SendAt) })
+	return messages, nil
+}
+
+func (r *fakeScheduledMessageRepository) CountPendingScheduledMessages(userID int64) (int64, error) {
+	messages, _ := r.GetPendingScheduledMessages(userID, nil)
+	return int64(len(messages)), nil
+}
+
+func (r *fakeScheduledMessageRepository) UpdatePendingScheduledMessage(message *entity.ScheduledMessage) error {
+	if r.beforeWrite != nil {
+		r.beforeWrite(message.ID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.messages[message.ID]
+	if !ok || stored.Status != entity.ScheduledPending {
+		return errors.New("scheduled message was already sent or canceled")
+	}
+	stored.Content = message.Content
+	stored.SendAt = message.SendAt
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *fakeScheduledMessageRepository) CancelScheduledMessage(id primitive.ObjectID) error {
+	if r.beforeWrite != nil {
+		r.beforeWrite(id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.messages[id]
+	if !ok || stored.Status != entity.ScheduledPending {
+		return errors.New("scheduled message was already sent or canceled")
+	}
+	stored.Status = entity.ScheduledCanceled
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *fakeScheduledMessageRepository) ClaimDueScheduledMessage(now time.Time, lease time.Duration) (*entity.ScheduledMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due *entity.ScheduledMessage
+	for _, message := range r.messages {
+		claimable := (message.Status == entity.ScheduledPending && !message.SendAt.After(now)) ||
+			(message.Status == entity.ScheduledSending && message.LockedUntil != nil && !message.LockedUntil.After(now))
+		if claimable && (due == nil || message.SendAt.Before(due.SendAt)) {
+			due = message
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+
+	lockedUntil := now.Add(lease)
+	due.Status = entity.ScheduledSending
+	due.LockedUntil = &lockedUntil
+	due.UpdatedAt = now
+
+	claimed := *due
+	return &claimed, nil
+}
+
+func (r *fakeScheduledMessageRepository) CompleteScheduledMessage(message *entity.ScheduledMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message.LockedUntil = nil
+	message.UpdatedAt = time.Now()
+	stored := *message
+	r.messages[message.ID] = &stored
+	return nil
+}
+
+// fakeUploadRepository only records which references were released
+type fakeUploadRepository struct {
+	mu      sync.Mutex
+	removed []string
+}
+
+func (r *fakeUploadRepository) CreateUpload(upload *entity.Upload) error { return nil }
+
+func (r *fakeUploadRepository) AddUploadReference(filename string, ownerID int64, ref string) (bool, error) {
+	return true, nil
+}
+
+func (r *fakeUploadRepository) CopyUploadReferences(fromRef, toRef string) error { return nil }
+
+func (r *fakeUploadRepository) RemoveUploadReferences(ref string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removed = append(r.removed, ref)
+	return nil, nil
+}
+
+func (r *fakeUploadRepository) DeleteUnreferencedUpload(filename string) (bool, error) {
+	return false, nil
+}
+
+func (r *fakeUploadRepository) released(ref string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, removed := range r.removed {
+		if removed == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeChatService records sent messages
+type fakeChatService struct {
+	ChatService
+	mu     sync.Mutex
+	sent   []*entity.Message
+	nextID int64
+}
+
+func (s *fakeChatService) SendMessage(message *entity.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	message.ID = s.nextID
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+func (s *fakeChatService) sentMessages() []*entity.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*entity.Message(nil), s.sent...)
+}
+
+type fakeIdentityRepository struct {
+	mu         sync.Mutex
+	identities []*entity.Identity
+	states     map[string]*entity.OIDCLoginState
+}
+
+func newFakeIdentityRepository() *fakeIdentityRepository {
+	return &fakeIdentityRepository{states: make(map[string]*entity.OIDCLoginState)}
+}
+
+func (r *fakeIdentityRepository) CreateIdentity(identity *entity.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return errors.New("identity already linked")
+		}
+	}
+	identity.ID = primitive.NewObjectID()
+	identity.CreatedAt = time.Now()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentityRepository) GetIdentity(provider, subject string) (*entity.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, errors.New("identity not found")
+}
+
+func (r *fakeIdentityRepository) GetIdentitiesByUser(userID int64) ([]*entity.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identities := []*entity.Identity{}
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *fakeIdentityRepository) DeleteIdentity(id primitive.ObjectID, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, identity := range r.identities {
+		if identity.ID == id && identity.UserID == userID {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("identity not found")
+}
+
+func (r *fakeIdentityRepository) CreateLoginState(state *entity.OIDCLoginState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state.CreatedAt = time.Now()
+	r.states[state.StateHash] = state
+	return nil
+}
+
+func (r *fakeIdentityRepository) ConsumeLoginState(stateHash string) (*entity.OIDCLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[stateHash]
+	if !ok {
+		return nil, errors.New("login state not found")
+	}
+	delete(r.states, stateHash)
+	return state, nil
+}
+
+// fakeSessionAuthService hands out a token pair; the OIDC service needs nothing else from AuthService
+type fakeSessionAuthService struct {
+	AuthService
+}
+
+func (s *fakeSessionAuthService) CreateSessionForUser(user *entity.User, client ClientInfo) (*entity.TokenPair, *entity.TwoFactorChallenge, error) {
+	return &entity.TokenPair{AccessToken: "access-" + user.Username, RefreshToken: "refresh-" + user.Username}, nil, nil
+}
+
+// fakeNotificationService records the notifications the services send
+type fakeNotificationService struct {
+	NotificationService
+	mu   sync.Mutex
+	sent []*entity.Notification
+}
+
+func (s *fakeNotificationService) SendNotification(notification *entity.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, notification)
+	return nil
+}
+
+// notified returns the IDs of the users sent a notification of the given type, in order
+func (s *fakeNotificationService) notified(notificationType entity.NotificationType) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userIDs []int64
+	for _, notification := range s.sent {
+		if notification.Type == notificationType {
+			userIDs = append(userIDs, notification.RecipientID)
+		}
+	}
+	return userIDs
+}
+
+// fakeWebhookPublisher drops published events; no chat in these tests has webhooks
+type fakeWebhookPublisher struct {
+	WebhookService
+}
+
+func (s *fakeWebhookPublisher) Publish(chatID int64, event string, data interface{}) {}
+
+// fakeLinkPreviewService never has a preview cached and fetches nothing
+type fakeLinkPreviewService struct {
+	LinkPreviewService
+}
+
+func (s *fakeLinkPreviewService) CachedPreviews(content string) ([]*entity.LinkPreview, []string) {
+	return nil, nil
+}
+
+func (s *fakeLinkPreviewService) FetchAsync(message *entity.Message, pending []string) {}
+
+// fakeVerificationAuthService records who was sent a verification email
+type fakeVerificationAuthService struct {
+	AuthService
+	mu       sync.Mutex
+	verified []int64
+}
+
+func (s *fakeVerificationAuthService) SendVerificationEmail(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.verified = append(s.verified, userID)
+	return nil
+}
+
+func (s *fakeVerificationAuthService) verificationsSent() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.verified...)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const maxForwardTargets = 10
+
+var ErrForwardNotAllowed = errors.New("you are not a member of every target chat")
+
+// ForwardService copies messages into other chats with a "forwarded from" attribution
+type ForwardService interface {
+	// ForwardMessage sends a copy of the message to each target chat and broadcasts it there.
+	// Targets are checked before anything is sent, so a rejected request forwards nothing.
+	ForwardMessage(userID, messageID int64, targetChatIDs []int64) ([]*entity.Message, error)
+}
+
+type implForwardService struct {
+	chatRepo    repository.ChatRepository
+	userRepo    repository.UserRepository
+	uploadRepo  repository.UploadRepository
+	chatService ChatService
+	roomService RoomService
+}
+
+func NewForwardService(
+	chatRepo repository.ChatRepository,
+	userRepo repository.UserRepository,
+	uploadRepo repository.UploadRepository,
+	chatService ChatService,
+	roomService RoomService,
+) ForwardService {
+	return &implForwardService{
+		chatRepo:    chatRepo,
+		userRepo:    userRepo,
+		uploadRepo:  uploadRepo,
+		chatService: chatService,
+		roomService: roomService,
+	}
+}
+
+func (s *implForwardService) ForwardMessage(userID, messageID int64, targetChatIDs []int64) ([]*entity.Message, error) {
+	source, err := s.chatRepo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	if isMember, err := s.chatRepo.IsChatMember(source.ChatID, userID); err != nil || !isMember {
+		return nil, ErrMessageNotFound
+	}
+
+	switch source.Type {
+	case entity.System, entity.Poll:
+		return nil, fmt.Errorf("%s messages cannot be forwarded", source.Type)
+	}
+
+	targets, err := s.forwardTargets(userID, targetChatIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	forwardedFrom := s.attribution(source)
+	forwarded := make([]*entity.Message, 0, len(targets))
+	for _, chatID := range targets {
+		copied := *forwardedFrom
+		message := &entity.Message{
+			ChatID:        chatID,
+			Content:       source.Content,
+			Type:          source.Type,
+			MediaURL:      source.MediaURL,
+			FileName:      source.FileName,
+			FileSize:      source.FileSize,
+			Attachments:   source.Attachments,
+			ForwardedFrom: &copied,
+			CreatedBy:     userID,
+		}
+
+		if err := s.chatService.SendMessage(message); err != nil {
+			return forwarded, fmt.Errorf("forwarding to chat %d: %w", chatID, err)
+		}
+		// The copy shares the source's files, so they must outlive the source
+		if err := s.uploadRepo.CopyUploadReferences(messageUploadRef(source.ID), messageUploadRef(message.ID)); err != nil {
+			log.Printf("Error sharing uploads of message %d with its copy %d: %v", source.ID, message.ID, err)
+		}
+
+		broadcastMessage(s.roomService, message)
+		forwarded = append(forwarded, message)
+	}
+
+	return forwarded, nil
+}
+
+// forwardTargets dedupes the target chats and checks the user can post in all of them
+func (s *implForwardService) forwardTargets(userID int64, chatIDs []int64) ([]int64, error) {
+	if len(chatIDs) == 0 {
+		return nil, errors.New("at least one target chat is required")
+	}
+
+	seen := make(map[int64]bool, len(chatIDs))
+	targets := make([]int64, 0, len(chatIDs))
+	for _, chatID := range chatIDs {
+		if !seen[chatID] {
+			seen[chatID] = true
+			targets = append(targets, chatID)
+		}
+	}
+	if len(targets) > maxForwardTargets {
+		return nil, fmt.Errorf("a message can be forwarded to at most %d chats at once", maxForwardTargets)
+	}
+
+	now := time.Now()
+	for _, chatID := range targets {
+		member, err := s.chatRepo.GetChatMember(chatID, userID)
+		if err != nil || member == nil {
+			return nil, ErrForwardNotAllowed
+		}
+		if member.MutedUntil != nil && now.Before(*member.MutedUntil) {
+			return nil, fmt.Errorf("chat %d: %w", chatID, ErrMutedInChat)
+		}
+	}
+
+	return targets, nil
+}
+
+// attribution credits the original author; a forwarded source passes on its own attribution
+func (s *implForwardService) attribution(source *entity.Message) *entity.ForwardedFrom {
+	if source.ForwardedFrom != nil {
+		original := *source.ForwardedFrom
+		return &original
+	}
+
+	forwardedFrom := &entity.ForwardedFrom{
+		MessageID:  source.ID,
+		ChatID:     source.ChatID,
+		AuthorID:   source.CreatedBy,
+		AuthorName: source.DisplayName,
+		SentAt:     source.CreatedAt,
+	}
+	if source.CreatedBy != 0 {
+		if author, err := s.userRepo.GetUserByNumericID(source.CreatedBy); err == nil {
+			forwardedFrom.AuthorName = author.Username
+		}
+	}
+	return forwardedFrom
+}
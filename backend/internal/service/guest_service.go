@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const (
+	guestSweepBatchSize = 100
+	guestStatsWindow    = 24 * time.Hour
+)
+
+// GuestService removes expired guest accounts and reports guest churn
+type GuestService interface {
+	StartJanitor(ctx context.Context)
+	ExpireGuests() (int, error)
+	GetStats() (*entity.GuestStats, error)
+}
+
+type implGuestService struct {
+	userRepo         repository.UserRepository
+	chatRepo         repository.ChatRepository
+	notificationRepo repository.NotificationRepository
+	friendshipRepo   repository.FriendshipRepository
+	draftRepo        repository.DraftRepository
+	threadRepo       repository.ThreadRepository
+	authService      AuthService
+	roomService      RoomService
+	guestTTL         time.Duration
+	interval         time.Duration
+
+	mu               sync.Mutex
+	expiredTotal     int64
+	lastSweepAt      *time.Time
+	lastSweepExpired int
+}
+
+func NewGuestService(
+	userRepo repository.UserRepository,
+	chatRepo repository.ChatRepository,
+	notificationRepo repository.NotificationRepository,
+	friendshipRepo repository.FriendshipRepository,
+	draftRepo repository.DraftRepository,
+	threadRepo repository.ThreadRepository,
+	authService AuthService,
+	roomService RoomService,
+) GuestService {
+	return &implGuestService{
+		userRepo:         userRepo,
+		chatRepo:         chatRepo,
+		notificationRepo: notificationRepo,
+		friendshipRepo:   friendshipRepo,
+		draftRepo:        draftRepo,
+		threadRepo:       threadRepo,
+		authService:      authService,
+		roomService:      roomService,
+		guestTTL:         envDuration("GUEST_TTL", defaultGuestTTL),
+		interval:         envDuration("GUEST_JANITOR_INTERVAL", time.Hour),
+	}
+}
+
+// StartJanitor sweeps expired guests every GUEST_JANITOR_INTERVAL until ctx is cancelled
+func (s *implGuestService) StartJanitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if expired, err := s.ExpireGuests(); err != nil {
+				log.Printf("Error expiring guests: %v", err)
+			} else if expired > 0 {
+				log.Printf("Expired %d guest accounts", expired)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ExpireGuests deletes every expired guest that is not currently connected and returns how many were removed
+func (s *implGuestService) ExpireGuests() (int, error) {
+	online := make(map[int64]bool)
+	for _, userID := range s.roomService.GetOnlineUsers() {
+		online[userID] = true
+	}
+
+	expired := 0
+	skipped := make(map[int64]bool)
+	for {
+		// Skipped guests still match the query, so widen the batch to look past them
+		limit := guestSweepBatchSize + len(skipped)
+		guests, err := s.userRepo.GetExpiredGuests(time.Now(), s.guestTTL, limit)
+		if err != nil {
+			s.recordSweep(expired)
+			return expired, err
+		}
+
+		removed := 0
+		for _, guest := range guests {
+			if skipped[guest.NumericID] {
+				continue
+			}
+
+			// A connected guest is still active; it gets another chance on the next sweep
+			if online[guest.NumericID] {
+				skipped[guest.NumericID] = true
+				continue
+			}
+
+			if err := s.deleteGuest(guest); err != nil {
+				log.Printf("Error deleting expired guest %d: %v", guest.NumericID, err)
+				skipped[guest.NumericID] = true
+				continue
+			}
+			removed++
+		}
+
+		expired += removed
+		if removed == 0 || len(guests) < limit {
+			break
+		}
+	}
+
+	s.recordSweep(expired)
+	return expired, nil
+}
+
+// deleteGuest removes everything tied to the guest; messages stay in their chats without an author
+func (s *implGuestService) deleteGuest(guest *entity.User) error {
+	if err := s.authService.LogoutAll(guest.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.friendshipRepo.DeleteFriendshipsByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.notificationRepo.DeleteNotificationsByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.RemoveMembershipsByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.draftRepo.DeleteDraftsByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.threadRepo.DeleteFollowsByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	// Poll counts are derived from the votes, so removing them also takes the guest out of the results
+	if err := s.chatRepo.DeletePollVotesByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.AnonymizeMessagesByUser(guest.NumericID); err != nil {
+		return err
+	}
+
+	// The user document goes last so a failed sweep can be retried
+	return s.userRepo.DeleteUser(guest.ID)
+}
+
+func (s *implGuestService) recordSweep(expired int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastSweepAt = &now
+	s.lastSweepExpired = expired
+	s.expiredTotal += int64(expired)
+}
+
+func (s *implGuestService) GetStats() (*entity.GuestStats, error) {
+	active, err := s.userRepo.CountGuests()
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-guestStatsWindow)
+	created, err := s.userRepo.CountGuestsCreatedSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	upgraded, err := s.userRepo.CountGuestsUpgradedSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &entity.GuestStats{
+		ActiveGuests:     active,
+		Window:           guestStatsWindow.String(),
+		CreatedInWindow:  created,
+		UpgradedInWindow: upgraded,
+	}
+	if created > 0 {
+		stats.UpgradeRate = float64(upgraded) / float64(created)
+	}
+
+	s.mu.Lock()
+	stats.ExpiredTotal = s.expiredTotal
+	stats.LastSweepAt = s.lastSweepAt
+	stats.LastSweepExpired = s.lastSweepExpired
+	s.mu.Unlock()
+
+	return stats, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxIncomingWebhookAttachments = 10
+	maxDisplayNameLength          = 80
+)
+
+var ErrInvalidWebhookToken = errors.New("invalid webhook token")
+
+// IncomingWebhookService lets chat admins create secret URLs that external tools post messages to
+type IncomingWebhookService interface {
+	// CreateIncomingWebhook returns the webhook and its token, which is shown only once
+	CreateIncomingWebhook(requesterID, chatID int64, name string) (*entity.IncomingWebhook, string, error)
+	GetIncomingWebhooks(requesterID, chatID int64) ([]*entity.IncomingWebhook, error)
+	DeleteIncomingWebhook(requesterID int64, webhookID string) error
+
+	// Post saves the payload as a message in the webhook's chat and broadcasts it to members
+	Post(token string, payload *entity.IncomingWebhookPayload) (*entity.Message, error)
+}
+
+type implIncomingWebhookService struct {
+	webhookRepo repository.WebhookRepository
+	chatRepo    repository.ChatRepository
+	chatService ChatService
+	roomService RoomService
+}
+
+func NewIncomingWebhookService(
+	webhookRepo repository.WebhookRepository,
+	chatRepo repository.ChatRepository,
+	chatService ChatService,
+	roomService RoomService,
+) IncomingWebhookService {
+	return &implIncomingWebhookService{
+		webhookRepo: webhookRepo,
+		chatRepo:    chatRepo,
+		chatService: chatService,
+		roomService: roomService,
+	}
+}
+
+func (s *implIncomingWebhookService) CreateIncomingWebhook(requesterID, chatID int64, name string) (*entity.IncomingWebhook, string, error) {
+	if err := ensureChatAdmin(s.chatRepo, chatID, requesterID); err != nil {
+		return nil, "", err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxDisplayNameLength {
+		return nil, "", fmt.Errorf("name must be 1 to %d characters", maxDisplayNameLength)
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := entity.IncomingWebhookPrefix + secret
+
+	webhook := &entity.IncomingWebhook{
+		ChatID:    chatID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Prefix:    token[:len(entity.IncomingWebhookPrefix)+6],
+		CreatedBy: requesterID,
+	}
+
+	if err := s.webhookRepo.CreateIncomingWebhook(webhook); err != nil {
+		return nil, "", err
+	}
+
+	return webhook, token, nil
+}
+
+func (s *implIncomingWebhookService) GetIncomingWebhooks(requesterID, chatID int64) ([]*entity.IncomingWebhook, error) {
+	if err := ensureChatAdmin(s.chatRepo, chatID, requesterID); err != nil {
+		return nil, err
+	}
+
+	return s.webhookRepo.GetIncomingWebhooksByChat(chatID)
+}
+
+func (s *implIncomingWebhookService) DeleteIncomingWebhook(requesterID int64, webhookID string) error {
+	id, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return errors.New("webhook not found")
+	}
+
+	webhook, err := s.webhookRepo.GetIncomingWebhookByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureChatAdmin(s.chatRepo, webhook.ChatID, requesterID); err != nil {
+		return err
+	}
+
+	return s.webhookRepo.DeleteIncomingWebhook(id)
+}
+
+func (s *implIncomingWebhookService) Post(token string, payload *entity.IncomingWebhookPayload) (*entity.Message, error) {
+	webhook, err := s.webhookRepo.GetIncomingWebhookByHash(hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidWebhookToken
+	}
+
+	text := strings.TrimSpace(payload.Text)
+	if text == "" && len(payload.Attachments) == 0 {
+		return nil, errors.New("text or attachments are required")
+	}
+	if err := validateAttachments(payload.Attachments); err != nil {
+		return nil, err
+	}
+
+	displayName := strings.TrimSpace(payload.DisplayName)
+	if displayName == "" {
+		displayName = webhook.Name
+	}
+	if len(displayName) > maxDisplayNameLength {
+		return nil, fmt.Errorf("display_name must be at most %d characters", maxDisplayNameLength)
+	}
+
+	message := &entity.Message{
+		ChatID:      webhook.ChatID,
+		Content:     text,
+		Type:        entity.Text,
+		WebhookID:   webhook.ID.Hex(),
+		DisplayName: displayName,
+		Attachments: payload.Attachments,
+	}
+
+	// The message length limit is enforced by SendMessage, counted in characters like any other message
+	if err := s.chatService.SendMessage(message); err != nil {
+		return nil, err
+	}
+
+	if err := s.webhookRepo.TouchIncomingWebhook(webhook.ID); err != nil {
+		log.Printf("Error recording use of incoming webhook %s: %v", webhook.ID.Hex(), err)
+	}
+
+	// Same event members receive for a message sent over the WebSocket
+	broadcastMessage(s.roomService, message)
+
+	return message, nil
+}
+
+func validateAttachments(attachments []*entity.Attachment) error {
+	if len(attachments) > maxIncomingWebhookAttachments {
+		return fmt.Errorf("at most %d attachments are allowed", maxIncomingWebhookAttachments)
+	}
+
+	for _, attachment := range attachments {
+		if attachment == nil {
+			return errors.New("invalid attachment")
+		}
+
+		parsed, err := url.Parse(attachment.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("attachment url must be an absolute http or https URL")
+		}
+
+		switch attachment.Type {
+		case "":
+			attachment.Type = entity.File
+		case entity.Image, entity.Video, entity.File:
+		default:
+			return fmt.Errorf("unsupported attachment type %q", attachment.Type)
+		}
+	}
+
+	return nil
+}
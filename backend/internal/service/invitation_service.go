@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
@@ -23,14 +24,27 @@ type InvitationService interface {
 	GetFriendInvitations(userID int64) ([]*entity.FriendInvitation, error)
 	SendFriendRequest(senderID int64, targetIdentifier string) error
 	GetFriendships(userID int64) ([]*entity.Friendship, error)
+	GetFriendSuggestions(userID int64, limit int) ([]*entity.FriendSuggestion, error)
 }
 
+const (
+	mutualFriendWeight = 2
+	sharedChatWeight   = 1
+
+	// Chats larger than this (e.g. the global chat) say nothing about whether two users know each other
+	maxSuggestionChatSize = 100
+
+	defaultSuggestionLimit = 20
+	maxSuggestionLimit     = 50
+)
+
 type implInvitationService struct {
 	invitationRepo  repository.InvitationRepository
 	chatRepo        repository.ChatRepository
 	friendshipRepo  repository.FriendshipRepository
 	notificationSvc NotificationService
 	userRepo        repository.UserRepository
+	webhookService  WebhookService
 }
 
 func NewInvitationService(
@@ -39,6 +53,7 @@ func NewInvitationService(
 	friendshipRepo repository.FriendshipRepository,
 	notificationSvc NotificationService,
 	userRepo repository.UserRepository,
+	webhookService WebhookService,
 ) InvitationService {
 	return &implInvitationService{
 		invitationRepo:  invitationRepo,
@@ -46,6 +61,7 @@ func NewInvitationService(
 		friendshipRepo:  friendshipRepo,
 		notificationSvc: notificationSvc,
 		userRepo:        userRepo,
+		webhookService:  webhookService,
 	}
 }
 
@@ -85,6 +101,7 @@ func (s *implInvitationService) JoinChatViaInvitation(code string, userID int64)
 	if err := s.chatRepo.AddChatMember(member); err != nil {
 		return err
 	}
+	s.webhookService.Publish(invitation.ChatID, entity.WebhookMemberJoined, memberEventData(s.userRepo, member))
 
 	// Increment usage count
 	if err := s.invitationRepo.UseChatInvitation(code); err != nil {
@@ -137,6 +154,10 @@ func (s *implInvitationService) AcceptFriendInvitation(code string, userID int64
 		return fmt.Errorf("cannot accept your own friend invitation")
 	}
 
+	if err := s.ensureRegistered(invitation.UserID, userID); err != nil {
+		return err
+	}
+
 	// Check if users are already friends or have a pending request (both directions)
 	existingFriendship, err := s.friendshipRepo.GetFriendship(invitation.UserID, userID)
 	if err == nil {
@@ -205,6 +226,10 @@ func (s *implInvitationService) SendFriendRequest(senderID int64, targetIdentifi
 		return fmt.Errorf("cannot add yourself as a friend")
 	}
 
+	if err := s.ensureRegistered(senderID, targetUser.NumericID); err != nil {
+		return err
+	}
+
 	// Check if users are already friends or have a pending request (both directions)
 	existingFriendship, err := s.friendshipRepo.GetFriendship(senderID, targetUser.NumericID)
 	if err == nil {
@@ -242,6 +267,24 @@ func (s *implInvitationService) SendFriendRequest(senderID int64, targetIdentifi
 	return nil
 }
 
+// ensureRegistered rejects friendships involving guests, which expire and are garbage collected
+func (s *implInvitationService) ensureRegistered(userIDs ...int64) error {
+	for _, userID := range userIDs {
+		user, err := s.userRepo.GetUserByNumericID(userID)
+		if err != nil {
+			return fmt.Errorf("user not found")
+		}
+		if user.IsGuest {
+			return fmt.Errorf("guest accounts cannot have friends, register to add friends")
+		}
+		if user.IsBot {
+			return fmt.Errorf("bots cannot have friends")
+		}
+	}
+
+	return nil
+}
+
 func (s *implInvitationService) GetFriendships(userID int64) ([]*entity.Friendship, error) {
 	friendships, err := s.friendshipRepo.GetFriendshipsByUser(userID)
 	if err != nil {
@@ -267,3 +310,143 @@ func (s *implInvitationService) GetFriendships(userID int64) ([]*entity.Friendsh
 
 	return friendships, nil
 }
+
+func (s *implInvitationService) GetFriendSuggestions(userID int64, limit int) ([]*entity.FriendSuggestion, error) {
+	relationships, err := s.friendshipRepo.GetAllFriendshipsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip anyone we already have a relationship with; rejected requests may be suggested again
+	excluded := map[int64]bool{userID: true}
+	var friendIDs []int64
+	for _, friendship := range relationships {
+		otherID := friendship.FriendID
+		if otherID == userID {
+			otherID = friendship.UserID
+		}
+
+		switch friendship.Status {
+		case entity.Accepted:
+			friendIDs = append(friendIDs, otherID)
+			excluded[otherID] = true
+		case entity.Pending, entity.Blocked:
+			excluded[otherID] = true
+		}
+	}
+
+	suggestions := make(map[int64]*entity.FriendSuggestion)
+	getSuggestion := func(candidateID int64) *entity.FriendSuggestion {
+		suggestion, ok := suggestions[candidateID]
+		if !ok {
+			suggestion = &entity.FriendSuggestion{
+				MutualFriends: []int64{},
+				SharedChats:   []int64{},
+			}
+			suggestions[candidateID] = suggestion
+		}
+		return suggestion
+	}
+
+	// Friends of friends
+	for _, friendID := range friendIDs {
+		friendships, err := s.friendshipRepo.GetFriendshipsByUser(friendID)
+		if err != nil {
+			continue
+		}
+
+		for _, friendship := range friendships {
+			candidateID := friendship.FriendID
+			if candidateID == friendID {
+				candidateID = friendship.UserID
+			}
+			if excluded[candidateID] {
+				continue
+			}
+
+			suggestion := getSuggestion(candidateID)
+			suggestion.MutualFriends = append(suggestion.MutualFriends, friendID)
+		}
+	}
+
+	// Members of the same group chats
+	chats, err := s.chatRepo.GetChatsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chat := range chats {
+		if chat.Type == entity.Individual {
+			continue
+		}
+
+		members, err := s.chatRepo.GetChatMembers(chat.ID)
+		if err != nil || len(members) > maxSuggestionChatSize {
+			continue
+		}
+
+		for _, member := range members {
+			if excluded[member.UserID] {
+				continue
+			}
+
+			suggestion := getSuggestion(member.UserID)
+			suggestion.SharedChats = append(suggestion.SharedChats, chat.ID)
+		}
+	}
+
+	if limit <= 0 {
+		limit = defaultSuggestionLimit
+	}
+	if limit > maxSuggestionLimit {
+		limit = maxSuggestionLimit
+	}
+
+	// Rank before loading anyone, so only the best candidates are looked up
+	candidateIDs := make([]int64, 0, len(suggestions))
+	for candidateID, suggestion := range suggestions {
+		suggestion.Score = len(suggestion.MutualFriends)*mutualFriendWeight + len(suggestion.SharedChats)*sharedChatWeight
+		candidateIDs = append(candidateIDs, candidateID)
+	}
+	sort.Slice(candidateIDs, func(i, j int) bool {
+		a, b := suggestions[candidateIDs[i]], suggestions[candidateIDs[j]]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return candidateIDs[i] < candidateIDs[j]
+	})
+
+	result := make([]*entity.FriendSuggestion, 0, limit)
+	for _, candidateID := range candidateIDs {
+		if len(result) == limit {
+			break
+		}
+
+		// Users who opted out of search are not suggested to strangers either, nor are guests and bots
+		user, err := s.userRepo.GetUserByNumericID(candidateID)
+		if err != nil || !user.IsDiscoverable() || user.IsGuest || user.IsBot {
+			continue
+		}
+
+		suggestion := suggestions[candidateID]
+		suggestion.User = user.PublicProfile()
+		suggestion.Reasons = []string{}
+		if n := len(suggestion.MutualFriends); n > 0 {
+			suggestion.Reasons = append(suggestion.Reasons, pluralize(n, "mutual friend", "mutual friends"))
+		}
+		if n := len(suggestion.SharedChats); n > 0 {
+			suggestion.Reasons = append(suggestion.Reasons, pluralize(n, "shared group", "shared groups"))
+		}
+
+		result = append(result, suggestion)
+	}
+
+	return result, nil
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
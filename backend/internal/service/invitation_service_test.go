@@ -0,0 +1,114 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+// countingUserRepository counts user lookups by ID
+type countingUserRepository struct {
+	*fakeUserRepository
+	lookups int
+}
+
+func (r *countingUserRepository) GetUserByNumericID(id int64) (*entity.User, error) {
+	r.lookups++
+	return r.fakeUserRepository.GetUserByNumericID(id)
+}
+
+type suggestionTestEnv struct {
+	service     InvitationService
+	users       *countingUserRepository
+	friendships repository.FriendshipRepository
+	chatRepo    repository.ChatRepository
+}
+
+func newSuggestionTestEnv() *suggestionTestEnv {
+	env := &suggestionTestEnv{
+		users:       &countingUserRepository{fakeUserRepository: &fakeUserRepository{}},
+		friendships: repository.NewFriendshipRepository(),
+		chatRepo:    repository.NewChatRepository(),
+	}
+	env.service = NewInvitationService(nil, env.chatRepo, env.friendships, nil, env.users, nil)
+	return env
+}
+
+func (env *suggestionTestEnv) befriend(t *testing.T, userID, friendID int64) {
+	t.Helper()
+
+	if _, err := env.friendships.CreateFriendship(userID, friendID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.friendships.UpdateFriendshipStatus(userID, friendID, entity.Accepted); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFriendSuggestionsSkipGuestsBotsAndHiddenUsers(t *testing.T) {
+	env := newSuggestionTestEnv()
+	hidden := false
+	for _, user := range []entity.User{
+		{NumericID: 1, Username: "me"},
+		{NumericID: 2, Username: "friend"},
+		{NumericID: 3, Username: "guest", IsGuest: true},
+		{NumericID: 4, Username: "bot", IsBot: true},
+		{NumericID: 5, Username: "stranger"},
+		{NumericID: 6, Username: "hidden", Discoverable: &hidden},
+	} {
+		env.users.add(user)
+	}
+	env.befriend(t, 1, 2)
+	for _, candidateID := range []int64{3, 4, 5, 6} {
+		env.befriend(t, 2, candidateID)
+	}
+
+	suggestions, err := env.service.GetFriendSuggestions(1, 10)
+	if err != nil {
+		t.Fatalf("GetFriendSuggestions: %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].User.NumericID != 5 {
+		t.Fatalf("got %d suggestions, want only the registered, discoverable user", len(suggestions))
+	}
+	if len(suggestions[0].MutualFriends) != 1 || suggestions[0].MutualFriends[0] != 2 {
+		t.Fatalf("mutual friends = %v, want the shared friend", suggestions[0].MutualFriends)
+	}
+}
+
+func TestFriendSuggestionsLimit(t *testing.T) {
+	env := newSuggestionTestEnv()
+	env.users.add(entity.User{NumericID: 1, Username: "me"})
+	env.users.add(entity.User{NumericID: 2, Username: "friend"})
+	env.befriend(t, 1, 2)
+
+	// Sixty group members, the last of whom is also a friend of a friend and so ranks first
+	members := map[int64]string{1: "member"}
+	for id := int64(100); id < 160; id++ {
+		env.users.add(entity.User{NumericID: id, Username: "member"})
+		members[id] = "member"
+	}
+	newTestChat(t, env.chatRepo, members)
+	env.befriend(t, 2, 159)
+
+	for _, tc := range []struct{ limit, want int }{
+		{0, defaultSuggestionLimit},
+		{1000, maxSuggestionLimit},
+		{5, 5},
+	} {
+		env.users.lookups = 0
+		suggestions, err := env.service.GetFriendSuggestions(1, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(suggestions) != tc.want {
+			t.Fatalf("limit %d: got %d suggestions, want %d", tc.limit, len(suggestions), tc.want)
+		}
+		if env.users.lookups != tc.want {
+			t.Fatalf("limit %d: looked up %d users, want only the %d returned", tc.limit, env.users.lookups, tc.want)
+		}
+		if suggestions[0].User.NumericID != 159 || suggestions[1].User.NumericID != 100 {
+			t.Fatalf("limit %d: ranked %d, %d first", tc.limit, suggestions[0].User.NumericID, suggestions[1].User.NumericID)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+const (
+	legacyKeyID       = "default"
+	placeholderSecret = "your-secret-key-change-this-in-production"
+	minSecretLength   = 32
+)
+
+// signingKey is one configured JWT key; verification-only keys have no private half
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyProvider holds the keys used to sign and verify access tokens
+type KeyProvider interface {
+	// Sign signs the claims with the active key and sets the kid header
+	Sign(claims jwt.Claims) (string, error)
+	// Keyfunc resolves the verification key for a parsed token, checking its algorithm
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// ValidMethods lists the algorithms of the configured keys
+	ValidMethods() []string
+	// JWKS publishes the public halves of the asymmetric keys
+	JWKS() entity.JWKSet
+}
+
+type implKeyProvider struct {
+	keys   map[string]*signingKey
+	active *signingKey
+}
+
+// LoadKeyProvider reads keys from the environment:
+//
+//	JWT_KEYS        comma separated kid:alg:path entries, alg is HS256, RS256 or EdDSA; path is a PEM private
+//	                key (or public key for verification only) or, for HS256, a file holding the secret
+//	JWT_ACTIVE_KID  the key that signs new tokens, defaults to the first entry
+//	JWT_SECRET      a single HS256 secret used when JWT_KEYS is empty
+//
+// In production (APP_ENV=production) a missing or placeholder key is an error; elsewhere a random
+// throwaway secret is generated so tokens only survive until restart.
+func LoadKeyProvider() (KeyProvider, error) {
+	production := os.Getenv("APP_ENV") == "production"
+	provider := &implKeyProvider{keys: make(map[string]*signingKey)}
+
+	var order []string
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, err := loadSigningKey(entry, production)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := provider.keys[key.id]; exists {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.id)
+		}
+
+		provider.keys[key.id] = key
+		order = append(order, key.id)
+	}
+
+	if len(order) == 0 {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" || secret == placeholderSecret {
+			if production {
+				return nil, errors.New("no JWT key configured: set JWT_KEYS or JWT_SECRET")
+			}
+
+			random, err := generateSecureToken()
+			if err != nil {
+				return nil, err
+			}
+			secret = random
+			log.Println("Warning: no JWT key configured, using a random secret; tokens will not survive a restart")
+		} else if len(secret) < minSecretLength {
+			if production {
+				return nil, fmt.Errorf("JWT_SECRET must be at least %d characters", minSecretLength)
+			}
+			log.Printf("Warning: JWT_SECRET is shorter than %d characters", minSecretLength)
+		}
+
+		provider.keys[legacyKeyID] = &signingKey{
+			id:        legacyKeyID,
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(secret),
+			verifyKey: []byte(secret),
+		}
+		order = append(order, legacyKeyID)
+	}
+
+	activeID := os.Getenv("JWT_ACTIVE_KID")
+	if activeID == "" {
+		activeID = order[0]
+	}
+
+	active, ok := provider.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("JWT_ACTIVE_KID %q is not in JWT_KEYS", activeID)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("JWT key %q has no private key and cannot sign", activeID)
+	}
+	provider.active = active
+
+	return provider, nil
+}
+
+// MustLoadKeyProvider refuses to start the server without usable keys
+func MustLoadKeyProvider() KeyProvider {
+	provider, err := LoadKeyProvider()
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	return provider
+}
+
+func loadSigningKey(entry string, production bool) (*signingKey, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid:alg:path", entry)
+	}
+	id, alg, path := parts[0], parts[1], parts[2]
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("JWT key %q: %w", id, err)
+	}
+
+	key := &signingKey{id: id}
+	switch alg {
+	case "HS256":
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) < minSecretLength {
+			if production {
+				return nil, fmt.Errorf("JWT key %q: secret must be at least %d bytes", id, minSecretLength)
+			}
+			log.Printf("Warning: JWT key %q is shorter than %d bytes", id, minSecretLength)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = secret
+		key.verifyKey = secret
+
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("JWT key %q: not an RSA PEM key", id)
+		}
+
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key.signKey = private
+			key.verifyKey = private.(ed25519.PrivateKey).Public()
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("JWT key %q: not an Ed25519 PEM key", id)
+		}
+
+	default:
+		return nil, fmt.Errorf("JWT key %q: unsupported algorithm %q", id, alg)
+	}
+
+	return key, nil
+}
+
+func (p *implKeyProvider) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(p.active.method, claims)
+	token.Header["kid"] = p.active.id
+	return token.SignedString(p.active.signKey)
+}
+
+func (p *implKeyProvider) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens issued before key IDs were introduced
+		kid = legacyKeyID
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	// Never let the token pick the algorithm, e.g. HS256 with an RSA public key as the secret
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+
+	return key.verifyKey, nil
+}
+
+func (p *implKeyProvider) ValidMethods() []string {
+	seen := make(map[string]bool)
+	methods := []string{}
+	for _, key := range p.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+func (p *implKeyProvider) JWKS() entity.JWKSet {
+	set := entity.JWKSet{Keys: []entity.JWK{}}
+	for _, key := range p.keys {
+		// HMAC secrets are never published
+		if _, ok := key.verifyKey.([]byte); ok {
+			continue
+		}
+
+		jwk, err := NewPublicJWK(key.id, key.method.Alg(), key.verifyKey)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
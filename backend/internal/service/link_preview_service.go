@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"golang.org/x/net/html"
+)
+
+const (
+	maxLinkPreviewsPerMessage    = 3
+	maxLinkPreviewURLLength      = 2048
+	maxLinkPreviewRedirects      = 3
+	maxLinkPreviewTitleLength    = 200
+	maxLinkPreviewDescription    = 500
+	linkPreviewFailureTTL        = time.Hour
+	linkPreviewUserAgent         = "Mozilla/5.0 (compatible; ChatLinkPreview/1.0)"
+	defaultLinkPreviewMaxBytes   = 512 * 1024
+	defaultLinkPreviewConcurrent = 4
+)
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// LinkPreviewService attaches OpenGraph previews to messages that contain links
+type LinkPreviewService interface {
+	// CachedPreviews returns the previews of the message's links that are already cached,
+	// and the links that still have to be fetched
+	CachedPreviews(content string) ([]*entity.LinkPreview, []string)
+	// FetchAsync fetches the pending links in the background, stores every preview on the saved
+	// message and broadcasts message_updated once they are ready
+	FetchAsync(message *entity.Message, pending []string)
+	// FetchPreview downloads and parses one URL, refusing anything that resolves to a private address
+	FetchPreview(ctx context.Context, rawURL string) (*entity.LinkPreview, error)
+}
+
+type implLinkPreviewService struct {
+	previewRepo repository.LinkPreviewRepository
+	chatRepo    repository.ChatRepository
+	roomService RoomService
+	client      *http.Client
+	timeout     time.Duration
+	maxBytes    int64
+	cacheTTL    time.Duration
+	fetchSlots  chan struct{}
+	now         func() time.Time
+}
+
+func NewLinkPreviewService(
+	previewRepo repository.LinkPreviewRepository,
+	chatRepo repository.ChatRepository,
+	roomService RoomService,
+) LinkPreviewService {
+	timeout := envDuration("LINK_PREVIEW_TIMEOUT", 5*time.Second)
+
+	return &implLinkPreviewService{
+		previewRepo: previewRepo,
+		chatRepo:    chatRepo,
+		roomService: roomService,
+		client:      newLinkPreviewClient(timeout, isPublicAddr),
+		timeout:     timeout,
+		maxBytes:    int64(envInt("LINK_PREVIEW_MAX_BYTES", defaultLinkPreviewMaxBytes)),
+		cacheTTL:    envDuration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour),
+		fetchSlots:  make(chan struct{}, envInt("LINK_PREVIEW_CONCURRENCY", defaultLinkPreviewConcurrent)),
+		now:         time.Now,
+	}
+}
+
+// newLinkPreviewClient only connects to addresses allow accepts, isPublicAddr outside tests,
+// and follows a few http(s) redirects
+func newLinkPreviewClient(timeout time.Duration, allow addressPolicy) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: newOutboundTransport(timeout, allow),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxLinkPreviewRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+func (s *implLinkPreviewService) CachedPreviews(content string) ([]*entity.LinkPreview, []string) {
+	links := extractLinks(content)
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	cached, err := s.previewRepo.GetCachedPreviews(links, s.now())
+	if err != nil {
+		log.Printf("Error reading cached link previews: %v", err)
+		cached = nil
+	}
+
+	var previews []*entity.LinkPreview
+	var pending []string
+	for _, link := range links {
+		entry, ok := cached[link]
+		switch {
+		case !ok:
+			pending = append(pending, link)
+		case !entry.Failed:
+			previews = append(previews, entry.Preview)
+		}
+	}
+
+	return previews, pending
+}
+
+func (s *implLinkPreviewService) FetchAsync(message *entity.Message, pending []string) {
+	if len(pending) == 0 {
+		return
+	}
+
+	// The caller keeps using the message, so the goroutine only takes what it needs
+	messageID := message.ID
+	links := extractLinks(message.Content)
+	known := make(map[string]*entity.LinkPreview, len(message.LinkPreviews))
+	for _, preview := range message.LinkPreviews {
+		known[preview.URL] = preview
+	}
+
+	go func() {
+		fetched := false
+		for _, link := range pending {
+			if preview := s.fetchAndCache(link); preview != nil {
+				known[link] = preview
+				fetched = true
+			}
+		}
+		if !fetched {
+			return
+		}
+
+		previews := make([]*entity.LinkPreview, 0, len(links))
+		for _, link := range links {
+			if preview, ok := known[link]; ok {
+				previews = append(previews, preview)
+			}
+		}
+
+		updated, err := s.chatRepo.SetMessageLinkPreviews(messageID, previews)
+		if err != nil {
+			// The message may have been deleted or expired while the previews were fetched
+			log.Printf("Error attaching link previews to message %d: %v", messageID, err)
+			return
+		}
+
+		broadcastEvent(s.roomService, updated.ChatID, entity.Event{
+			Type: entity.MESSAGE_UPDATED,
+			Data: map[string]interface{}{
+				"chat_id":       updated.ChatID,
+				"message_id":    updated.ID,
+				"link_previews": updated.LinkPreviews,
+				"message":       updated,
+			},
+		})
+	}()
+}
+
+// fetchAndCache fetches a preview, waiting for a free fetch slot, and caches the outcome
+func (s *implLinkPreviewService) fetchAndCache(link string) *entity.LinkPreview {
+	s.fetchSlots <- struct{}{}
+	defer func() { <-s.fetchSlots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	now := s.now()
+	entry := &entity.CachedLinkPreview{URL: link, FetchedAt: now, ExpiresAt: now.Add(s.cacheTTL)}
+
+	preview, err := s.FetchPreview(ctx, link)
+	if err != nil {
+		log.Printf("Link preview for %s failed: %v", link, err)
+		entry.Failed = true
+		entry.ExpiresAt = now.Add(linkPreviewFailureTTL)
+	} else {
+		entry.Preview = preview
+	}
+
+	if err := s.previewRepo.SaveCachedPreview(entry); err != nil {
+		log.Printf("Error caching link preview for %s: %v", link, err)
+	}
+
+	return preview
+}
+
+func (s *implLinkPreviewService) FetchPreview(ctx context.Context, rawURL string) (*entity.LinkPreview, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return nil, errors.New("link must be an absolute http or https URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", linkPreviewUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	// Metadata lives in <head>, anything past the limit is never read
+	preview := parseLinkPreview(io.LimitReader(resp.Body, s.maxBytes), resp.Request.URL)
+	if preview.Title == "" && preview.Description == "" {
+		return nil, errors.New("page has no title or description")
+	}
+
+	preview.URL = rawURL
+	return preview, nil
+}
+
+// parseLinkPreview reads OpenGraph tags, falling back to <title> and the description meta tag
+func parseLinkPreview(body io.Reader, base *url.URL) *entity.LinkPreview {
+	var title, ogTitle, description, ogDescription, image, siteName string
+
+	tokenizer := html.NewTokenizer(body)
+	for done := false; !done; {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			done = true
+
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "head" {
+				done = true
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "body":
+				done = true
+			case "title":
+				if title == "" && tokenizer.Next() == html.TextToken {
+					title = string(tokenizer.Text())
+				}
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var attr, value []byte
+					attr, value, hasAttr = tokenizer.TagAttr()
+					switch string(attr) {
+					case "property", "name":
+						key = strings.ToLower(string(value))
+					case "content":
+						content = string(value)
+					}
+				}
+
+				switch key {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "description":
+					description = content
+				case "og:image", "og:image:url":
+					if image == "" {
+						image = content
+					}
+				case "og:site_name":
+					siteName = content
+				}
+			}
+		}
+	}
+
+	preview := &entity.LinkPreview{
+		Title:       truncateText(firstNonEmpty(ogTitle, title), maxLinkPreviewTitleLength),
+		Description: truncateText(firstNonEmpty(ogDescription, description), maxLinkPreviewDescription),
+		SiteName:    truncateText(siteName, maxLinkPreviewTitleLength),
+	}
+
+	if image != "" {
+		if ref, err := url.Parse(strings.TrimSpace(image)); err == nil {
+			resolved := base.ResolveReference(ref)
+			if resolved.Scheme == "http" || resolved.Scheme == "https" {
+				preview.ImageURL = resolved.String()
+			}
+		}
+	}
+
+	return preview
+}
+
+// extractLinks returns the distinct http(s) links in the content, in order, up to the per-message limit
+func extractLinks(content string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range linkPattern.FindAllString(content, -1) {
+		// Punctuation closing a sentence or bracket is not part of the link
+		link := strings.TrimRight(match, ".,;:!?)]}'")
+		if len(link) > maxLinkPreviewURLLength || seen[link] {
+			continue
+		}
+
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == maxLinkPreviewsPerMessage {
+			break
+		}
+	}
+	return links
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncateText collapses whitespace and cuts the text to at most limit characters
+func truncateText(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > limit {
+		return strings.TrimSpace(string(runes[:limit-1])) + "…"
+	}
+	return text
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allowLoopbackForTests lets the client reach httptest servers while still refusing every
+// other non-public address
+func allowLoopbackForTests(addr netip.Addr) bool {
+	return addr.Unmap().IsLoopback() || isPublicAddr(addr)
+}
+
+func newLinkPreviewTestService(t *testing.T, handler http.HandlerFunc) (*implLinkPreviewService, *httptest.Server) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	s := NewLinkPreviewService(nil, nil, nil).(*implLinkPreviewService)
+	s.timeout = 2 * time.Second
+	s.maxBytes = defaultLinkPreviewMaxBytes
+	s.client = newLinkPreviewClient(s.timeout, allowLoopbackForTests)
+	return s, server
+}
+
+func serveHTML(page string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	}
+}
+
+func TestFetchPreviewPrefersOpenGraph(t *testing.T) {
+	s, server := newLinkPreviewTestService(t, serveHTML(`<!DOCTYPE html>
+<html><head>
+<title>Plain title</title>
+<meta name="description" content="Plain description">
+<meta property="og:title" content="  OpenGraph   title ">
+<meta property="og:description" content="OpenGraph description">
+<meta property="og:image" content="/images/cover.png">
+<meta property="og:site_name" content="Example">
+</head><body><meta property="og:title" content="Ignored"></body></html>`))
+
+	preview, err := s.FetchPreview(context.Background(), server.URL+"/article")
+	if err != nil {
+		t.Fatalf("FetchPreview: %v", err)
+	}
+
+	if preview.Title != "OpenGraph title" {
+		t.Errorf("title = %q", preview.Title)
+	}
+	if preview.Description != "OpenGraph description" {
+		t.Errorf("description = %q", preview.Description)
+	}
+	if preview.SiteName != "Example" {
+		t.Errorf("site name = %q", preview.SiteName)
+	}
+	if want := server.URL + "/images/cover.png"; preview.ImageURL != want {
+		t.Errorf("image = %q, want %q", preview.ImageURL, want)
+	}
+	if preview.URL != server.URL+"/article" {
+		t.Errorf("url = %q", preview.URL)
+	}
+}
+
+func TestFetchPreviewFallsBackToTitle(t *testing.T) {
+	s, server := newLinkPreviewTestService(t, serveHTML(`<html><head>
+<title>Release notes</title>
+<meta name="description" content="What changed in this version">
+<meta property="og:image" content="javascript:alert(1)">
+</head></html>`))
+
+	preview, err := s.FetchPreview(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("FetchPreview: %v", err)
+	}
+
+	if preview.Title != "Release notes" || preview.Description != "What changed in this version" {
+		t.Errorf("title = %q, description = %q", preview.Title, preview.Description)
+	}
+	if preview.ImageURL != "" {
+		t.Errorf("non-http image was kept: %q", preview.ImageURL)
+	}
+}
+
+func TestFetchPreviewRejectsNonHTML(t *testing.T) {
+	s, server := newLinkPreviewTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"title":"not a page"}`)
+	})
+
+	if _, err := s.FetchPreview(context.Background(), server.URL); err == nil {
+		t.Fatal("expected a JSON response to be refused")
+	}
+}
+
+func TestFetchPreviewStopsAtSizeLimit(t *testing.T) {
+	padding := "<!--" + strings.Repeat("x", 4096) + "-->"
+	s, server := newLinkPreviewTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/late" {
+			io.WriteString(w, "<html><head>"+padding+"<title>Too late</title></head></html>")
+			return
+		}
+		io.WriteString(w, "<html><head><title>In time</title>"+padding+"</head></html>")
+	})
+	s.maxBytes = 1024
+
+	preview, err := s.FetchPreview(context.Background(), server.URL+"/early")
+	if err != nil {
+		t.Fatalf("FetchPreview: %v", err)
+	}
+	if preview.Title != "In time" {
+		t.Errorf("title = %q", preview.Title)
+	}
+
+	if preview, err := s.FetchPreview(context.Background(), server.URL+"/late"); err == nil {
+		t.Fatalf("read past the size limit, got title %q", preview.Title)
+	}
+}
+
+func TestFetchPreviewTimesOut(t *testing.T) {
+	s, server := newLinkPreviewTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	s.client = newLinkPreviewClient(100*time.Millisecond, allowLoopbackForTests)
+
+	started := time.Now()
+	if _, err := s.FetchPreview(context.Background(), server.URL); err == nil {
+		t.Fatal("expected the slow page to time out")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("fetch took %v despite the timeout", elapsed)
+	}
+}
+
+func TestFetchPreviewRefusesRedirectToPrivateAddress(t *testing.T) {
+	for _, target := range []string{
+		"http://10.0.0.1/admin",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[fd00::1]/",
+	} {
+		s, server := newLinkPreviewTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target, http.StatusFound)
+		})
+
+		_, err := s.FetchPreview(context.Background(), server.URL)
+		if err == nil {
+			t.Fatalf("followed a redirect to %s", target)
+		}
+		if !strings.Contains(err.Error(), "non-public address") {
+			t.Fatalf("redirect to %s failed for the wrong reason: %v", target, err)
+		}
+	}
+}
+
+func TestLinkPreviewClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(serveHTML("<title>internal</title>"))
+	defer server.Close()
+
+	s := NewLinkPreviewService(nil, nil, nil).(*implLinkPreviewService)
+	if _, err := s.FetchPreview(context.Background(), server.URL); err == nil {
+		t.Fatal("the production client reached a loopback server")
+	}
+}
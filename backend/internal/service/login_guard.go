@@ -0,0 +1,275 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const (
+	defaultLoginFreeAttempts    = 3
+	defaultLoginLockoutAttempts = 10
+	// Every IP can be shared by many users (NAT, offices), so it gets more room than a single username
+	ipAttemptsMultiplier = 5
+	maxLoginBackoff      = 5 * time.Minute
+)
+
+// LockoutError is returned while a username or IP has to wait before trying again
+type LockoutError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LockoutError) Error() string {
+	wait := int(math.Ceil(e.RetryAfter.Seconds()))
+	if e.Locked {
+		return fmt.Sprintf("too many failed login attempts, account temporarily locked, try again in %d seconds", wait)
+	}
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", wait)
+}
+
+// LockoutNotifier is told when a username becomes locked
+type LockoutNotifier interface {
+	NotifyLockout(username string, until time.Time)
+}
+
+// LoginGuard tracks failed logins per username and per IP, slowing them down exponentially and locking them out
+type LoginGuard interface {
+	// Allow reports whether a login may be attempted now; empty username or ip are not checked
+	Allow(username, ip string) error
+	RecordFailure(username, ip string)
+	RecordSuccess(username string)
+	ClearLockout(username string)
+	ClearIP(ip string)
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type implLoginGuard struct {
+	attempts        map[string]*loginAttempts
+	freeAttempts    int
+	lockoutAttempts int
+	lockoutDuration time.Duration
+	notifier        LockoutNotifier
+	mu              sync.Mutex
+	now             func() time.Time
+}
+
+func NewLoginGuard(notifier LockoutNotifier) LoginGuard {
+	return &implLoginGuard{
+		attempts:        make(map[string]*loginAttempts),
+		freeAttempts:    envInt("LOGIN_FREE_ATTEMPTS", defaultLoginFreeAttempts),
+		lockoutAttempts: envInt("LOGIN_LOCKOUT_ATTEMPTS", defaultLoginLockoutAttempts),
+		lockoutDuration: envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		notifier:        notifier,
+		now:             time.Now,
+	}
+}
+
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (g *implLoginGuard) Allow(username, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	var worst *LockoutError
+
+	check := func(key string, multiplier int) {
+		attempts := g.current(key, now)
+		if attempts == nil {
+			return
+		}
+
+		var lockErr *LockoutError
+		if now.Before(attempts.lockedUntil) {
+			lockErr = &LockoutError{RetryAfter: attempts.lockedUntil.Sub(now), Locked: true}
+		} else if backoff := g.backoff(attempts.failures, multiplier); backoff > 0 {
+			if next := attempts.lastFailure.Add(backoff); now.Before(next) {
+				lockErr = &LockoutError{RetryAfter: next.Sub(now)}
+			}
+		}
+
+		if lockErr != nil && (worst == nil || lockErr.RetryAfter > worst.RetryAfter) {
+			worst = lockErr
+		}
+	}
+
+	if username != "" {
+		check(usernameKey(username), 1)
+	}
+	if ip != "" {
+		check(ipKey(ip), ipAttemptsMultiplier)
+	}
+
+	if worst != nil {
+		return worst
+	}
+	return nil
+}
+
+func (g *implLoginGuard) RecordFailure(username, ip string) {
+	g.mu.Lock()
+
+	now := g.now()
+	var lockedUntil time.Time
+	if username != "" {
+		if g.recordFailure(usernameKey(username), now, 1) {
+			lockedUntil = g.attempts[usernameKey(username)].lockedUntil
+		}
+	}
+	if ip != "" {
+		if g.recordFailure(ipKey(ip), now, ipAttemptsMultiplier) {
+			log.Printf("Login attempts from %s locked until %s", ip, now.Add(g.lockoutDuration).Format(time.RFC3339))
+		}
+	}
+
+	g.mu.Unlock()
+
+	// Notify outside the lock, the notifier may be slow (e.g. sending mail)
+	if !lockedUntil.IsZero() && g.notifier != nil {
+		g.notifier.NotifyLockout(username, lockedUntil)
+	}
+}
+
+// recordFailure returns true when this failure locked the key
+func (g *implLoginGuard) recordFailure(key string, now time.Time, multiplier int) bool {
+	attempts := g.current(key, now)
+	if attempts == nil {
+		attempts = &loginAttempts{}
+		g.attempts[key] = attempts
+	}
+
+	attempts.failures++
+	attempts.lastFailure = now
+
+	if attempts.failures >= g.lockoutAttempts*multiplier && !now.Before(attempts.lockedUntil) {
+		attempts.lockedUntil = now.Add(g.lockoutDuration)
+		// Start over once the lockout ends, so the next failure does not immediately lock again
+		attempts.failures = 0
+		return true
+	}
+
+	return false
+}
+
+// current returns the live counters for key, forgetting them once they have been idle for a lockout period
+func (g *implLoginGuard) current(key string, now time.Time) *loginAttempts {
+	attempts, ok := g.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	if now.Before(attempts.lockedUntil) || now.Sub(attempts.lastFailure) < g.lockoutDuration {
+		return attempts
+	}
+
+	delete(g.attempts, key)
+	return nil
+}
+
+// backoff doubles the wait for every failure past the free attempts
+func (g *implLoginGuard) backoff(failures, multiplier int) time.Duration {
+	extra := failures - g.freeAttempts*multiplier
+	if extra <= 0 {
+		return 0
+	}
+	if extra > 20 {
+		return maxLoginBackoff
+	}
+
+	backoff := time.Second << (extra - 1)
+	if backoff > maxLoginBackoff {
+		return maxLoginBackoff
+	}
+	return backoff
+}
+
+// RecordSuccess forgets the username's failures; IP counters are kept so one valid account cannot reset them
+func (g *implLoginGuard) RecordSuccess(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if attempts, ok := g.attempts[usernameKey(username)]; ok && !g.now().Before(attempts.lockedUntil) {
+		delete(g.attempts, usernameKey(username))
+	}
+}
+
+func (g *implLoginGuard) ClearLockout(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.attempts, usernameKey(username))
+}
+
+func (g *implLoginGuard) ClearIP(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.attempts, ipKey(ip))
+}
+
+type mailLockoutNotifier struct {
+	userRepo repository.UserRepository
+	mailer   Mailer
+}
+
+// NewMailLockoutNotifier emails the account owner when their username gets locked
+func NewMailLockoutNotifier(userRepo repository.UserRepository, mailer Mailer) LockoutNotifier {
+	return &mailLockoutNotifier{
+		userRepo: userRepo,
+		mailer:   mailer,
+	}
+}
+
+func (n *mailLockoutNotifier) NotifyLockout(username string, until time.Time) {
+	log.Printf("Login for %q locked until %s", username, until.Format(time.RFC3339))
+
+	user, err := n.userRepo.GetUserByUsername(username)
+	if err != nil || user.Email == "" {
+		return
+	}
+
+	err = n.mailer.Send(&Mail{
+		To:      user.Email,
+		Subject: "Your account has been temporarily locked",
+		Body: fmt.Sprintf("Hi %s,\n\nThere were too many failed attempts to sign in to your account, so signing in is blocked until %s.\n\nIf this was not you, reset your password now; doing so also lifts the lock:\n%s/reset-password",
+			user.Name, until.Format(time.RFC1123), os.Getenv("FRONTEND_URL")),
+	})
+	if err != nil {
+		log.Printf("Error sending lockout email to user %d: %v", user.NumericID, err)
+	}
+}
+
+// envInt reads a positive integer from the environment
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Warning: invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+
+	return parsed
+}
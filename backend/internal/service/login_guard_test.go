@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingLockoutNotifier struct {
+	mu      sync.Mutex
+	lockout map[string]time.Time
+}
+
+func (n *recordingLockoutNotifier) NotifyLockout(username string, until time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lockout[username] = until
+}
+
+type loginGuardTestEnv struct {
+	guard    *implLoginGuard
+	notifier *recordingLockoutNotifier
+	clock    *testClock
+}
+
+func newLoginGuardTestEnv() *loginGuardTestEnv {
+	env := &loginGuardTestEnv{
+		notifier: &recordingLockoutNotifier{lockout: make(map[string]time.Time)},
+		clock:    newTestClock(),
+	}
+
+	env.guard = NewLoginGuard(env.notifier).(*implLoginGuard)
+	env.guard.freeAttempts = 3
+	env.guard.lockoutAttempts = 10
+	env.guard.lockoutDuration = 15 * time.Minute
+	env.guard.now = env.clock.Now
+	return env
+}
+
+func (env *loginGuardTestEnv) fail(username, ip string, times int) {
+	for i := 0; i < times; i++ {
+		env.guard.RecordFailure(username, ip)
+	}
+}
+
+// lockoutErr fails the test unless Allow refused the attempt
+func lockoutErr(t *testing.T, err error) *LockoutError {
+	t.Helper()
+
+	var lockErr *LockoutError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a LockoutError, got %v", err)
+	}
+	return lockErr
+}
+
+func TestLoginGuardUsernameBackoff(t *testing.T) {
+	env := newLoginGuardTestEnv()
+
+	env.fail("alice", "", 3)
+	if err := env.guard.Allow("alice", ""); err != nil {
+		t.Fatalf("free attempts were slowed down: %v", err)
+	}
+
+	// Each failure past the free ones doubles the wait
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		env.fail("alice", "", 1)
+
+		lockErr := lockoutErr(t, env.guard.Allow("alice", ""))
+		if lockErr.Locked || lockErr.RetryAfter != want {
+			t.Fatalf("failure %d: retry after %v (locked=%v), want %v", 4+i, lockErr.RetryAfter, lockErr.Locked, want)
+		}
+
+		env.clock.Advance(want - time.Millisecond)
+		if err := env.guard.Allow("alice", ""); err == nil {
+			t.Fatalf("failure %d: allowed before the backoff elapsed", 4+i)
+		}
+		env.clock.Advance(time.Millisecond)
+		if err := env.guard.Allow("alice", ""); err != nil {
+			t.Fatalf("failure %d: still refused after the backoff: %v", 4+i, err)
+		}
+	}
+
+	// Usernames are matched case-insensitively, other usernames are unaffected
+	env.fail("ALICE", "", 1)
+	if err := env.guard.Allow("Alice", ""); err == nil {
+		t.Fatal("a differently cased username escaped the backoff")
+	}
+	if err := env.guard.Allow("bob", ""); err != nil {
+		t.Fatalf("another username was slowed down: %v", err)
+	}
+}
+
+func TestLoginGuardUsernameLockoutExpires(t *testing.T) {
+	env := newLoginGuardTestEnv()
+
+	env.fail("alice", "203.0.113.7", 10)
+	lockErr := lockoutErr(t, env.guard.Allow("alice", ""))
+	if !lockErr.Locked || lockErr.RetryAfter != 15*time.Minute {
+		t.Fatalf("retry after %v (locked=%v), want a 15m lockout", lockErr.RetryAfter, lockErr.Locked)
+	}
+	if until, ok := env.notifier.lockout["alice"]; !ok || !until.Equal(env.clock.Now().Add(15*time.Minute)) {
+		t.Fatalf("owner was not notified of the lockout until %v", env.clock.Now().Add(15*time.Minute))
+	}
+
+	// A correct password does not lift an active lockout
+	env.guard.RecordSuccess("alice")
+	if err := env.guard.Allow("alice", ""); err == nil {
+		t.Fatal("a successful login lifted the lockout")
+	}
+
+	env.clock.Advance(15 * time.Minute)
+	if err := env.guard.Allow("alice", ""); err != nil {
+		t.Fatalf("still locked after the lockout ended: %v", err)
+	}
+
+	// The count starts over, so the next failure is free again
+	env.fail("alice", "", 1)
+	if err := env.guard.Allow("alice", ""); err != nil {
+		t.Fatalf("first failure after the lockout was slowed down: %v", err)
+	}
+}
+
+func TestLoginGuardPerIP(t *testing.T) {
+	env := newLoginGuardTestEnv()
+	const ip = "198.51.100.20"
+
+	// Spread over many usernames, so only the IP counter builds up; it gets five times the room
+	for i := 0; i < 15; i++ {
+		env.guard.RecordFailure(string(rune('a'+i))+"-user", ip)
+	}
+	if err := env.guard.Allow("", ip); err != nil {
+		t.Fatalf("IP was slowed down within its free attempts: %v", err)
+	}
+
+	env.guard.RecordFailure("someone", ip)
+	lockErr := lockoutErr(t, env.guard.Allow("", ip))
+	if lockErr.Locked || lockErr.RetryAfter != time.Second {
+		t.Fatalf("retry after %v (locked=%v), want 1s", lockErr.RetryAfter, lockErr.Locked)
+	}
+	if err := env.guard.Allow("", "198.51.100.21"); err != nil {
+		t.Fatalf("another IP was slowed down: %v", err)
+	}
+
+	env.fail("", ip, 50-16)
+	lockErr = lockoutErr(t, env.guard.Allow("", ip))
+	if !lockErr.Locked {
+		t.Fatal("IP was not locked after 50 failures")
+	}
+	if len(env.notifier.lockout) != 0 {
+		t.Fatal("an IP lockout was mailed to a user")
+	}
+
+	// A valid login from the IP does not reset its counter
+	env.guard.RecordSuccess("someone")
+	if err := env.guard.Allow("", ip); err == nil {
+		t.Fatal("a successful login lifted the IP lockout")
+	}
+
+	env.clock.Advance(15 * time.Minute)
+	if err := env.guard.Allow("", ip); err != nil {
+		t.Fatalf("IP still locked after the lockout ended: %v", err)
+	}
+}
+
+func TestLoginGuardReportsLongestWait(t *testing.T) {
+	env := newLoginGuardTestEnv()
+
+	env.fail("alice", "", 10)
+	env.fail("", "192.0.2.1", 16)
+
+	lockErr := lockoutErr(t, env.guard.Allow("alice", "192.0.2.1"))
+	if !lockErr.Locked || lockErr.RetryAfter != 15*time.Minute {
+		t.Fatalf("retry after %v (locked=%v), want the username lockout", lockErr.RetryAfter, lockErr.Locked)
+	}
+}
+
+func TestLoginGuardForgetsIdleFailures(t *testing.T) {
+	env := newLoginGuardTestEnv()
+
+	env.fail("alice", "", 5)
+	env.clock.Advance(15 * time.Minute)
+	env.fail("alice", "", 1)
+
+	if err := env.guard.Allow("alice", ""); err != nil {
+		t.Fatalf("failures from a lockout period ago still counted: %v", err)
+	}
+}
+
+func TestLoginGuardClearLockout(t *testing.T) {
+	env := newLoginGuardTestEnv()
+	const ip = "203.0.113.50"
+
+	env.fail("alice", ip, 10)
+	env.fail("", ip, 40)
+
+	env.guard.ClearLockout("Alice")
+	if err := env.guard.Allow("alice", ""); err != nil {
+		t.Fatalf("username still locked after ClearLockout: %v", err)
+	}
+	if err := env.guard.Allow("alice", ip); err == nil {
+		t.Fatal("ClearLockout also lifted the IP lockout")
+	}
+
+	env.guard.ClearIP(ip)
+	if err := env.guard.Allow("alice", ip); err != nil {
+		t.Fatalf("still refused after ClearIP: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers account emails. Production deployments can plug in an SMTP or API backed implementation.
+type Mailer interface {
+	Send(mail *Mail) error
+}
+
+// NewMailerFromEnv picks a mailer from MAILER ("log" or "file"); the file mailer writes to MAIL_DIR
+func NewMailerFromEnv() Mailer {
+	switch os.Getenv("MAILER") {
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return NewFileMailer(dir)
+	default:
+		return NewLogMailer()
+	}
+}
+
+type logMailer struct{}
+
+func NewLogMailer() Mailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(mail *Mail) error {
+	log.Printf("Mail to %s: %s\n%s", mail.To, mail.Subject, mail.Body)
+	return nil
+}
+
+type fileMailer struct {
+	dir string
+	seq int
+	mu  sync.Mutex
+}
+
+func NewFileMailer(dir string) Mailer {
+	return &fileMailer{dir: dir}
+}
+
+func (m *fileMailer) Send(mail *Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	m.seq++
+	name := fmt.Sprintf("%d_%03d_%s.eml", time.Now().UnixNano(), m.seq, sanitizeMailName(mail.To))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		mail.To, mail.Subject, time.Now().Format(time.RFC1123Z), mail.Body)
+
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644)
+}
+
+func sanitizeMailName(address string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, address)
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+const (
+	// maxMessageLength is counted in characters of the raw text
+	maxMessageLength = 4000
+	// maxFormatDepth bounds how deeply bold, italic and link text can nest
+	maxFormatDepth = 8
+	codeFence      = "```"
+)
+
+var (
+	ErrContentTooLong   = fmt.Errorf("message content is longer than %d characters", maxMessageLength)
+	ErrMalformedContent = errors.New("malformed message content")
+)
+
+var (
+	codeLanguagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,20}$`)
+	leadingLinkPattern  = regexp.MustCompile(`^https?://[^\s<>"]+`)
+)
+
+// validateMessageContent rejects content that is too long, not valid UTF-8 or contains control characters
+func validateMessageContent(content string) error {
+	if !utf8.ValidString(content) {
+		return fmt.Errorf("%w: content is not valid UTF-8", ErrMalformedContent)
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return ErrContentTooLong
+	}
+	for _, r := range content {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return fmt.Errorf("%w: content contains control characters", ErrMalformedContent)
+		}
+	}
+	return nil
+}
+
+// formatMessage validates the content of text messages and sets ContentHTML from it
+func formatMessage(message *entity.Message) error {
+	message.ContentHTML = ""
+	if err := validateMessageContent(message.Content); err != nil {
+		return err
+	}
+
+	if message.Type != entity.Text && message.Type != entity.Action && message.Type != "" {
+		return nil
+	}
+
+	rendered, err := renderMarkdown(message.Content)
+	if err != nil {
+		return err
+	}
+	message.ContentHTML = rendered
+	return nil
+}
+
+// renderMarkdown turns the supported markdown subset into HTML. Every piece of text is escaped and
+// only the tags produced here can appear in the output:
+//
+//	**bold**, *italic* or _italic_, `code`, ```fenced code blocks```, [text](url), > quotes
+//
+// Links are limited to http, https and mailto; anything else is rendered as plain text.
+func renderMarkdown(content string) (string, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph, quote []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInlineLines(paragraph) + "</p>")
+			paragraph = nil
+		}
+		if len(quote) > 0 {
+			out.WriteString("<blockquote>" + renderInlineLines(quote) + "</blockquote>")
+			quote = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case len(trimmed) > 2*len(codeFence) && strings.HasPrefix(trimmed, codeFence) && strings.HasSuffix(trimmed, codeFence):
+			// ```code``` on a single line
+			flush()
+			code := strings.TrimSuffix(strings.TrimPrefix(trimmed, codeFence), codeFence)
+			out.WriteString("<pre><code>" + html.EscapeString(code) + "</code></pre>")
+
+		case strings.HasPrefix(trimmed, codeFence):
+			flush()
+
+			language := strings.TrimSpace(strings.TrimPrefix(trimmed, codeFence))
+			if language != "" && !codeLanguagePattern.MatchString(language) {
+				return "", fmt.Errorf("%w: invalid code block language", ErrMalformedContent)
+			}
+
+			end := -1
+			for j := i + 1; j < len(lines); j++ {
+				if strings.TrimSpace(lines[j]) == codeFence {
+					end = j
+					break
+				}
+			}
+			if end == -1 {
+				return "", fmt.Errorf("%w: unclosed code block", ErrMalformedContent)
+			}
+
+			out.WriteString("<pre><code")
+			if language != "" {
+				out.WriteString(` class="language-` + html.EscapeString(strings.ToLower(language)) + `"`)
+			}
+			out.WriteString(">" + html.EscapeString(strings.Join(lines[i+1:end], "\n")) + "</code></pre>")
+			i = end
+
+		case strings.HasPrefix(trimmed, ">"):
+			if len(paragraph) > 0 {
+				flush()
+			}
+			text := strings.TrimPrefix(trimmed, ">")
+			quote = append(quote, strings.TrimPrefix(text, " "))
+
+		case trimmed == "":
+			flush()
+
+		default:
+			if len(quote) > 0 {
+				flush()
+			}
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+
+	return out.String(), nil
+}
+
+func renderInlineLines(lines []string) string {
+	rendered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		rendered = append(rendered, renderInline([]rune(line), 0, false))
+	}
+	return strings.Join(rendered, "<br>")
+}
+
+// renderInline formats one line; markers without a matching closing marker are kept as text.
+// Inside link text no further links are created.
+func renderInline(text []rune, depth int, inLink bool) string {
+	var out strings.Builder
+	plain := func(s string) { out.WriteString(html.EscapeString(s)) }
+
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+
+		switch {
+		case r == '\\' && i+1 < len(text) && isMarkdownPunct(text[i+1]):
+			plain(string(text[i+1]))
+			i++
+			continue
+
+		case r == '`':
+			if end := indexRune(text, '`', i+1); end > i+1 {
+				out.WriteString("<code>" + html.EscapeString(string(text[i+1:end])) + "</code>")
+				i = end
+				continue
+			}
+
+		case depth < maxFormatDepth && r == '*' && i+1 < len(text) && text[i+1] == '*':
+			if end := indexDelimiter(text, "**", i+2); end > i+2 {
+				out.WriteString("<strong>" + renderInline(text[i+2:end], depth+1, inLink) + "</strong>")
+				i = end + 1
+				continue
+			}
+
+		case depth < maxFormatDepth && (r == '*' || r == '_') && opensEmphasis(text, i):
+			if end := closeEmphasis(text, r, i+1); end != -1 {
+				out.WriteString("<em>" + renderInline(text[i+1:end], depth+1, inLink) + "</em>")
+				i = end
+				continue
+			}
+
+		case !inLink && depth < maxFormatDepth && r == '[':
+			if label, href, end, ok := parseMarkdownLink(text, i); ok {
+				if safe, ok := safeLinkURL(href); ok {
+					out.WriteString(`<a href="` + html.EscapeString(safe) + `" rel="nofollow noopener noreferrer" target="_blank">` +
+						renderInline(label, depth+1, true) + "</a>")
+				} else {
+					out.WriteString(renderInline(label, depth+1, true))
+				}
+				i = end
+				continue
+			}
+
+		case !inLink && r == 'h' && (i == 0 || !isWordRune(text[i-1])):
+			if link := leadingLinkPattern.FindString(string(text[i:])); link != "" {
+				link = strings.TrimRight(link, ".,;:!?)]}'")
+				out.WriteString(`<a href="` + html.EscapeString(link) + `" rel="nofollow noopener noreferrer" target="_blank">` +
+					html.EscapeString(link) + "</a>")
+				i += utf8.RuneCountInString(link) - 1
+				continue
+			}
+		}
+
+		plain(string(r))
+	}
+
+	return out.String()
+}
+
+// parseMarkdownLink reads [label](url) starting at the opening bracket
+func parseMarkdownLink(text []rune, start int) (label []rune, href string, end int, ok bool) {
+	closeLabel := indexRune(text, ']', start+1)
+	if closeLabel == -1 || closeLabel+1 >= len(text) || text[closeLabel+1] != '(' {
+		return nil, "", 0, false
+	}
+	closeURL := indexRune(text, ')', closeLabel+2)
+	if closeURL == -1 || closeLabel == start+1 {
+		return nil, "", 0, false
+	}
+
+	href = strings.TrimSpace(string(text[closeLabel+2 : closeURL]))
+	if href == "" || strings.ContainsAny(href, " \t") {
+		return nil, "", 0, false
+	}
+	return text[start+1 : closeLabel], href, closeURL, true
+}
+
+func safeLinkURL(href string) (string, bool) {
+	lower := strings.ToLower(href)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:") {
+		return href, true
+	}
+	return "", false
+}
+
+// opensEmphasis reports whether the marker at i can start emphasis: it is followed by text, and an
+// underscore is not inside a word such as snake_case
+func opensEmphasis(text []rune, i int) bool {
+	if i+1 >= len(text) || unicode.IsSpace(text[i+1]) {
+		return false
+	}
+	return text[i] != '_' || i == 0 || !isWordRune(text[i-1])
+}
+
+func closeEmphasis(text []rune, marker rune, from int) int {
+	for j := from + 1; j < len(text); j++ {
+		if text[j] != marker {
+			continue
+		}
+		// Part of a ** pair rather than the end of *italic*
+		if marker == '*' && j+1 < len(text) && text[j+1] == '*' {
+			j++
+			continue
+		}
+		if unicode.IsSpace(text[j-1]) {
+			continue
+		}
+		if marker == '_' && j+1 < len(text) && isWordRune(text[j+1]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func indexDelimiter(text []rune, delimiter string, from int) int {
+	index := strings.Index(string(text[from:]), delimiter)
+	if index == -1 {
+		return -1
+	}
+	return from + utf8.RuneCountInString(string(text[from:])[:index])
+}
+
+func indexRune(text []rune, r rune, from int) int {
+	for j := from; j < len(text); j++ {
+		if text[j] == r {
+			return j
+		}
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isMarkdownPunct(r rune) bool {
+	return strings.ContainsRune("\\`*_[]()>#", r)
+}
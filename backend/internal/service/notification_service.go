@@ -22,6 +22,7 @@ type implNotificationService struct {
 	chatRepo         repository.ChatRepository
 	userRepo         repository.UserRepository
 	roomService      RoomService
+	webhookService   WebhookService
 }
 
 func NewNotificationService(
@@ -30,6 +31,7 @@ func NewNotificationService(
 	chatRepo repository.ChatRepository,
 	userRepo repository.UserRepository,
 	roomService RoomService,
+	webhookService WebhookService,
 ) NotificationService {
 	return &implNotificationService{
 		notificationRepo: notificationRepo,
@@ -37,6 +39,7 @@ func NewNotificationService(
 		chatRepo:         chatRepo,
 		userRepo:         userRepo,
 		roomService:      roomService,
+		webhookService:   webhookService,
 	}
 }
 
@@ -172,6 +175,7 @@ func (s *implNotificationService) AcceptNotification(notificationID, userID int6
 			if err != nil {
 				return err
 			}
+			s.webhookService.Publish(member.ChatID, entity.WebhookMemberJoined, memberEventData(s.userRepo, member))
 		}
 	}
 
@@ -0,0 +1,563 @@
+package service
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	oidcStateTTL        = 10 * time.Minute
+	oidcHTTPTimeout     = 10 * time.Second
+	oidcKeyRefreshDelay = time.Minute // Minimum time between JWKS refetches for unknown key IDs
+	oidcMaxResponseSize = 1 << 20
+)
+
+// OIDCProviderConfig describes one "sign in with" provider
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// OIDCResult is the outcome of a completed provider redirect
+type OIDCResult struct {
+	User      *entity.User
+	Tokens    *entity.TokenPair          // Nil when linking or when a second factor is required
+	Challenge *entity.TwoFactorChallenge // Set when the account has two-factor authentication enabled
+	Linked    bool                       // The provider was linked to the signed-in account
+	Created   bool                       // A new account was created for this identity
+}
+
+// OIDCService implements OpenID Connect login with the authorization code flow and PKCE
+type OIDCService interface {
+	Providers() []string
+	// StartLogin returns the provider URL to send the browser to; a non-zero linkUserID links instead of signing in
+	StartLogin(provider string, linkUserID int64) (string, error)
+	CompleteLogin(provider, code, state string, client ClientInfo) (*OIDCResult, error)
+	GetIdentities(userID int64) ([]*entity.Identity, error)
+	UnlinkIdentity(userID int64, identityID string) error
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	config        OIDCProviderConfig
+	discovery     *oidcDiscovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+	mu            sync.Mutex
+}
+
+type oidcClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type implOIDCService struct {
+	identityRepo repository.IdentityRepository
+	userRepo     repository.UserRepository
+	authService  AuthService
+	providers    map[string]*oidcProvider
+	httpClient   *http.Client
+}
+
+func NewOIDCService(
+	identityRepo repository.IdentityRepository,
+	userRepo repository.UserRepository,
+	authService AuthService,
+) OIDCService {
+	providers := make(map[string]*oidcProvider)
+	for _, config := range loadOIDCProviders() {
+		providers[config.Name] = &oidcProvider{config: config}
+	}
+
+	return &implOIDCService{
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		authService:  authService,
+		providers:    providers,
+		httpClient:   &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS (comma separated names) and OIDC_<NAME>_* settings
+func loadOIDCProviders() []OIDCProviderConfig {
+	var configs []OIDCProviderConfig
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = os.Getenv("FRONTEND_URL") + "/auth/callback/" + name
+		}
+
+		if config.Issuer == "" || config.ClientID == "" {
+			log.Printf("Warning: OIDC provider %q needs %sISSUER and %sCLIENT_ID, skipping", name, prefix, prefix)
+			continue
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs
+}
+
+func (s *implOIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *implOIDCService) StartLogin(provider string, linkUserID int64) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", errors.New("unknown login provider")
+	}
+
+	discovery, err := s.discover(p)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.identityRepo.CreateLoginState(&entity.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Provider:     provider,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (s *implOIDCService) CompleteLogin(provider, code, state string, client ClientInfo) (*OIDCResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, errors.New("unknown login provider")
+	}
+
+	loginState, err := s.identityRepo.ConsumeLoginState(hashToken(state))
+	if err != nil || loginState.Provider != provider || time.Now().After(loginState.ExpiresAt) {
+		return nil, errors.New("login request expired, please try again")
+	}
+
+	idToken, err := s.exchangeCode(p, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.verifyIDToken(p, idToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("Rejected ID token from %s: %v", provider, err)
+		return nil, errors.New("could not verify the identity provider response")
+	}
+
+	result, err := s.resolveUser(provider, claims, loginState.LinkUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Linked {
+		return result, nil
+	}
+
+	result.Tokens, result.Challenge, err = s.authService.CreateSessionForUser(result.User, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// resolveUser finds the account for the identity, linking or creating one as needed
+func (s *implOIDCService) resolveUser(provider string, claims *oidcClaims, linkUserID int64) (*OIDCResult, error) {
+	if identity, err := s.identityRepo.GetIdentity(provider, claims.Subject); err == nil {
+		if linkUserID != 0 && identity.UserID != linkUserID {
+			return nil, errors.New("this account is already linked to another user")
+		}
+
+		user, err := s.userRepo.GetUserByNumericID(identity.UserID)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+
+		return &OIDCResult{User: user, Linked: linkUserID != 0}, nil
+	}
+
+	// A signed-in user explicitly linking this provider
+	if linkUserID != 0 {
+		user, err := s.userRepo.GetUserByNumericID(linkUserID)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+		if user.IsGuest {
+			return nil, errors.New("guest accounts cannot link a login provider, register first")
+		}
+
+		if err := s.linkIdentity(user, provider, claims); err != nil {
+			return nil, err
+		}
+
+		return &OIDCResult{User: user, Linked: true}, nil
+	}
+
+	// Link to an existing account only when both sides have proven the address; otherwise an
+	// attacker could register the victim's email at a lax provider and take the account over
+	if claims.Email != "" {
+		if existing, err := s.userRepo.GetUserByEmail(claims.Email); err == nil {
+			if !claims.EmailVerified || !existing.EmailVerified || existing.IsGuest {
+				return nil, fmt.Errorf("an account with this email already exists, sign in with your password and link %s from your settings", provider)
+			}
+
+			if err := s.linkIdentity(existing, provider, claims); err != nil {
+				return nil, err
+			}
+
+			return &OIDCResult{User: existing}, nil
+		}
+	}
+
+	user, err := s.createUser(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.linkIdentity(user, provider, claims); err != nil {
+		return nil, err
+	}
+
+	return &OIDCResult{User: user, Created: true}, nil
+}
+
+func (s *implOIDCService) linkIdentity(user *entity.User, provider string, claims *oidcClaims) error {
+	return s.identityRepo.CreateIdentity(&entity.Identity{
+		UserID:   user.NumericID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// createUser makes a password-less account; the user can set a password later through password reset
+func (s *implOIDCService) createUser(claims *oidcClaims) (*entity.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameDisallowed.ReplaceAllString(strings.ToLower(base), "_")
+	if len(base) < 3 {
+		base = "user_" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	username := base
+	for i := 0; ; i++ {
+		if _, err := s.userRepo.GetUserByUsername(username); err != nil {
+			break
+		}
+		if i == 10 {
+			return nil, errors.New("could not pick a username")
+		}
+		username = fmt.Sprintf("%s_%s", base, primitive.NewObjectID().Hex()[18:])
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+
+	user := &entity.User{
+		Username:      username,
+		Name:          name,
+		Email:         claims.Email,
+		EmailVerified: claims.Email != "" && claims.EmailVerified,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	if err := s.userRepo.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *implOIDCService) GetIdentities(userID int64) ([]*entity.Identity, error) {
+	return s.identityRepo.GetIdentitiesByUser(userID)
+}
+
+// UnlinkIdentity refuses to remove the last way of signing in
+func (s *implOIDCService) UnlinkIdentity(userID int64, identityID string) error {
+	id, err := primitive.ObjectIDFromHex(identityID)
+	if err != nil {
+		return errors.New("identity not found")
+	}
+
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.Password == "" {
+		identities, err := s.identityRepo.GetIdentitiesByUser(userID)
+		if err != nil {
+			return err
+		}
+		if len(identities) <= 1 {
+			return errors.New("set a password before unlinking your only login provider")
+		}
+	}
+
+	return s.identityRepo.DeleteIdentity(id, userID)
+}
+
+func (s *implOIDCService) discover(p *oidcProvider) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := s.getJSON(p.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		log.Printf("OIDC discovery for %s failed: %v", p.config.Name, err)
+		return nil, errors.New("login provider is unavailable")
+	}
+
+	if discovery.Issuer != p.config.Issuer {
+		log.Printf("OIDC discovery for %s returned issuer %q, expected %q", p.config.Name, discovery.Issuer, p.config.Issuer)
+		return nil, errors.New("login provider is misconfigured")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (s *implOIDCService) exchangeCode(p *oidcProvider, code, verifier string) (string, error) {
+	discovery, err := s.discover(p)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	resp, err := s.httpClient.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		log.Printf("OIDC token request to %s failed: %v", p.config.Name, err)
+		return "", errors.New("login provider is unavailable")
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(&tokenResponse); err != nil {
+		return "", errors.New("invalid response from login provider")
+	}
+
+	if resp.StatusCode != http.StatusOK || tokenResponse.IDToken == "" {
+		log.Printf("OIDC token request to %s rejected: %s %s", p.config.Name, tokenResponse.Error, tokenResponse.ErrorDescription)
+		return "", errors.New("login was rejected by the provider")
+	}
+
+	return tokenResponse.IDToken, nil
+}
+
+func (s *implOIDCService) verifyIDToken(p *oidcProvider, idToken, nonce string) (*oidcClaims, error) {
+	discovery, err := s.discover(p)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.providerKey(p, discovery.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	result := &oidcClaims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	if result.Subject == "" {
+		return nil, errors.New("missing subject")
+	}
+
+	return result, nil
+}
+
+// providerKey returns the signing key for kid, refetching the JWKS when the provider has rotated keys
+func (s *implOIDCService) providerKey(p *oidcProvider, jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < oidcKeyRefreshDelay && p.keys != nil {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	var set entity.JWKSet
+	if err := s.getJSON(jwksURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := ParseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (s *implOIDCService) getJSON(url string, v interface{}) error {
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(v)
+}
+
+// pkceChallenge derives the S256 code challenge (RFC 7636) from the verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/fakeidp"
+)
+
+const oidcTestRedirectURL = "http://app.test/auth/callback/fake"
+
+type oidcTestEnv struct {
+	service    OIDCService
+	identities *fakeIdentityRepository
+	users      *fakeUserRepository
+	idp        *fakeidp.Provider
+}
+
+// newOIDCTestEnv runs fakeidp over httptest and configures it as the provider named "fake"
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+
+	var idp *fakeidp.Provider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	idp, err := fakeidp.New(server.URL, "chat-test", "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OIDC_PROVIDERS", "fake")
+	t.Setenv("OIDC_FAKE_ISSUER", server.URL)
+	t.Setenv("OIDC_FAKE_CLIENT_ID", "chat-test")
+	t.Setenv("OIDC_FAKE_CLIENT_SECRET", "test-secret")
+	t.Setenv("OIDC_FAKE_REDIRECT_URL", oidcTestRedirectURL)
+
+	env := &oidcTestEnv{
+		identities: newFakeIdentityRepository(),
+		users:      &fakeUserRepository{},
+		idp:        idp,
+	}
+	env.service = NewOIDCService(env.identities, env.users, &fakeSessionAuthService{})
+	return env
+}
+
+// authorize follows StartLogin's URL as the browser would, signing in as email at the provider,
+// and returns the code and state the provider redirects back with
+func (env *oidcTestEnv) authorize(t *testing.T, linkUserID int64, email string) (string, string) {
+	t.Helper()
+
+	authURL, err := env.service.StartLogin("fake", linkUserID)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("redirect_uri") != oidcTestRedirectURL || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	query.Set("login_hint", email)
+	parsed.RawQuery = query.Encode()
+
+	browser := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := browser.Get(parsed.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize answered %d", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(callback.String(), oidcTestRedirectURL+"?") {
+		t.Fatalf("redirected to %s", callback)
+	}
+	if callback.Query().Get("state") != query.Get("state") {
+		t.Fatal("state did not round-trip")
+	}
+
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestOIDCLoginCreatesAccount(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	env.idp.AddUser(fakeidp.User{
+		Subject:           "fake-alice",
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		Name:              "Alice Example",
+		PreferredUsername: "alice",
+	})
+
+	code, state := env.authorize(t, 0, "alice@example.com")
+	result, err := env.service.CompleteLogin("fake", code, state, ClientInfo{})
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	if !result.Created || result.Linked || result.Tokens == nil {
+		t.Fatalf("unexpected result: created=%v linked=%v tokens=%v", result.Created, result.Linked, result.Tokens)
+	}
+	if result.User.Username != "alice" || result.User.Name != "Alice Example" || !result.User.EmailVerified {
+		t.Fatalf("unexpected user: %+v", result.User)
+	}
+
+	identity, err := env.identities.GetIdentity("fake", "fake-alice")
+	if err != nil || identity.UserID != result.User.NumericID {
+		t.Fatalf("identity was not linked to the new account: %v", err)
+	}
+
+	// The callback cannot be replayed
+	if _, err := env.service.CompleteLogin("fake", code, state, ClientInfo{}); err == nil {
+		t.Fatal("a used state was accepted again")
+	}
+
+	// Signing in again finds the same account
+	code, state = env.authorize(t, 0, "alice@example.com")
+	again, err := env.service.CompleteLogin("fake", code, state, ClientInfo{})
+	if err != nil {
+		t.Fatalf("second CompleteLogin: %v", err)
+	}
+	if again.Created || again.User.NumericID != result.User.NumericID {
+		t.Fatalf("second login created=%v user=%d, want the existing user %d", again.Created, again.User.NumericID, result.User.NumericID)
+	}
+}
+
+func TestOIDCLinkToSignedInUser(t *testing.T) {
+	env := newOIDCTestEnv(t)
+
+	existing := &entity.User{Username: "bob", Name: "Bob", Email: "bob@example.com", Password: "hash"}
+	if err := env.users.CreateUser(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob links an account whose email differs from his own
+	code, state := env.authorize(t, existing.NumericID, "bob.work@example.org")
+	result, err := env.service.CompleteLogin("fake", code, state, ClientInfo{})
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	if !result.Linked || result.Created || result.Tokens != nil || result.User.NumericID != existing.NumericID {
+		t.Fatalf("unexpected result: linked=%v created=%v tokens=%v user=%d", result.Linked, result.Created, result.Tokens, result.User.NumericID)
+	}
+
+	identities, _ := env.service.GetIdentities(existing.NumericID)
+	if len(identities) != 1 || identities[0].Provider != "fake" || identities[0].Email != "bob.work@example.org" {
+		t.Fatalf("unexpected identities: %+v", identities)
+	}
+
+	// Signing in with the linked account now reaches Bob
+	code, state = env.authorize(t, 0, "bob.work@example.org")
+	login, err := env.service.CompleteLogin("fake", code, state, ClientInfo{})
+	if err != nil {
+		t.Fatalf("login with the linked identity: %v", err)
+	}
+	if login.User.NumericID != existing.NumericID || login.Tokens == nil {
+		t.Fatalf("linked identity signed in as %d, want %d", login.User.NumericID, existing.NumericID)
+	}
+
+	// Another user cannot take over the identity
+	other := &entity.User{Username: "carol", Name: "Carol", Email: "carol@example.com", Password: "hash"}
+	env.users.CreateUser(other)
+	code, state = env.authorize(t, other.NumericID, "bob.work@example.org")
+	if _, err := env.service.CompleteLogin("fake", code, state, ClientInfo{}); err == nil {
+		t.Fatal("an identity linked to Bob was linked to Carol")
+	}
+}
+
+func TestOIDCRefusesUnverifiedEmailTakeover(t *testing.T) {
+	env := newOIDCTestEnv(t)
+
+	victim := &entity.User{Username: "dave", Name: "Dave", Email: "dave@example.com", EmailVerified: true, Password: "hash"}
+	env.users.CreateUser(victim)
+	env.idp.AddUser(fakeidp.User{Subject: "attacker", Email: "dave@example.com", EmailVerified: false})
+
+	code, state := env.authorize(t, 0, "dave@example.com")
+	if _, err := env.service.CompleteLogin("fake", code, state, ClientInfo{}); err == nil {
+		t.Fatal("an unverified provider email signed into an existing account")
+	}
+	if identities, _ := env.service.GetIdentities(victim.NumericID); len(identities) != 0 {
+		t.Fatal("the identity was linked to the existing account")
+	}
+}
+
+func TestOIDCRejectsForgedCallback(t *testing.T) {
+	env := newOIDCTestEnv(t)
+
+	_, state := env.authorize(t, 0, "erin@example.com")
+	if _, err := env.service.CompleteLogin("fake", "made-up-code", state, ClientInfo{}); err == nil {
+		t.Fatal("a code the provider never issued was accepted")
+	}
+
+	code, _ := env.authorize(t, 0, "erin@example.com")
+	if _, err := env.service.CompleteLogin("fake", code, "made-up-state", ClientInfo{}); err == nil {
+		t.Fatal("a state the server never issued was accepted")
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Ranges that are not reachable on the public internet or that tunnel to addresses which may not be;
+// the standard library checks cover loopback, RFC 1918, ULA and link-local
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// addressPolicy decides whether the server may open a connection to addr on a user's behalf
+type addressPolicy func(addr netip.Addr) bool
+
+// newOutboundTransport is the transport for requests to URLs users gave us. The address of every
+// connection, redirects included, is checked after DNS resolution so a hostname cannot be pointed
+// at an internal service.
+func newOutboundTransport(timeout time.Duration, allow addressPolicy) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !allow(addr) {
+				return fmt.Errorf("refusing to connect to non-public address %s", addr)
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Transport{
+		// A proxy would make the dialer check the proxy's address instead of the target's
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNonPublicHost catches URLs that name an internal host outright, so they can be refused up front;
+// hostnames that resolve to one are refused when connecting
+func isNonPublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(host)
+	return err == nil && !isPublicAddr(addr)
+}
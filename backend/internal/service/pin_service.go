@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+var (
+	ErrPinNotAllowed   = errors.New("only chat admins can pin messages in this chat")
+	ErrPinLimitReached = errors.New("this chat has reached its pinned message limit")
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// PinService keeps important messages visible at the top of a chat
+type PinService interface {
+	PinMessage(userID, messageID int64) (*entity.Message, error)
+	UnpinMessage(userID, messageID int64) (*entity.Message, error)
+	// GetPins lists a chat's pinned messages for userID, who must be a member unless the chat is public
+	GetPins(userID, chatID int64) ([]*entity.Message, error)
+}
+
+type implPinService struct {
+	chatRepo    repository.ChatRepository
+	chatService ChatService
+	roomService RoomService
+	limit       int
+	adminOnly   bool
+}
+
+func NewPinService(chatRepo repository.ChatRepository, chatService ChatService, roomService RoomService) PinService {
+	return &implPinService{
+		chatRepo:    chatRepo,
+		chatService: chatService,
+		roomService: roomService,
+		limit:       envInt("PIN_LIMIT", 50),
+		adminOnly:   os.Getenv("PIN_ADMIN_ONLY") != "false",
+	}
+}
+
+func (s *implPinService) PinMessage(userID, messageID int64) (*entity.Message, error) {
+	message, err := s.pinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.PinnedAt != nil {
+		return message, nil
+	}
+
+	// The repository checks the limit and pins in one conditional update, so concurrent pins cannot overshoot
+	now := time.Now()
+	pinned, err := s.chatRepo.PinMessage(message.ChatID, message.ID, userID, now, s.limit)
+	if errors.Is(err, repository.ErrPinLimit) {
+		return nil, ErrPinLimitReached
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Someone else pinned it in the meantime and announced it
+	if !pinned {
+		return s.chatRepo.GetMessageByID(message.ID)
+	}
+	message.PinnedAt = &now
+	message.PinnedBy = userID
+
+	s.announce(message, userID, "pinned a message", entity.MESSAGE_PINNED)
+	return message, nil
+}
+
+func (s *implPinService) UnpinMessage(userID, messageID int64) (*entity.Message, error) {
+	message, err := s.pinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.PinnedAt == nil {
+		return message, nil
+	}
+
+	unpinned, err := s.chatRepo.UnpinMessage(message.ChatID, message.ID)
+	if err != nil {
+		return nil, err
+	}
+	message.PinnedAt = nil
+	message.PinnedBy = 0
+	if !unpinned {
+		return message, nil
+	}
+
+	s.announce(message, userID, "unpinned a message", entity.MESSAGE_UNPINNED)
+	return message, nil
+}
+
+func (s *implPinService) GetPins(userID, chatID int64) ([]*entity.Message, error) {
+	chat, err := s.chatRepo.GetChatByID(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.IsPublic {
+		if isMember, err := s.chatRepo.IsChatMember(chatID, userID); err != nil || !isMember {
+			return nil, ErrNotChatMember
+		}
+	}
+
+	return s.chatRepo.GetPinnedMessages(chatID)
+}
+
+// pinnableMessage loads a message the user may pin or unpin. Group chats require an admin
+// unless PIN_ADMIN_ONLY is "false"; both people in a one-to-one chat can always pin.
+func (s *implPinService) pinnableMessage(userID, messageID int64) (*entity.Message, error) {
+	message, err := s.chatRepo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	chat, err := s.chatRepo.GetChatByID(message.ChatID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	member, err := s.chatRepo.GetChatMember(chat.ID, userID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if s.adminOnly && chat.Type != entity.Individual && member.Role != "admin" {
+		return nil, ErrPinNotAllowed
+	}
+
+	if message.Type == entity.System || message.ThreadID != nil {
+		return nil, fmt.Errorf("system messages and thread replies cannot be pinned")
+	}
+
+	return message, nil
+}
+
+// announce posts a system message about the pin change and broadcasts the pin event
+func (s *implPinService) announce(message *entity.Message, userID int64, text string, eventType entity.EventType) {
+	systemMessage := &entity.Message{
+		ChatID:    message.ChatID,
+		Content:   text,
+		Type:      entity.System,
+		ReplyToID: &message.ID,
+		CreatedBy: userID,
+	}
+	if err := s.chatService.SendMessage(systemMessage); err != nil {
+		log.Printf("Error creating pin system message: %v", err)
+	} else {
+		broadcastMessage(s.roomService, systemMessage)
+	}
+
+	broadcastEvent(s.roomService, message.ChatID, entity.Event{
+		Type: eventType,
+		Data: map[string]interface{}{
+			"chat_id":    message.ChatID,
+			"message_id": message.ID,
+			"message":    message,
+		},
+		CreatedBy: userID,
+	})
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func newPinTestService(env *chatTestEnv) PinService {
+	return NewPinService(env.chatRepo, env.service, NewRoomService())
+}
+
+func TestGetPinsRequiresMembership(t *testing.T) {
+	env := newChatTestEnv(t)
+	pins := newPinTestService(env)
+	message := env.send(t, chatTestMemberID, "read the rules")
+
+	if _, err := pins.PinMessage(chatTestAdminID, message.ID); err != nil {
+		t.Fatalf("PinMessage: %v", err)
+	}
+
+	pinned, err := pins.GetPins(chatTestMemberID, env.chatID)
+	if err != nil {
+		t.Fatalf("GetPins: %v", err)
+	}
+	if len(pinned) != 1 || pinned[0].ID != message.ID {
+		t.Fatalf("got %d pins, want the pinned message", len(pinned))
+	}
+
+	if _, err := pins.GetPins(chatTestOutsiderID, env.chatID); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("outsider listed the pins of a private chat: %v", err)
+	}
+}
+
+func TestPinMessagePermissions(t *testing.T) {
+	env := newChatTestEnv(t)
+	pins := newPinTestService(env)
+	message := env.send(t, chatTestMemberID, "pin me")
+
+	if _, err := pins.PinMessage(chatTestMemberID, message.ID); !errors.Is(err, ErrPinNotAllowed) {
+		t.Fatalf("a member pinned in a group chat: %v", err)
+	}
+	if _, err := pins.PinMessage(chatTestOutsiderID, message.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("an outsider pinned a message: %v", err)
+	}
+}
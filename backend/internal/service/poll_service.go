@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const (
+	maxPollOptions        = 10
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+	maxPollDuration       = 365 * 24 * time.Hour
+	pollCloseBatch        = 100
+)
+
+var (
+	ErrPollNotFound   = errors.New("poll not found")
+	ErrPollClosed     = errors.New("this poll is closed")
+	ErrPollNotAllowed = errors.New("only the poll's author and chat admins can close it")
+)
+
+// PollInput describes a poll to create
+type PollInput struct {
+	Question       string
+	Options        []string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       *time.Time
+}
+
+// PollService creates poll messages and records votes on them
+type PollService interface {
+	// CreatePoll saves the poll message; the caller broadcasts it like any other new message
+	CreatePoll(userID, chatID int64, input *PollInput) (*entity.Message, error)
+	GetPoll(userID, messageID int64) (*entity.Message, error)
+	// Vote picks an option; in single choice polls it replaces the user's previous choice
+	Vote(userID, messageID int64, optionID int) (*entity.Message, error)
+	Unvote(userID, messageID int64, optionID int) (*entity.Message, error)
+	// ClosePoll ends voting early, allowed for the poll's author and chat admins
+	ClosePoll(userID, messageID int64) (*entity.Message, error)
+	// StartCloser closes polls at their close time in the background until ctx is cancelled
+	StartCloser(ctx context.Context)
+	CloseDuePolls() (int, error)
+}
+
+type implPollService struct {
+	chatRepo    repository.ChatRepository
+	chatService ChatService
+	roomService RoomService
+	interval    time.Duration
+	now         func() time.Time
+}
+
+func NewPollService(chatRepo repository.ChatRepository, chatService ChatService, roomService RoomService) PollService {
+	return &implPollService{
+		chatRepo:    chatRepo,
+		chatService: chatService,
+		roomService: roomService,
+		interval:    envDuration("POLL_CLOSE_INTERVAL", 30*time.Second),
+		now:         time.Now,
+	}
+}
+
+func (s *implPollService) CreatePoll(userID, chatID int64, input *PollInput) (*entity.Message, error) {
+	question := strings.TrimSpace(input.Question)
+	if question == "" || len([]rune(question)) > maxPollQuestionLength {
+		return nil, fmt.Errorf("the question must be between 1 and %d characters", maxPollQuestionLength)
+	}
+	if len(input.Options) < 2 || len(input.Options) > maxPollOptions {
+		return nil, fmt.Errorf("a poll needs between 2 and %d options", maxPollOptions)
+	}
+	if input.ClosesAt != nil && (!input.ClosesAt.After(s.now()) || input.ClosesAt.After(s.now().Add(maxPollDuration))) {
+		return nil, errors.New("closes_at must be in the future and at most one year ahead")
+	}
+
+	if isMember, err := s.chatRepo.IsChatMember(chatID, userID); err != nil || !isMember {
+		return nil, errors.New("you are not a member of this chat")
+	}
+
+	// Option IDs are their positions in the options list
+	options := make([]*entity.PollOption, 0, len(input.Options))
+	for i, text := range input.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || len([]rune(text)) > maxPollOptionLength {
+			return nil, fmt.Errorf("options must be between 1 and %d characters", maxPollOptionLength)
+		}
+		options = append(options, &entity.PollOption{ID: i, Text: text})
+	}
+
+	message := &entity.Message{
+		ChatID:  chatID,
+		Content: question,
+		Type:    entity.Poll,
+		Poll: &entity.MessagePoll{
+			Question:       question,
+			Options:        options,
+			MultipleChoice: input.MultipleChoice,
+			Anonymous:      input.Anonymous,
+			ClosesAt:       input.ClosesAt,
+		},
+		CreatedBy: userID,
+	}
+	if err := s.chatService.SendMessage(message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (s *implPollService) GetPoll(userID, messageID int64) (*entity.Message, error) {
+	message, err := s.pollMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withResults(message, userID)
+}
+
+func (s *implPollService) Vote(userID, messageID int64, optionID int) (*entity.Message, error) {
+	message, err := s.votablePoll(userID, messageID, optionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []int
+	if message.Poll.MultipleChoice {
+		previous, err = s.chatRepo.AddPollVoteOption(messageID, userID, optionID)
+	} else {
+		previous, err = s.chatRepo.ReplacePollVote(messageID, userID, []int{optionID})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changed := !containsOption(previous, optionID) || (!message.Poll.MultipleChoice && len(previous) > 1)
+	return s.applyVote(message, userID, changed)
+}
+
+func (s *implPollService) Unvote(userID, messageID int64, optionID int) (*entity.Message, error) {
+	message, err := s.votablePoll(userID, messageID, optionID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := s.chatRepo.RemovePollVoteOption(messageID, userID, optionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.applyVote(message, userID, containsOption(previous, optionID))
+}
+
+// applyVote broadcasts the new results when the vote changed anything. Counts are derived from
+// the vote documents, so the single write per vote is the only state to keep consistent
+func (s *implPollService) applyVote(message *entity.Message, userID int64, changed bool) (*entity.Message, error) {
+	if changed {
+		s.broadcastResults(message, entity.POLL_UPDATED)
+	}
+
+	return s.withResults(message, userID)
+}
+
+func (s *implPollService) ClosePoll(userID, messageID int64) (*entity.Message, error) {
+	message, err := s.pollMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.CreatedBy != userID {
+		if err := ensureChatAdmin(s.chatRepo, message.ChatID, userID); err != nil {
+			return nil, ErrPollNotAllowed
+		}
+	}
+
+	closed, err := s.chatRepo.ClosePoll(messageID, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if closed == nil {
+		return nil, ErrPollClosed
+	}
+
+	s.broadcastResults(closed, entity.POLL_CLOSED)
+	return s.withResults(closed, userID)
+}
+
+func (s *implPollService) StartCloser(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.CloseDuePolls(); err != nil {
+				log.Printf("Error closing due polls: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CloseDuePolls marks polls past their close time as closed and broadcasts their final results
+func (s *implPollService) CloseDuePolls() (int, error) {
+	closedCount := 0
+	for {
+		due, err := s.chatRepo.GetDuePolls(s.now(), pollCloseBatch)
+		if err != nil {
+			return closedCount, err
+		}
+
+		for _, message := range due {
+			closed, err := s.chatRepo.ClosePoll(message.ID, *message.Poll.ClosesAt)
+			if err != nil {
+				return closedCount, err
+			}
+			// Another server closed it first
+			if closed == nil {
+				continue
+			}
+
+			s.broadcastResults(closed, entity.POLL_CLOSED)
+			closedCount++
+		}
+
+		if len(due) < pollCloseBatch {
+			return closedCount, nil
+		}
+	}
+}
+
+// pollMessage loads a poll the user can see as a member of its chat
+func (s *implPollService) pollMessage(userID, messageID int64) (*entity.Message, error) {
+	message, err := s.chatRepo.GetMessageByID(messageID)
+	if err != nil || message.Type != entity.Poll || message.Poll == nil {
+		return nil, ErrPollNotFound
+	}
+
+	if isMember, err := s.chatRepo.IsChatMember(message.ChatID, userID); err != nil || !isMember {
+		return nil, ErrPollNotFound
+	}
+
+	return message, nil
+}
+
+func (s *implPollService) votablePoll(userID, messageID int64, optionID int) (*entity.Message, error) {
+	message, err := s.pollMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Poll.IsClosed(s.now()) {
+		return nil, ErrPollClosed
+	}
+	if optionID < 0 || optionID >= len(message.Poll.Options) {
+		return nil, errors.New("unknown poll option")
+	}
+
+	return message, nil
+}
+
+// withResults returns a copy of the poll message with vote counts, voter totals, per-option voters unless
+// the poll is anonymous, and the viewer's own votes; viewerID 0 leaves out personal votes
+func (s *implPollService) withResults(message *entity.Message, viewerID int64) (*entity.Message, error) {
+	votes, err := s.chatRepo.GetPollVotes(message.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	poll := *message.Poll
+	poll.Options = make([]*entity.PollOption, 0, len(message.Poll.Options))
+	voters := make(map[int][]int64)
+	poll.TotalVoters = len(votes)
+	poll.MyVotes = nil
+
+	for _, vote := range votes {
+		for _, optionID := range vote.OptionIDs {
+			voters[optionID] = append(voters[optionID], vote.UserID)
+		}
+		if viewerID != 0 && vote.UserID == viewerID {
+			poll.MyVotes = vote.OptionIDs
+		}
+	}
+
+	for _, option := range message.Poll.Options {
+		result := *option
+		result.VoteCount = len(voters[option.ID])
+		result.Voters = nil
+		if !poll.Anonymous {
+			result.Voters = voters[option.ID]
+		}
+		poll.Options = append(poll.Options, &result)
+	}
+
+	result := *message
+	result.Poll = &poll
+	return &result, nil
+}
+
+func (s *implPollService) broadcastResults(message *entity.Message, eventType entity.EventType) {
+	results, err := s.withResults(message, 0)
+	if err != nil {
+		log.Printf("Error loading results of poll %d: %v", message.ID, err)
+		return
+	}
+
+	broadcastEvent(s.roomService, message.ChatID, entity.Event{
+		Type: eventType,
+		Data: map[string]interface{}{
+			"chat_id":    message.ChatID,
+			"message_id": message.ID,
+			"poll":       results.Poll,
+		},
+	})
+}
+
+func containsOption(optionIDs []int, optionID int) bool {
+	for _, id := range optionIDs {
+		if id == optionID {
+			return true
+		}
+	}
+	return false
+}
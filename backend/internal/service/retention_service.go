@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+// retentionSweepBatch bounds how many expired messages one sweep pass loads
+const retentionSweepBatch = 500
+
+var ErrRetentionNotAllowed = errors.New("only chat admins can change disappearing messages in this chat")
+
+// MessageTimers are the disappearing message timers a chat can choose from
+var MessageTimers = map[string]time.Duration{
+	"off": 0,
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// RetentionService manages per-chat disappearing message timers and removes messages once they expire
+type RetentionService interface {
+	SetMessageTimer(userID, chatID int64, timer string) (*entity.Chat, error)
+	// StartSweeper removes expired messages in the background until ctx is cancelled
+	StartSweeper(ctx context.Context)
+	// SweepExpired removes every message that has expired by now and returns how many were removed
+	SweepExpired() (int, error)
+}
+
+type implRetentionService struct {
+	chatRepo    repository.ChatRepository
+	threadRepo  repository.ThreadRepository
+	uploadRepo  repository.UploadRepository
+	chatService ChatService
+	roomService RoomService
+	uploadDir   string
+	interval    time.Duration
+	now         func() time.Time
+}
+
+func NewRetentionService(
+	chatRepo repository.ChatRepository,
+	threadRepo repository.ThreadRepository,
+	uploadRepo repository.UploadRepository,
+	chatService ChatService,
+	roomService RoomService,
+) RetentionService {
+	return &implRetentionService{
+		chatRepo:    chatRepo,
+		threadRepo:  threadRepo,
+		uploadRepo:  uploadRepo,
+		chatService: chatService,
+		roomService: roomService,
+		uploadDir:   "./uploads",
+		interval:    envDuration("RETENTION_SWEEP_INTERVAL", time.Minute),
+		now:         time.Now,
+	}
+}
+
+// SetMessageTimer changes how long new messages in the chat live. Group chats require an admin,
+// either person in a one-to-one chat may change it. Messages already sent keep their expiry.
+func (s *implRetentionService) SetMessageTimer(userID, chatID int64, timer string) (*entity.Chat, error) {
+	ttl, ok := MessageTimers[timer]
+	if !ok {
+		return nil, fmt.Errorf("timer must be one of off, 1h, 24h or 7d")
+	}
+
+	chat, err := s.chatRepo.GetChatByID(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.chatRepo.GetChatMember(chatID, userID)
+	if err != nil {
+		return nil, errors.New("you are not a member of this chat")
+	}
+	if chat.Type != entity.Individual && member.Role != "admin" {
+		return nil, ErrRetentionNotAllowed
+	}
+
+	seconds := int64(ttl / time.Second)
+	if chat.MessageTTL == seconds {
+		return chat, nil
+	}
+
+	if err := s.chatRepo.SetChatMessageTTL(chatID, seconds); err != nil {
+		return nil, err
+	}
+	chat.MessageTTL = seconds
+
+	content := "turned off disappearing messages"
+	if seconds > 0 {
+		content = "set messages to disappear after " + timer
+	}
+	systemMessage := &entity.Message{
+		ChatID:    chatID,
+		Content:   content,
+		Type:      entity.System,
+		CreatedBy: userID,
+	}
+	if err := s.chatService.SendMessage(systemMessage); err != nil {
+		log.Printf("Error creating message timer system message: %v", err)
+	} else {
+		broadcastMessage(s.roomService, systemMessage)
+	}
+
+	return chat, nil
+}
+
+func (s *implRetentionService) StartSweeper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.SweepExpired(); err != nil {
+				log.Printf("Error removing expired messages: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *implRetentionService) SweepExpired() (int, error) {
+	removed := 0
+	for {
+		messages, err := s.chatRepo.GetExpiredMessages(s.now(), retentionSweepBatch)
+		if err != nil {
+			return removed, err
+		}
+		if len(messages) == 0 {
+			return removed, nil
+		}
+
+		if err := s.remove(messages); err != nil {
+			return removed, err
+		}
+		removed += len(messages)
+
+		if len(messages) < retentionSweepBatch {
+			return removed, nil
+		}
+	}
+}
+
+// remove deletes a batch of expired messages with their reactions, uploaded media and thread state,
+// then tells each chat which messages are gone
+func (s *implRetentionService) remove(messages []*entity.Message) error {
+	ids := make([]int64, 0, len(messages))
+	expired := make(map[int64]bool, len(messages))
+	byChat := make(map[int64][]int64)
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+		expired[message.ID] = true
+		byChat[message.ChatID] = append(byChat[message.ChatID], message.ID)
+	}
+
+	if err := s.chatRepo.DeleteReactionsByMessages(ids); err != nil {
+		return err
+	}
+	if err := s.chatRepo.DeletePollVotesByMessages(ids); err != nil {
+		return err
+	}
+	if err := s.chatRepo.DeleteMessagesByIDs(ids); err != nil {
+		return err
+	}
+
+	recount := make(map[int64]bool)
+	for _, message := range messages {
+		s.removeUploads(message)
+
+		if message.ThreadID != nil && !expired[*message.ThreadID] {
+			recount[*message.ThreadID] = true
+		}
+		if message.ThreadReplyCount > 0 {
+			if err := s.threadRepo.DeleteThreadFollows(message.ID); err != nil {
+				log.Printf("Error deleting follows of expired thread %d: %v", message.ID, err)
+			}
+		}
+	}
+
+	for rootID := range recount {
+		if _, err := s.chatRepo.RecountThread(rootID); err != nil {
+			log.Printf("Error recounting thread %d: %v", rootID, err)
+		}
+	}
+
+	for chatID, messageIDs := range byChat {
+		broadcastEvent(s.roomService, chatID, entity.Event{
+			Type: entity.MESSAGES_EXPIRED,
+			Data: map[string]interface{}{
+				"chat_id":     chatID,
+				"message_ids": messageIDs,
+			},
+		})
+	}
+
+	return nil
+}
+
+// removeUploads deletes the files the message held that nothing else uses any more. Which files
+// those are comes from the upload records, never from the URLs on the message
+func (s *implRetentionService) removeUploads(message *entity.Message) {
+	names, err := s.uploadRepo.RemoveUploadReferences(messageUploadRef(message.ID))
+	if err != nil {
+		log.Printf("Error releasing uploads of expired message %d: %v", message.ID, err)
+		return
+	}
+
+	for _, name := range names {
+		deleted, err := s.uploadRepo.DeleteUnreferencedUpload(name)
+		if err != nil {
+			log.Printf("Error deleting upload record %s of expired message %d: %v", name, message.ID, err)
+			continue
+		}
+		// Claimed again by another message since the reference was dropped
+		if !deleted {
+			continue
+		}
+
+		path := filepath.Join(s.uploadDir, name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing upload %s of expired message %d: %v", path, message.ID, err)
+		}
+	}
+}
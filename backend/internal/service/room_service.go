@@ -4,77 +4,112 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/rufflogix/computer-network-project/internal/entity"
 )
 
 type RoomService interface {
-	AddClient(*websocket.Conn, int64)
-	RemoveClient(int64)
+	// AddClient registers one connection of the user, opened with the given auth session
+	AddClient(conn *websocket.Conn, userID int64, sessionID string)
+	// RemoveClient drops the connection and reports whether it was the user's last one
+	RemoveClient(userID int64, conn *websocket.Conn) bool
 	Broadcast([]byte, int64)
 	JoinRoom(userID, chatID int64) bool
 	LeaveRoom(userID, chatID int64)
 	BroadcastToRoom(chatID int64, message []byte)
 	BroadcastToRoomExcept(chatID int64, message []byte, excludeUserID int64)
 	SendToUser(userID int64, event entity.Event)
+	// SendToUserExcept reaches the user's connections except those opened with sessionID
+	SendToUserExcept(userID int64, sessionID string, event entity.Event)
 	GetOnlineUsers() []int64
+	DisconnectSession(sessionID string)
+}
+
+// wsWriteWait bounds a single write, so a stalled client cannot hold up broadcasts for long
+const wsWriteWait = 10 * time.Second
+
+// wsClient is one WebSocket connection of a user. gorilla/websocket allows only one writer per
+// connection at a time and broadcasts run concurrently under the read lock, so writes take writeMu.
+type wsClient struct {
+	conn      *websocket.Conn
+	sessionID string // the auth session the connection was opened with
+	writeMu   sync.Mutex
+}
+
+func (c *wsClient) write(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteMessage(websocket.TextMessage, message)
 }
 
 type implRoomService struct {
-	clients   map[int64]*websocket.Conn // userID -> connection
-	rooms     map[int64]map[int64]bool  // chatID -> set of userIDs
-	userRooms map[int64]map[int64]bool  // userID -> set of chatIDs
+	clients   map[int64]map[*websocket.Conn]*wsClient // userID -> connections
+	rooms     map[int64]map[int64]bool                // chatID -> set of userIDs
+	userRooms map[int64]map[int64]bool                // userID -> set of chatIDs
 	mutex     sync.RWMutex
 }
 
 func NewRoomService() RoomService {
 	return &implRoomService{
-		clients:   make(map[int64]*websocket.Conn),
+		clients:   make(map[int64]map[*websocket.Conn]*wsClient),
 		rooms:     make(map[int64]map[int64]bool),
 		userRooms: make(map[int64]map[int64]bool),
 	}
 }
 
-func (s *implRoomService) AddClient(conn *websocket.Conn, id int64) {
+func (s *implRoomService) AddClient(conn *websocket.Conn, userID int64, sessionID string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.clients[id] = conn
 
-	if s.userRooms[id] == nil {
-		s.userRooms[id] = make(map[int64]bool)
+	if s.clients[userID] == nil {
+		s.clients[userID] = make(map[*websocket.Conn]*wsClient)
+	}
+	s.clients[userID][conn] = &wsClient{conn: conn, sessionID: sessionID}
+
+	if s.userRooms[userID] == nil {
+		s.userRooms[userID] = make(map[int64]bool)
 	}
 }
 
-func (s *implRoomService) RemoveClient(id int64) {
+func (s *implRoomService) RemoveClient(userID int64, conn *websocket.Conn) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	// Remove from all rooms
-	if rooms, ok := s.userRooms[id]; ok {
+	if conns, ok := s.clients[userID]; ok {
+		delete(conns, conn)
+		if len(conns) > 0 {
+			return false
+		}
+	}
+
+	// Last connection gone: remove from all rooms
+	if rooms, ok := s.userRooms[userID]; ok {
 		for chatID := range rooms {
 			if s.rooms[chatID] != nil {
-				delete(s.rooms[chatID], id)
+				delete(s.rooms[chatID], userID)
 			}
 		}
-		delete(s.userRooms, id)
+		delete(s.userRooms, userID)
 	}
 
-	delete(s.clients, id)
+	delete(s.clients, userID)
+	return true
 }
 
 func (s *implRoomService) Broadcast(message []byte, senderID int64) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for id, conn := range s.clients {
+	for id := range s.clients {
 		if senderID == id {
 			continue
 		}
 
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("Error broadcasting to user %d: %v", id, err)
-		}
+		s.writeToUser(id, message, "")
 	}
 }
 
@@ -114,21 +149,7 @@ func (s *implRoomService) LeaveRoom(userID, chatID int64) {
 }
 
 func (s *implRoomService) BroadcastToRoom(chatID int64, message []byte) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	roomMembers, ok := s.rooms[chatID]
-	if !ok {
-		return
-	}
-
-	for userID := range roomMembers {
-		if conn, ok := s.clients[userID]; ok {
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Error sending to user %d in room %d: %v", userID, chatID, err)
-			}
-		}
-	}
+	s.BroadcastToRoomExcept(chatID, message, 0)
 }
 
 func (s *implRoomService) BroadcastToRoomExcept(chatID int64, message []byte, excludeUserID int64) {
@@ -145,20 +166,19 @@ func (s *implRoomService) BroadcastToRoomExcept(chatID int64, message []byte, ex
 			continue
 		}
 
-		if conn, ok := s.clients[userID]; ok {
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Error sending to user %d in room %d: %v", userID, chatID, err)
-			}
-		}
+		s.writeToUser(userID, message, "")
 	}
 }
 
 func (s *implRoomService) SendToUser(userID int64, event entity.Event) {
+	s.SendToUserExcept(userID, "", event)
+}
+
+func (s *implRoomService) SendToUserExcept(userID int64, sessionID string, event entity.Event) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	conn, ok := s.clients[userID]
-	if !ok {
+	if _, ok := s.clients[userID]; !ok {
 		return
 	}
 
@@ -168,8 +188,19 @@ func (s *implRoomService) SendToUser(userID int64, event entity.Event) {
 		return
 	}
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Printf("Error sending to user %d: %v", userID, err)
+	s.writeToUser(userID, data, sessionID)
+}
+
+// writeToUser writes to every connection of the user except those of excludeSessionID; the caller holds the lock
+func (s *implRoomService) writeToUser(userID int64, message []byte, excludeSessionID string) {
+	for _, client := range s.clients[userID] {
+		if excludeSessionID != "" && client.sessionID == excludeSessionID {
+			continue
+		}
+
+		if err := client.write(message); err != nil {
+			log.Printf("Error sending to user %d: %v", userID, err)
+		}
 	}
 }
 
@@ -183,3 +214,71 @@ func (s *implRoomService) GetOnlineUsers() []int64 {
 	}
 	return userIDs
 }
+
+// DisconnectSession closes the connections opened with a revoked session; their read loops then clean them up
+func (s *implRoomService) DisconnectSession(sessionID string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for userID, conns := range s.clients {
+		for conn, client := range conns {
+			if client.sessionID != sessionID {
+				continue
+			}
+
+			data, err := json.Marshal(entity.Event{
+				Type: entity.SESSION_REVOKED,
+				Data: map[string]interface{}{"session_id": sessionID},
+			})
+			if err == nil {
+				client.write(data)
+			}
+
+			conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked"),
+				time.Now().Add(time.Second),
+			)
+			conn.Close()
+			log.Printf("Disconnected user %d: session %s revoked", userID, sessionID)
+		}
+	}
+}
+
+// NewMessageEvent builds the event announcing a new message; thread replies go out as THREAD_REPLY
+// so clients can update the thread without inserting the reply into the main timeline
+func NewMessageEvent(message *entity.Message) entity.Event {
+	if message.ThreadID != nil {
+		return entity.Event{
+			Type: entity.THREAD_REPLY,
+			Data: map[string]interface{}{
+				"thread_id": *message.ThreadID,
+				"message":   message,
+				"thread":    message.Thread,
+			},
+			CreatedBy: message.CreatedBy,
+		}
+	}
+
+	return entity.Event{
+		Type:      entity.SEND_MESSAGE,
+		Data:      map[string]interface{}{"message": message},
+		CreatedBy: message.CreatedBy,
+	}
+}
+
+// broadcastMessage sends a newly saved message to the chat's room
+func broadcastMessage(roomService RoomService, message *entity.Message) {
+	broadcastEvent(roomService, message.ChatID, NewMessageEvent(message))
+}
+
+// broadcastEvent sends an event to everyone in the chat's room
+func broadcastEvent(roomService RoomService, chatID int64, event entity.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling event: %v", err)
+		return
+	}
+
+	roomService.BroadcastToRoom(chatID, data)
+}
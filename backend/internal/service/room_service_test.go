@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+// dialRoomClient connects a WebSocket client whose server side is registered with rooms as userID
+func dialRoomClient(t *testing.T, rooms RoomService, userID int64, sessionID string) *websocket.Conn {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	registered := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rooms.AddClient(conn, userID, sessionID)
+		close(registered)
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	<-registered
+	return client
+}
+
+func TestRoomServiceSerializesWrites(t *testing.T) {
+	rooms := NewRoomService()
+	client := dialRoomClient(t, rooms, 1, "session")
+	rooms.JoinRoom(1, 10)
+
+	// Broadcasts and direct sends race for the same connection
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rooms.BroadcastToRoom(10, []byte(`{"type":"send_message"}`))
+		}()
+		go func() {
+			defer wg.Done()
+			rooms.SendToUser(1, entity.Event{Type: entity.TYPING})
+		}()
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for received := 0; received < 2*writers; received++ {
+		if _, _, err := client.ReadMessage(); err != nil {
+			t.Fatalf("read %d of %d messages: %v", received, 2*writers, err)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxScheduledPerUser = 100
+	maxScheduleAhead    = 365 * 24 * time.Hour
+	scheduledClaimLease = time.Minute
+)
+
+var ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+
+// ScheduleInput is what a user provides when scheduling or editing a message
+type ScheduleInput struct {
+	Content   string
+	Type      entity.MessageType
+	MediaURL  string
+	FileName  string
+	FileSize  int64
+	ReplyToID *int64
+	ThreadID  *int64
+	SendAt    time.Time
+}
+
+// ScheduledMessageService stores messages to be sent later and sends them when they are due
+type ScheduledMessageService interface {
+	Schedule(userID, chatID int64, input *ScheduleInput) (*entity.ScheduledMessage, error)
+	GetScheduled(userID int64, chatID *int64) ([]*entity.ScheduledMessage, error)
+	// Reschedule changes the content and send time of a message that has not been sent yet
+	Reschedule(userID int64, id string, content *string, sendAt *time.Time) (*entity.ScheduledMessage, error)
+	Cancel(userID int64, id string) error
+	// StartScheduler sends due messages in the background until ctx is cancelled
+	StartScheduler(ctx context.Context)
+	// ProcessDueMessages sends every message that is due now and returns how many were handled
+	ProcessDueMessages() (int, error)
+}
+
+type implScheduledMessageService struct {
+	scheduledRepo repository.ScheduledMessageRepository
+	chatRepo      repository.ChatRepository
+	uploadRepo    repository.UploadRepository
+	chatService   ChatService
+	roomService   RoomService
+	interval      time.Duration
+	wake          chan struct{}
+	now           func() time.Time
+}
+
+func NewScheduledMessageService(
+	scheduledRepo repository.ScheduledMessageRepository,
+	chatRepo repository.ChatRepository,
+	uploadRepo repository.UploadRepository,
+	chatService ChatService,
+	roomService RoomService,
+) ScheduledMessageService {
+	return &implScheduledMessageService{
+		scheduledRepo: scheduledRepo,
+		chatRepo:      chatRepo,
+		uploadRepo:    uploadRepo,
+		chatService:   chatService,
+		roomService:   roomService,
+		interval:      envDuration("SCHEDULER_INTERVAL", 5*time.Second),
+		wake:          make(chan struct{}, 1),
+		now:           time.Now,
+	}
+}
+
+func (s *implScheduledMessageService) Schedule(userID, chatID int64, input *ScheduleInput) (*entity.ScheduledMessage, error) {
+	if input.Type == "" {
+		input.Type = entity.Text
+	}
+	if input.Type == entity.System {
+		return nil, errors.New("system messages cannot be scheduled")
+	}
+	if err := validateScheduledContent(input.Type, input.Content, input.MediaURL); err != nil {
+		return nil, err
+	}
+	if err := s.validateSendAt(input.SendAt); err != nil {
+		return nil, err
+	}
+
+	if isMember, err := s.chatRepo.IsChatMember(chatID, userID); err != nil || !isMember {
+		return nil, errors.New("you are not a member of this chat")
+	}
+
+	count, err := s.scheduledRepo.CountPendingScheduledMessages(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxScheduledPerUser {
+		return nil, errors.New("you have too many scheduled messages")
+	}
+
+	scheduled := &entity.ScheduledMessage{
+		ChatID:    chatID,
+		CreatedBy: userID,
+		Content:   input.Content,
+		Type:      input.Type,
+		MediaURL:  input.MediaURL,
+		FileName:  input.FileName,
+		FileSize:  input.FileSize,
+		ReplyToID: input.ReplyToID,
+		ThreadID:  input.ThreadID,
+		SendAt:    input.SendAt,
+	}
+	if err := s.scheduledRepo.CreateScheduledMessage(scheduled); err != nil {
+		return nil, err
+	}
+	// Holds the file until the message is sent, even if another message using it expires first
+	claimUploads(s.uploadRepo, userID, scheduledUploadRef(scheduled.ID), uploadNames(scheduled.MediaURL, nil))
+
+	s.wakeScheduler()
+	return scheduled, nil
+}
+
+func (s *implScheduledMessageService) GetScheduled(userID int64, chatID *int64) ([]*entity.ScheduledMessage, error) {
+	return s.scheduledRepo.GetPendingScheduledMessages(userID, chatID)
+}
+
+func (s *implScheduledMessageService) Reschedule(userID int64, id string, content *string, sendAt *time.Time) (*entity.ScheduledMessage, error) {
+	scheduled, err := s.ownScheduledMessage(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if scheduled.Status != entity.ScheduledPending {
+		return nil, errors.New("scheduled message was already sent or canceled")
+	}
+
+	if content != nil {
+		if err := validateScheduledContent(scheduled.Type, *content, scheduled.MediaURL); err != nil {
+			return nil, err
+		}
+		scheduled.Content = *content
+	}
+	if sendAt != nil {
+		if err := s.validateSendAt(*sendAt); err != nil {
+			return nil, err
+		}
+		scheduled.SendAt = *sendAt
+	}
+
+	if err := s.scheduledRepo.UpdatePendingScheduledMessage(scheduled); err != nil {
+		return nil, err
+	}
+
+	s.wakeScheduler()
+	return scheduled, nil
+}
+
+func (s *implScheduledMessageService) Cancel(userID int64, id string) error {
+	scheduled, err := s.ownScheduledMessage(userID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.scheduledRepo.CancelScheduledMessage(scheduled.ID); err != nil {
+		return err
+	}
+
+	s.releaseUploads(scheduled)
+	return nil
+}
+
+// releaseUploads drops the scheduled message's hold on its files. The files themselves stay;
+// they are only removed when a message using them expires and nothing else needs them
+func (s *implScheduledMessageService) releaseUploads(scheduled *entity.ScheduledMessage) {
+	if _, err := s.uploadRepo.RemoveUploadReferences(scheduledUploadRef(scheduled.ID)); err != nil {
+		log.Printf("Error releasing uploads of scheduled message %s: %v", scheduled.ID.Hex(), err)
+	}
+}
+
+func (s *implScheduledMessageService) ownScheduledMessage(userID int64, id string) (*entity.ScheduledMessage, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrScheduledMessageNotFound
+	}
+
+	scheduled, err := s.scheduledRepo.GetScheduledMessageByID(objectID)
+	if err != nil || scheduled.CreatedBy != userID {
+		return nil, ErrScheduledMessageNotFound
+	}
+	return scheduled, nil
+}
+
+func (s *implScheduledMessageService) validateSendAt(sendAt time.Time) error {
+	now := s.now()
+	if !sendAt.After(now) {
+		return errors.New("send_at must be in the future")
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return errors.New("messages can be scheduled at most one year ahead")
+	}
+	return nil
+}
+
+func validateScheduledContent(messageType entity.MessageType, content, mediaURL string) error {
+	if messageType == entity.Text && strings.TrimSpace(content) == "" {
+		return errors.New("content is required")
+	}
+	if messageType != entity.Text && mediaURL == "" && strings.TrimSpace(content) == "" {
+		return errors.New("content or media_url is required")
+	}
+	// Checked again when sending, but catching bad formatting now saves a silent failure later
+	return formatMessage(&entity.Message{Type: messageType, Content: content})
+}
+
+func (s *implScheduledMessageService) wakeScheduler() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *implScheduledMessageService) StartScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.ProcessDueMessages(); err != nil {
+				log.Printf("Error processing scheduled messages: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// ProcessDueMessages claims due messages one at a time, so several servers can run the scheduler.
+// A send interrupted by a restart is retried once its claim expires.
+func (s *implScheduledMessageService) ProcessDueMessages() (int, error) {
+	processed := 0
+	for {
+		scheduled, err := s.scheduledRepo.ClaimDueScheduledMessage(s.now(), scheduledClaimLease)
+		if err != nil {
+			return processed, err
+		}
+		if scheduled == nil {
+			return processed, nil
+		}
+
+		s.send(scheduled)
+		processed++
+	}
+}
+
+func (s *implScheduledMessageService) send(scheduled *entity.ScheduledMessage) {
+	message := &entity.Message{
+		ChatID:    scheduled.ChatID,
+		Content:   scheduled.Content,
+		Type:      scheduled.Type,
+		MediaURL:  scheduled.MediaURL,
+		FileName:  scheduled.FileName,
+		FileSize:  scheduled.FileSize,
+		ReplyToID: scheduled.ReplyToID,
+		ThreadID:  scheduled.ThreadID,
+		CreatedBy: scheduled.CreatedBy,
+	}
+
+	err := s.deliver(message)
+	if err != nil {
+		scheduled.Status = entity.ScheduledFailed
+		scheduled.LastError = err.Error()
+
+		s.roomService.SendToUser(scheduled.CreatedBy, entity.Event{
+			Type: entity.MESSAGE_REJECTED,
+			Data: map[string]interface{}{
+				"chat_id":              scheduled.ChatID,
+				"scheduled_message_id": scheduled.ID.Hex(),
+				"error":                err.Error(),
+			},
+		})
+	} else {
+		sentAt := s.now()
+		scheduled.Status = entity.ScheduledSent
+		scheduled.MessageID = message.ID
+		scheduled.SentAt = &sentAt
+		scheduled.LastError = ""
+	}
+
+	if err := s.scheduledRepo.CompleteScheduledMessage(scheduled); err != nil {
+		log.Printf("Error completing scheduled message %s: %v", scheduled.ID.Hex(), err)
+		return
+	}
+
+	// A sent message has claimed the files itself by now
+	s.releaseUploads(scheduled)
+}
+
+// deliver sends the message as its author would, provided they can still post in the chat
+func (s *implScheduledMessageService) deliver(message *entity.Message) error {
+	if isMember, err := s.chatRepo.IsChatMember(message.ChatID, message.CreatedBy); err != nil || !isMember {
+		return errors.New("author is no longer a member of the chat")
+	}
+
+	if err := s.chatService.SendMessage(message); err != nil {
+		return err
+	}
+
+	broadcastMessage(s.roomService, message)
+	return nil
+}
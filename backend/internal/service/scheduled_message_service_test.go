@@ -0,0 +1,257 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const scheduledTestUserID = 7
+
+type scheduledTestEnv struct {
+	service     *implScheduledMessageService
+	repo        *fakeScheduledMessageRepository
+	uploads     *fakeUploadRepository
+	chatService *fakeChatService
+	chatID      int64
+	clock       *testClock
+}
+
+func newScheduledTestEnv(t *testing.T) *scheduledTestEnv {
+	t.Helper()
+
+	env := &scheduledTestEnv{
+		repo:        newFakeScheduledMessageRepository(),
+		uploads:     &fakeUploadRepository{},
+		chatService: &fakeChatService{},
+		clock:       newTestClock(),
+	}
+
+	chatRepo := repository.NewChatRepository()
+	env.chatID = newTestChat(t, chatRepo, map[int64]string{scheduledTestUserID: "member"})
+
+	env.service = NewScheduledMessageService(env.repo, chatRepo, env.uploads, env.chatService, NewRoomService()).(*implScheduledMessageService)
+	env.service.now = env.clock.Now
+	return env
+}
+
+func (env *scheduledTestEnv) schedule(t *testing.T, content string, in time.Duration) *entity.ScheduledMessage {
+	t.Helper()
+
+	scheduled, err := env.service.Schedule(scheduledTestUserID, env.chatID, &ScheduleInput{
+		Content: content,
+		SendAt:  env.clock.Now().Add(in),
+	})
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	return scheduled
+}
+
+func (env *scheduledTestEnv) process(t *testing.T) int {
+	t.Helper()
+
+	processed, err := env.service.ProcessDueMessages()
+	if err != nil {
+		t.Fatalf("ProcessDueMessages: %v", err)
+	}
+	return processed
+}
+
+func (env *scheduledTestEnv) status(t *testing.T, id primitive.ObjectID) entity.ScheduledMessageStatus {
+	t.Helper()
+
+	scheduled, err := env.repo.GetScheduledMessageByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduled.Status
+}
+
+func TestProcessDueMessagesWaitsUntilSendAt(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "good morning", time.Hour)
+
+	env.clock.Advance(59 * time.Minute)
+	if processed := env.process(t); processed != 0 {
+		t.Fatalf("processed %d messages before they were due", processed)
+	}
+	if len(env.chatService.sentMessages()) != 0 {
+		t.Fatal("a message was sent early")
+	}
+	if status := env.status(t, scheduled.ID); status != entity.ScheduledPending {
+		t.Fatalf("status = %s, want pending", status)
+	}
+}
+
+func TestProcessDueMessagesSendsDueMessage(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "standup in 5", time.Hour)
+
+	env.clock.Advance(time.Hour)
+	if processed := env.process(t); processed != 1 {
+		t.Fatalf("processed %d messages, want 1", processed)
+	}
+
+	sent := env.chatService.sentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	if sent[0].Content != "standup in 5" || sent[0].ChatID != env.chatID || sent[0].CreatedBy != scheduledTestUserID {
+		t.Fatalf("unexpected message: %+v", sent[0])
+	}
+
+	stored, _ := env.repo.GetScheduledMessageByID(scheduled.ID)
+	if stored.Status != entity.ScheduledSent || stored.MessageID != sent[0].ID || stored.SentAt == nil || !stored.SentAt.Equal(env.clock.Now()) {
+		t.Fatalf("unexpected record: status=%s message_id=%d sent_at=%v", stored.Status, stored.MessageID, stored.SentAt)
+	}
+	if stored.LockedUntil != nil {
+		t.Fatal("the claim was not released")
+	}
+	if !env.uploads.released(scheduledUploadRef(scheduled.ID)) {
+		t.Fatal("the scheduled message kept its hold on its uploads")
+	}
+
+	// Nothing is left to send
+	env.clock.Advance(time.Hour)
+	if processed := env.process(t); processed != 0 {
+		t.Fatalf("a sent message was processed again")
+	}
+}
+
+func TestProcessDueMessagesRetriesExpiredClaim(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "sent after a restart", time.Minute)
+
+	// A scheduler claims the message and dies before sending it
+	env.clock.Advance(time.Minute)
+	if claimed, err := env.repo.ClaimDueScheduledMessage(env.clock.Now(), scheduledClaimLease); err != nil || claimed == nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	claimedAt := env.clock.Now()
+
+	// The restarted scheduler leaves the claim alone while it may still be in use
+	env.clock.Set(claimedAt.Add(scheduledClaimLease - time.Second))
+	if processed := env.process(t); processed != 0 {
+		t.Fatalf("took over a claim that had not expired")
+	}
+	if status := env.status(t, scheduled.ID); status != entity.ScheduledSending {
+		t.Fatalf("status = %s, want sending", status)
+	}
+
+	env.clock.Set(claimedAt.Add(scheduledClaimLease))
+	if processed := env.process(t); processed != 1 {
+		t.Fatalf("processed %d messages after the claim expired, want 1", processed)
+	}
+	if sent := env.chatService.sentMessages(); len(sent) != 1 || sent[0].Content != "sent after a restart" {
+		t.Fatalf("expected the message to be sent once, got %d", len(sent))
+	}
+	if status := env.status(t, scheduled.ID); status != entity.ScheduledSent {
+		t.Fatalf("status = %s, want sent", status)
+	}
+}
+
+func TestCancelBeforeDue(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "never mind", time.Hour)
+
+	if err := env.service.Cancel(scheduledTestUserID, scheduled.ID.Hex()); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if !env.uploads.released(scheduledUploadRef(scheduled.ID)) {
+		t.Fatal("canceling kept the hold on the uploads")
+	}
+
+	env.clock.Advance(2 * time.Hour)
+	if processed := env.process(t); processed != 0 || len(env.chatService.sentMessages()) != 0 {
+		t.Fatal("a canceled message was sent")
+	}
+	if status := env.status(t, scheduled.ID); status != entity.ScheduledCanceled {
+		t.Fatalf("status = %s, want canceled", status)
+	}
+}
+
+func TestCancelLosesRaceWithScheduler(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "already on its way", time.Minute)
+	env.clock.Advance(time.Minute)
+
+	// The message is still pending when Cancel reads it, but the scheduler claims it before the write
+	env.repo.beforeWrite = func(primitive.ObjectID) {
+		env.repo.beforeWrite = nil
+		env.process(t)
+	}
+
+	if err := env.service.Cancel(scheduledTestUserID, scheduled.ID.Hex()); err == nil {
+		t.Fatal("canceled a message that was being sent")
+	}
+	if status := env.status(t, scheduled.ID); status != entity.ScheduledSent {
+		t.Fatalf("status = %s, want sent", status)
+	}
+	if len(env.chatService.sentMessages()) != 1 {
+		t.Fatal("the message was not sent exactly once")
+	}
+}
+
+func TestRescheduleLosesRaceWithScheduler(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "original", time.Minute)
+	env.clock.Advance(time.Minute)
+
+	env.repo.beforeWrite = func(id primitive.ObjectID) {
+		env.repo.beforeWrite = nil
+		if claimed, err := env.repo.ClaimDueScheduledMessage(env.clock.Now(), scheduledClaimLease); err != nil || claimed == nil {
+			t.Fatalf("claim failed: %v", err)
+		}
+	}
+
+	content := "edited"
+	sendAt := env.clock.Now().Add(time.Hour)
+	if _, err := env.service.Reschedule(scheduledTestUserID, scheduled.ID.Hex(), &content, &sendAt); err == nil {
+		t.Fatal("rescheduled a message that was being sent")
+	}
+
+	stored, _ := env.repo.GetScheduledMessageByID(scheduled.ID)
+	if stored.Status != entity.ScheduledSending || stored.Content != "original" {
+		t.Fatalf("claimed message changed: status=%s content=%q", stored.Status, stored.Content)
+	}
+
+	// Once sent, it can no longer be edited or canceled either
+	env.clock.Advance(scheduledClaimLease)
+	env.process(t)
+	if _, err := env.service.Reschedule(scheduledTestUserID, scheduled.ID.Hex(), &content, nil); err == nil {
+		t.Fatal("rescheduled a sent message")
+	}
+	if err := env.service.Cancel(scheduledTestUserID, scheduled.ID.Hex()); err == nil {
+		t.Fatal("canceled a sent message")
+	}
+	if sent := env.chatService.sentMessages(); len(sent) != 1 || sent[0].Content != "original" {
+		t.Fatal("expected the original content to be sent once")
+	}
+}
+
+func TestRescheduleWhilePending(t *testing.T) {
+	env := newScheduledTestEnv(t)
+	scheduled := env.schedule(t, "draft", time.Minute)
+
+	content := "final"
+	sendAt := env.clock.Now().Add(time.Hour)
+	if _, err := env.service.Reschedule(scheduledTestUserID, scheduled.ID.Hex(), &content, &sendAt); err != nil {
+		t.Fatalf("Reschedule: %v", err)
+	}
+
+	// The old send time passes without anything being sent
+	env.clock.Advance(time.Minute)
+	if processed := env.process(t); processed != 0 {
+		t.Fatal("sent at the old time")
+	}
+
+	env.clock.Set(sendAt)
+	env.process(t)
+	if sent := env.chatService.sentMessages(); len(sent) != 1 || sent[0].Content != "final" {
+		t.Fatal("expected the rescheduled content to be sent")
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+// maxCachedSessions bounds the cache; expired entries are pruned when it fills up
+const maxCachedSessions = 10000
+
+type cachedSession struct {
+	user     *entity.User
+	session  *entity.Session
+	cachedAt time.Time
+}
+
+// sessionCache remembers recently validated sessions so authenticated requests do not hit the
+// database every time. Revocations on this server take effect at once; on other servers they
+// take effect within the TTL.
+type sessionCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*cachedSession
+	now     func() time.Time
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		entries: make(map[string]*cachedSession),
+		now:     time.Now,
+	}
+}
+
+func (c *sessionCache) get(sessionID string) (*entity.User, *entity.Session, bool) {
+	if c.ttl <= 0 {
+		return nil, nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[sessionID]
+	if !ok {
+		return nil, nil, false
+	}
+
+	now := c.now()
+	if now.Sub(entry.cachedAt) >= c.ttl || now.After(entry.session.ExpiresAt) {
+		delete(c.entries, sessionID)
+		return nil, nil, false
+	}
+
+	return entry.user, entry.session, true
+}
+
+func (c *sessionCache) put(user *entity.User, session *entity.Session) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxCachedSessions {
+		for id, entry := range c.entries {
+			if now.Sub(entry.cachedAt) >= c.ttl {
+				delete(c.entries, id)
+			}
+		}
+	}
+	if len(c.entries) >= maxCachedSessions {
+		return
+	}
+
+	c.entries[session.ID.Hex()] = &cachedSession{user: user, session: session, cachedAt: now}
+}
+
+func (c *sessionCache) forgetSession(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, sessionID)
+}
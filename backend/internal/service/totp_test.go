@@ -0,0 +1,189 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+// The SHA-1 test vectors from RFC 6238 appendix B
+var rfc6238Key = []byte("12345678901234567890")
+
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestHOTPMatchesRFC6238Vectors(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		step := totpStep(time.Unix(vector.unix, 0))
+		if got := hotp(rfc6238Key, uint64(step), 8); got != vector.code {
+			t.Errorf("T=%d: got %s, want %s", vector.unix, got, vector.code)
+		}
+	}
+}
+
+func TestValidateTOTPMatchesRFC6238Vectors(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+
+	for _, vector := range rfc6238Vectors {
+		at := time.Unix(vector.unix, 0)
+		// Six digits are the low digits of the same truncated value
+		code := vector.code[len(vector.code)-totpDigits:]
+
+		step, ok := validateTOTP(secret, code, at)
+		if !ok || step != totpStep(at) {
+			t.Errorf("T=%d: code %s rejected (step %d, ok=%v)", vector.unix, code, step, ok)
+		}
+		if _, ok := validateTOTP(strings.ToLower(secret), code[:3]+" "+code[3:], at); !ok {
+			t.Errorf("T=%d: lowercase secret or spaced code rejected", vector.unix)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	code := "287082" // T=59, step 1
+
+	for _, tc := range []struct {
+		unix int64
+		ok   bool
+	}{
+		{0, true},   // one step early
+		{59, true},  // its own step
+		{89, true},  // one step late
+		{90, false}, // two steps late
+	} {
+		if _, ok := validateTOTP(secret, code, time.Unix(tc.unix, 0)); ok != tc.ok {
+			t.Errorf("T=%d: accepted=%v, want %v", tc.unix, ok, tc.ok)
+		}
+	}
+
+	if _, ok := validateTOTP(secret, "28708", time.Unix(59, 0)); ok {
+		t.Error("accepted a code with too few digits")
+	}
+	if _, ok := validateTOTP("not base32!", code, time.Unix(59, 0)); ok {
+		t.Error("accepted a code for an invalid secret")
+	}
+}
+
+func newTwoFactorTestService(t *testing.T) (*implAuthService, *fakeUserRepository, *testClock) {
+	t.Helper()
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeUserRepository{}
+	repo.add(entity.User{
+		NumericID:        42,
+		Username:         "alice",
+		TwoFactorEnabled: true,
+		TwoFactorSecret:  secret,
+	})
+
+	clock := newTestClock()
+	return &implAuthService{userRepo: repo, now: clock.Now}, repo, clock
+}
+
+// twoFactorUser reloads the user, as the service would before checking a code
+func twoFactorUser(t *testing.T, repo *fakeUserRepository) *entity.User {
+	t.Helper()
+
+	user, err := repo.GetUserByNumericID(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func currentTOTP(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotp(key, uint64(totpStep(at)), totpDigits)
+}
+
+func TestVerifySecondFactorRejectsReplay(t *testing.T) {
+	s, repo, clock := newTwoFactorTestService(t)
+	secret := twoFactorUser(t, repo).TwoFactorSecret
+
+	code := currentTOTP(t, secret, clock.Now())
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), code, false); err != nil {
+		t.Fatalf("fresh code rejected: %v", err)
+	}
+	if step := twoFactorUser(t, repo).TwoFactorLastStep; step != totpStep(clock.Now()) {
+		t.Fatalf("last step = %d, want %d", step, totpStep(clock.Now()))
+	}
+
+	// Same code again, still within its step
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), code, false); err == nil {
+		t.Fatal("replayed code accepted")
+	}
+
+	// The previous step is still inside the skew window, but older than the one already used
+	previous := currentTOTP(t, secret, clock.Now().Add(-totpPeriod))
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), previous, false); err == nil {
+		t.Fatal("code from an earlier step accepted after a later one was used")
+	}
+
+	clock.Advance(totpPeriod)
+	next := currentTOTP(t, secret, clock.Now())
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), next, false); err != nil {
+		t.Fatalf("code from the next step rejected: %v", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	s, repo, _ := newTwoFactorTestService(t)
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	for i, code := range codes {
+		if strings.Contains(strings.Join(hashes, ","), code) || hashes[i] != hashToken(normalizeRecoveryCode(code)) {
+			t.Fatalf("recovery code %d is not stored as its hash", i)
+		}
+	}
+	repo.update(42, func(user *entity.User) bool {
+		user.RecoveryCodes = hashes
+		return true
+	})
+
+	// Typed in upper case with spaces, the way a user copies it off paper
+	typed := " " + strings.ToUpper(codes[0]) + " "
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), typed, true); err != nil {
+		t.Fatalf("recovery code rejected: %v", err)
+	}
+	if left := len(twoFactorUser(t, repo).RecoveryCodes); left != recoveryCodeCount-1 {
+		t.Fatalf("%d recovery codes left, want %d", left, recoveryCodeCount-1)
+	}
+
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), codes[0], true); err == nil {
+		t.Fatal("recovery code accepted twice")
+	}
+
+	// Where only a TOTP code is good enough, recovery codes are refused
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), codes[1], false); err == nil {
+		t.Fatal("recovery code accepted where it is not allowed")
+	}
+	if err := s.verifySecondFactor(twoFactorUser(t, repo), codes[1], true); err != nil {
+		t.Fatalf("unused recovery code rejected: %v", err)
+	}
+}
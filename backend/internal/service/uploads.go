@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// uploadNames returns the names of the files in our uploads directory that the URLs point to
+func uploadNames(mediaURL string, attachments []*entity.Attachment) []string {
+	urls := []string{mediaURL}
+	for _, attachment := range attachments {
+		urls = append(urls, attachment.URL)
+	}
+
+	names := make([]string, 0, len(urls))
+	for _, url := range urls {
+		name, ok := strings.CutPrefix(url, "/uploads/")
+		if !ok || name == "" || name != filepath.Base(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func messageUploadRef(messageID int64) string {
+	return fmt.Sprintf("message:%d", messageID)
+}
+
+func scheduledUploadRef(id primitive.ObjectID) string {
+	return "scheduled:" + id.Hex()
+}
+
+// claimUploads records ref as a user of the named files the owner uploaded; files uploaded by
+// anyone else are left untouched, whatever URL the client put on the message
+func claimUploads(uploadRepo repository.UploadRepository, ownerID int64, ref string, names []string) {
+	for _, name := range names {
+		if _, err := uploadRepo.AddUploadReference(name, ownerID, ref); err != nil {
+			log.Printf("Error recording use of upload %s by %s: %v", name, ref, err)
+		}
+	}
+}
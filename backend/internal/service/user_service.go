@@ -0,0 +1,215 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+
+	// Members of larger chats (e.g. the global chat) are not pushed profile changes; their
+	// clients pick up the new profile with the next messages they load
+	maxProfileUpdateChatSize = 100
+)
+
+// ProfileUpdate holds the profile fields a user may change; nil fields are left untouched
+type ProfileUpdate struct {
+	Name          *string
+	Email         *string
+	StatusMessage *string
+	Discoverable  *bool
+}
+
+type UserService interface {
+	GetUser(userID int64) (*entity.User, error)
+	UpdateProfile(userID int64, update ProfileUpdate) (*entity.User, error)
+	SetAvatar(userID int64, avatarURL string) (*entity.User, error)
+	SearchUsers(requesterID int64, query string, includeGuests bool, limit, offset int) ([]*entity.User, error)
+}
+
+type implUserService struct {
+	userRepo       repository.UserRepository
+	friendshipRepo repository.FriendshipRepository
+	chatRepo       repository.ChatRepository
+	roomService    RoomService
+	authService    AuthService
+}
+
+func NewUserService(
+	userRepo repository.UserRepository,
+	friendshipRepo repository.FriendshipRepository,
+	chatRepo repository.ChatRepository,
+	roomService RoomService,
+	authService AuthService,
+) UserService {
+	return &implUserService{
+		userRepo:       userRepo,
+		friendshipRepo: friendshipRepo,
+		chatRepo:       chatRepo,
+		roomService:    roomService,
+		authService:    authService,
+	}
+}
+
+func (s *implUserService) GetUser(userID int64) (*entity.User, error) {
+	user, err := s.userRepo.GetUserByNumericID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return user, nil
+}
+
+func (s *implUserService) UpdateProfile(userID int64, update ProfileUpdate) (*entity.User, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, fmt.Errorf("name cannot be empty")
+		}
+		user.Name = name
+	}
+
+	emailChanged := false
+	if update.Email != nil && *update.Email != user.Email {
+		if user.IsGuest {
+			return nil, fmt.Errorf("guest accounts cannot set an email")
+		}
+		if existing, _ := s.userRepo.GetUserByEmail(*update.Email); existing != nil {
+			return nil, fmt.Errorf("email already exists")
+		}
+		user.Email = *update.Email
+		user.EmailVerified = false
+		emailChanged = true
+	}
+
+	if update.StatusMessage != nil {
+		user.StatusMessage = strings.TrimSpace(*update.StatusMessage)
+	}
+
+	if update.Discoverable != nil {
+		user.Discoverable = update.Discoverable
+	}
+
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	// As with registration, the update stands even if the email cannot be sent; it can be resent later
+	if emailChanged {
+		if err := s.authService.SendVerificationEmail(user.NumericID); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", user.NumericID, err)
+		}
+	}
+
+	s.emitUserUpdated(user)
+
+	return user, nil
+}
+
+func (s *implUserService) SetAvatar(userID int64, avatarURL string) (*entity.User, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Avatar = avatarURL
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	s.emitUserUpdated(user)
+
+	return user, nil
+}
+
+func (s *implUserService) SearchUsers(requesterID int64, query string, includeGuests bool, limit, offset int) ([]*entity.User, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Hide the requester and anyone on either side of a block
+	excludeIDs := []int64{requesterID}
+	relationships, err := s.friendshipRepo.GetAllFriendshipsByUser(requesterID)
+	if err != nil {
+		return nil, err
+	}
+	for _, friendship := range relationships {
+		if friendship.Status != entity.Blocked {
+			continue
+		}
+		if friendship.UserID == requesterID {
+			excludeIDs = append(excludeIDs, friendship.FriendID)
+		} else {
+			excludeIDs = append(excludeIDs, friendship.UserID)
+		}
+	}
+
+	return s.userRepo.SearchUsers(query, includeGuests, excludeIDs, limit, offset)
+}
+
+// emitUserUpdated pushes the new public profile to friends and to the members of the small chats the user is in
+func (s *implUserService) emitUserUpdated(user *entity.User) {
+	if s.roomService == nil {
+		return
+	}
+
+	recipients := make(map[int64]bool)
+
+	friendships, err := s.friendshipRepo.GetFriendshipsByUser(user.NumericID)
+	if err == nil {
+		for _, friendship := range friendships {
+			recipients[friendship.UserID] = true
+			recipients[friendship.FriendID] = true
+		}
+	}
+
+	chats, err := s.chatRepo.GetChatsByUser(user.NumericID)
+	if err == nil {
+		for _, chat := range chats {
+			members, err := s.chatRepo.GetChatMembers(chat.ID)
+			if err != nil || len(members) > maxProfileUpdateChatSize {
+				continue
+			}
+			for _, member := range members {
+				recipients[member.UserID] = true
+			}
+		}
+	}
+
+	// Include the user so their own client refreshes too
+	recipients[user.NumericID] = true
+
+	event := entity.Event{
+		Type: entity.USER_UPDATED,
+		Data: map[string]interface{}{
+			"user": user.PublicProfile(),
+		},
+		CreatedBy: user.NumericID,
+	}
+
+	for recipientID := range recipients {
+		s.roomService.SendToUser(recipientID, event)
+	}
+}
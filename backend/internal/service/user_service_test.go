@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+)
+
+const profileTestUserID = 5
+
+func newProfileTestService(t *testing.T) (UserService, *fakeUserRepository, *fakeVerificationAuthService) {
+	t.Helper()
+
+	users := &fakeUserRepository{}
+	users.add(entity.User{
+		NumericID:     profileTestUserID,
+		Username:      "frank",
+		Name:          "Frank",
+		Email:         "frank@example.com",
+		EmailVerified: true,
+		Avatar:        "/uploads/frank.png",
+		StatusMessage: "on holiday",
+	})
+	auth := &fakeVerificationAuthService{}
+	return NewUserService(users, nil, nil, nil, auth), users, auth
+}
+
+func TestUpdateProfileClearsStatusMessage(t *testing.T) {
+	service, users, _ := newProfileTestService(t)
+
+	empty := ""
+	if _, err := service.UpdateProfile(profileTestUserID, ProfileUpdate{StatusMessage: &empty}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	stored, _ := users.GetUserByNumericID(profileTestUserID)
+	if stored.StatusMessage != "" {
+		t.Fatalf("status message = %q, want it cleared", stored.StatusMessage)
+	}
+	if stored.Avatar != "/uploads/frank.png" || stored.Name != "Frank" {
+		t.Fatal("clearing the status message changed other fields")
+	}
+}
+
+func TestSetAvatarClearsAvatar(t *testing.T) {
+	service, users, _ := newProfileTestService(t)
+
+	if _, err := service.SetAvatar(profileTestUserID, ""); err != nil {
+		t.Fatalf("SetAvatar: %v", err)
+	}
+	if stored, _ := users.GetUserByNumericID(profileTestUserID); stored.Avatar != "" {
+		t.Fatalf("avatar = %q, want it removed", stored.Avatar)
+	}
+}
+
+func TestUpdateProfileEmailChangeSendsVerification(t *testing.T) {
+	service, users, auth := newProfileTestService(t)
+
+	// Saving the same address again is not a change
+	same := "frank@example.com"
+	if _, err := service.UpdateProfile(profileTestUserID, ProfileUpdate{Email: &same}); err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.verificationsSent()) != 0 {
+		t.Fatal("an unchanged email was sent a verification")
+	}
+
+	changed := "frank@example.org"
+	if _, err := service.UpdateProfile(profileTestUserID, ProfileUpdate{Email: &changed}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	stored, _ := users.GetUserByNumericID(profileTestUserID)
+	if stored.Email != changed || stored.EmailVerified {
+		t.Fatalf("email = %q verified=%v, want the new unverified address", stored.Email, stored.EmailVerified)
+	}
+	if sent := auth.verificationsSent(); len(sent) != 1 || sent[0] != profileTestUserID {
+		t.Fatalf("verification emails sent to %v, want the user once", sent)
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	webhookMaxBackoff   = time.Hour
+	webhookClaimLease   = 2 * time.Minute // Longer than a delivery attempt can take
+	webhookMaxDrain     = 64 * 1024       // Bytes of a response read so the connection can be reused
+	webhookDeliveryPage = 50
+)
+
+// Headers sent with every delivery. The signature is hex HMAC-SHA256 over "<timestamp>.<body>".
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+var ErrNotChatAdmin = errors.New("only chat admins can manage webhooks")
+
+// WebhookService lets chat admins register outgoing webhooks and delivers chat events to them
+type WebhookService interface {
+	// CreateWebhook returns the webhook and its signing secret, which is shown only once
+	CreateWebhook(requesterID, chatID int64, rawURL string, events []string) (*entity.Webhook, string, error)
+	GetWebhooks(requesterID, chatID int64) ([]*entity.Webhook, error)
+	DeleteWebhook(requesterID int64, webhookID string) error
+	GetDeliveries(requesterID int64, webhookID string) ([]*entity.WebhookDelivery, error)
+
+	// Publish queues an event for every active webhook of the chat that subscribes to it
+	Publish(chatID int64, event string, data interface{})
+
+	StartWorker(ctx context.Context)
+	// ProcessDueDeliveries sends every delivery that is due and returns how many were attempted
+	ProcessDueDeliveries() (int, error)
+}
+
+type implWebhookService struct {
+	webhookRepo repository.WebhookRepository
+	chatRepo    repository.ChatRepository
+	userRepo    repository.UserRepository
+	client      *http.Client
+	maxAttempts int
+	retryBase   time.Duration
+	interval    time.Duration
+	wake        chan struct{}
+	now         func() time.Time
+}
+
+func NewWebhookService(
+	webhookRepo repository.WebhookRepository,
+	chatRepo repository.ChatRepository,
+	userRepo repository.UserRepository,
+) WebhookService {
+	return &implWebhookService{
+		webhookRepo: webhookRepo,
+		chatRepo:    chatRepo,
+		userRepo:    userRepo,
+		client:      newWebhookClient(envDuration("WEBHOOK_TIMEOUT", 10*time.Second)),
+		maxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", 6),
+		retryBase:   envDuration("WEBHOOK_RETRY_BASE", 10*time.Second),
+		interval:    envDuration("WEBHOOK_WORKER_INTERVAL", 5*time.Second),
+		wake:        make(chan struct{}, 1),
+		now:         time.Now,
+	}
+}
+
+// newWebhookClient only connects to public addresses, so a webhook cannot be used to reach
+// services on the server's network
+func newWebhookClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: newOutboundTransport(timeout, isPublicAddr),
+		// A redirect would resend the signed payload somewhere the admin did not register
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (s *implWebhookService) CreateWebhook(requesterID, chatID int64, rawURL string, events []string) (*entity.Webhook, string, error) {
+	if err := s.ensureChatAdmin(chatID, requesterID); err != nil {
+		return nil, "", err
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, "", errors.New("webhook URL must be an absolute http or https URL")
+	}
+	if isNonPublicHost(parsed.Hostname()) {
+		return nil, "", errors.New("webhook URL must point to a public address")
+	}
+
+	for _, event := range events {
+		if !isWebhookEvent(event) {
+			return nil, "", fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	webhook := &entity.Webhook{
+		ChatID:    chatID,
+		URL:       parsed.String(),
+		Secret:    secret,
+		Events:    events,
+		IsActive:  true,
+		CreatedBy: requesterID,
+	}
+
+	if err := s.webhookRepo.CreateWebhook(webhook); err != nil {
+		return nil, "", err
+	}
+
+	return webhook, secret, nil
+}
+
+func (s *implWebhookService) GetWebhooks(requesterID, chatID int64) ([]*entity.Webhook, error) {
+	if err := s.ensureChatAdmin(chatID, requesterID); err != nil {
+		return nil, err
+	}
+
+	return s.webhookRepo.GetWebhooksByChat(chatID)
+}
+
+func (s *implWebhookService) DeleteWebhook(requesterID int64, webhookID string) error {
+	webhook, err := s.getManagedWebhook(requesterID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	return s.webhookRepo.DeleteWebhook(webhook.ID)
+}
+
+func (s *implWebhookService) GetDeliveries(requesterID int64, webhookID string) ([]*entity.WebhookDelivery, error) {
+	webhook, err := s.getManagedWebhook(requesterID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.webhookRepo.GetDeliveriesByWebhook(webhook.ID, webhookDeliveryPage)
+}
+
+func (s *implWebhookService) getManagedWebhook(requesterID int64, webhookID string) (*entity.Webhook, error) {
+	id, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, errors.New("webhook not found")
+	}
+
+	webhook, err := s.webhookRepo.GetWebhookByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureChatAdmin(webhook.ChatID, requesterID); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *implWebhookService) ensureChatAdmin(chatID, userID int64) error {
+	return ensureChatAdmin(s.chatRepo, chatID, userID)
+}
+
+// ensureChatAdmin returns ErrNotChatAdmin unless the user is an admin of the chat
+func ensureChatAdmin(chatRepo repository.ChatRepository, chatID, userID int64) error {
+	if _, err := chatRepo.GetChatByID(chatID); err != nil {
+		return errors.New("chat not found")
+	}
+
+	members, err := chatRepo.GetChatMembers(chatID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.UserID == userID && member.Role == "admin" {
+			return nil
+		}
+	}
+
+	return ErrNotChatAdmin
+}
+
+func (s *implWebhookService) Publish(chatID int64, event string, data interface{}) {
+	webhooks, err := s.webhookRepo.GetActiveWebhooksByChat(chatID)
+	if err != nil {
+		log.Printf("Error loading webhooks for chat %d: %v", chatID, err)
+		return
+	}
+
+	queued := false
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+
+		// The delivery ID is part of the signed body so receivers can drop duplicates from retries
+		delivery := &entity.WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			WebhookID:     webhook.ID,
+			ChatID:        chatID,
+			Event:         event,
+			Status:        entity.DeliveryPending,
+			NextAttemptAt: s.now(),
+		}
+
+		body, err := json.Marshal(entity.WebhookPayload{
+			DeliveryID: delivery.ID.Hex(),
+			Event:      event,
+			ChatID:     chatID,
+			Timestamp:  s.now(),
+			Data:       data,
+		})
+		if err != nil {
+			log.Printf("Error encoding %s webhook payload: %v", event, err)
+			return
+		}
+		delivery.Payload = string(body)
+
+		if err := s.webhookRepo.CreateDelivery(delivery); err != nil {
+			log.Printf("Error queueing webhook delivery for %s: %v", webhook.ID.Hex(), err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// StartWorker delivers queued events every WEBHOOK_WORKER_INTERVAL, or right away when one is published
+func (s *implWebhookService) StartWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.ProcessDueDeliveries(); err != nil {
+				log.Printf("Error processing webhook deliveries: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+func (s *implWebhookService) ProcessDueDeliveries() (int, error) {
+	processed := 0
+	for {
+		delivery, err := s.webhookRepo.ClaimDueDelivery(s.now(), webhookClaimLease)
+		if err != nil {
+			return processed, err
+		}
+		if delivery == nil {
+			return processed, nil
+		}
+
+		s.attemptDelivery(delivery)
+		processed++
+	}
+}
+
+func (s *implWebhookService) attemptDelivery(delivery *entity.WebhookDelivery) {
+	webhook, err := s.webhookRepo.GetWebhookByID(delivery.WebhookID)
+	if err != nil || !webhook.IsActive {
+		delivery.Status = entity.DeliveryFailed
+		delivery.LastError = "webhook was removed or disabled"
+		s.saveDelivery(delivery)
+		return
+	}
+
+	delivery.Attempts++
+	statusCode, err := s.send(webhook, delivery)
+	delivery.LastStatusCode = statusCode
+
+	if err == nil {
+		now := s.now()
+		delivery.Status = entity.DeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		s.saveDelivery(delivery)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.maxAttempts {
+		delivery.Status = entity.DeliveryFailed
+		log.Printf("Giving up on webhook delivery %s after %d attempts: %v", delivery.ID.Hex(), delivery.Attempts, err)
+	} else {
+		delivery.NextAttemptAt = s.now().Add(s.backoff(delivery.Attempts))
+	}
+	s.saveDelivery(delivery)
+}
+
+func (s *implWebhookService) saveDelivery(delivery *entity.WebhookDelivery) {
+	if err := s.webhookRepo.UpdateDelivery(delivery); err != nil {
+		log.Printf("Error updating webhook delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+// backoff doubles the wait after every failed attempt, up to webhookMaxBackoff
+func (s *implWebhookService) backoff(attempts int) time.Duration {
+	wait := s.retryBase
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > webhookMaxBackoff {
+		wait = webhookMaxBackoff
+	}
+	return wait
+}
+
+// send posts the signed payload; any 2xx response counts as delivered
+func (s *implWebhookService) send(webhook *entity.Webhook, delivery *entity.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "computer-network-project-webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxDrain))
+
+	// The response body is not kept: the delivery log is shown to chat admins and must not
+	// become a way to read what a URL returns
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload computes the signature receivers compare against the signature header
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range entity.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
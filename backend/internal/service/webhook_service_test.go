@@ -0,0 +1,284 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rufflogix/computer-network-project/internal/entity"
+	"github.com/rufflogix/computer-network-project/internal/repository"
+)
+
+const webhookTestAdminID = 1
+
+type webhookTestEnv struct {
+	service  *implWebhookService
+	repo     *fakeWebhookRepository
+	chatID   int64
+	webhook  *entity.Webhook
+	clock    *testClock
+	requests int
+	mu       sync.Mutex
+}
+
+// newWebhookTestEnv registers a webhook pointing at an httptest server running handler
+func newWebhookTestEnv(t *testing.T, handler http.HandlerFunc) *webhookTestEnv {
+	t.Helper()
+
+	env := &webhookTestEnv{
+		repo:  newFakeWebhookRepository(),
+		clock: newTestClock(),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.mu.Lock()
+		env.requests++
+		env.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	chatRepo := repository.NewChatRepository()
+	env.chatID = newTestChat(t, chatRepo, map[int64]string{webhookTestAdminID: "admin"})
+
+	env.service = NewWebhookService(env.repo, chatRepo, nil).(*implWebhookService)
+	// The test server listens on loopback, which the production client refuses to reach
+	env.service.client = server.Client()
+	env.service.maxAttempts = 3
+	env.service.retryBase = 10 * time.Second
+	env.service.now = env.clock.Now
+
+	// Stored directly because CreateWebhook rightly refuses a loopback URL
+	env.webhook = &entity.Webhook{
+		ChatID:    env.chatID,
+		URL:       server.URL + "/hook",
+		Secret:    "test-secret",
+		IsActive:  true,
+		CreatedBy: webhookTestAdminID,
+	}
+	if err := env.repo.CreateWebhook(env.webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	return env
+}
+
+func (env *webhookTestEnv) requestCount() int {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return env.requests
+}
+
+func (env *webhookTestEnv) process(t *testing.T) int {
+	t.Helper()
+
+	processed, err := env.service.ProcessDueDeliveries()
+	if err != nil {
+		t.Fatalf("ProcessDueDeliveries: %v", err)
+	}
+	return processed
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		header http.Header
+		body   []byte
+	)
+	env := newWebhookTestEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	env.service.Publish(env.chatID, entity.WebhookMessageSent, map[string]string{"content": "hello"})
+	if processed := env.process(t); processed != 1 {
+		t.Fatalf("expected 1 delivery processed, got %d", processed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	delivery := env.repo.onlyDelivery(t)
+	if string(body) != delivery.Payload {
+		t.Fatalf("posted body %q does not match the stored payload %q", body, delivery.Payload)
+	}
+
+	timestamp := header.Get(WebhookTimestampHeader)
+	if timestamp == "" {
+		t.Fatal("timestamp header missing")
+	}
+	want := "sha256=" + SignWebhookPayload("test-secret", timestamp, body)
+	if got := header.Get(WebhookSignatureHeader); got != want {
+		t.Fatalf("signature header = %q, want %q", got, want)
+	}
+	if got := header.Get(WebhookEventHeader); got != entity.WebhookMessageSent {
+		t.Fatalf("event header = %q, want %q", got, entity.WebhookMessageSent)
+	}
+	if got := header.Get(WebhookDeliveryHeader); got != delivery.ID.Hex() {
+		t.Fatalf("delivery header = %q, want %q", got, delivery.ID.Hex())
+	}
+
+	if delivery.Status != entity.DeliverySucceeded || delivery.Attempts != 1 || delivery.DeliveredAt == nil {
+		t.Fatalf("unexpected delivery state: status=%s attempts=%d delivered_at=%v",
+			delivery.Status, delivery.Attempts, delivery.DeliveredAt)
+	}
+}
+
+func TestWebhookDeliveryRetriesWithBackoff(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		status = http.StatusInternalServerError
+	)
+	env := newWebhookTestEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, "internal details")
+	})
+	start := env.clock.Now()
+
+	env.service.Publish(env.chatID, entity.WebhookMessageSent, nil)
+	env.process(t)
+
+	delivery := env.repo.onlyDelivery(t)
+	if delivery.Status != entity.DeliveryPending || delivery.Attempts != 1 {
+		t.Fatalf("after first failure: status=%s attempts=%d", delivery.Status, delivery.Attempts)
+	}
+	if want := start.Add(10 * time.Second); !delivery.NextAttemptAt.Equal(want) {
+		t.Fatalf("next attempt at %v, want %v", delivery.NextAttemptAt, want)
+	}
+	if delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("last status code = %d", delivery.LastStatusCode)
+	}
+	if strings.Contains(delivery.LastError, "internal details") {
+		t.Fatalf("delivery log exposes the response body: %q", delivery.LastError)
+	}
+
+	// Not due yet
+	env.clock.Set(start.Add(9 * time.Second))
+	if processed := env.process(t); processed != 0 || env.requestCount() != 1 {
+		t.Fatalf("retried before the backoff elapsed: processed=%d requests=%d", processed, env.requestCount())
+	}
+
+	env.clock.Set(start.Add(10 * time.Second))
+	env.process(t)
+	delivery = env.repo.onlyDelivery(t)
+	if delivery.Attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", delivery.Attempts)
+	}
+	// The wait doubles after the second failure
+	if want := env.clock.Now().Add(20 * time.Second); !delivery.NextAttemptAt.Equal(want) {
+		t.Fatalf("next attempt at %v, want %v", delivery.NextAttemptAt, want)
+	}
+
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+
+	env.clock.Advance(20 * time.Second)
+	env.process(t)
+	delivery = env.repo.onlyDelivery(t)
+	if delivery.Status != entity.DeliverySucceeded || delivery.Attempts != 3 || delivery.LastError != "" {
+		t.Fatalf("after recovery: status=%s attempts=%d last_error=%q", delivery.Status, delivery.Attempts, delivery.LastError)
+	}
+}
+
+func TestWebhookDeliveryGivesUpAfterMaxAttempts(t *testing.T) {
+	env := newWebhookTestEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	env.service.Publish(env.chatID, entity.WebhookMessageSent, nil)
+	for i := 0; i < env.service.maxAttempts; i++ {
+		env.process(t)
+		env.clock.Advance(webhookMaxBackoff)
+	}
+
+	delivery := env.repo.onlyDelivery(t)
+	if delivery.Status != entity.DeliveryFailed || delivery.Attempts != env.service.maxAttempts {
+		t.Fatalf("status=%s attempts=%d, want failed after %d", delivery.Status, delivery.Attempts, env.service.maxAttempts)
+	}
+
+	env.clock.Advance(24 * time.Hour)
+	if processed := env.process(t); processed != 0 {
+		t.Fatalf("a failed delivery was picked up again")
+	}
+	if got := env.requestCount(); got != env.service.maxAttempts {
+		t.Fatalf("webhook was called %d times, want %d", got, env.service.maxAttempts)
+	}
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	env := newWebhookTestEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "secret upstream page")
+	})
+
+	env.service.Publish(env.chatID, entity.WebhookMemberJoined, nil)
+	env.process(t)
+
+	deliveries, err := env.service.GetDeliveries(webhookTestAdminID, env.webhook.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 logged delivery, got %d", len(deliveries))
+	}
+	logged := deliveries[0]
+	if logged.Event != entity.WebhookMemberJoined || logged.Attempts != 1 || logged.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected log entry: event=%s attempts=%d status=%d", logged.Event, logged.Attempts, logged.LastStatusCode)
+	}
+	if strings.Contains(logged.LastError, "secret upstream page") {
+		t.Fatalf("delivery log exposes the response body: %q", logged.LastError)
+	}
+
+	if _, err := env.service.GetDeliveries(webhookTestAdminID+1, env.webhook.ID.Hex()); !errors.Is(err, ErrNotChatAdmin) {
+		t.Fatalf("non-admin read the delivery log: %v", err)
+	}
+}
+
+func TestCreateWebhookRefusesNonPublicAddresses(t *testing.T) {
+	env := newWebhookTestEnv(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, rawURL := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if _, _, err := env.service.CreateWebhook(webhookTestAdminID, env.chatID, rawURL, nil); err == nil {
+			t.Errorf("CreateWebhook accepted %s", rawURL)
+		}
+	}
+
+	if _, _, err := env.service.CreateWebhook(webhookTestAdminID, env.chatID, "https://example.com/hook", nil); err != nil {
+		t.Fatalf("CreateWebhook refused a public URL: %v", err)
+	}
+}
+
+func TestWebhookClientRefusesNonPublicAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the production client reached a loopback server")
+	}))
+	defer server.Close()
+
+	resp, err := newWebhookClient(time.Second).Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the connection to be refused")
+	}
+	if !strings.Contains(err.Error(), "non-public address") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}